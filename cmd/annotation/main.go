@@ -1,49 +1,130 @@
 package main
 
 import (
-	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/annotation"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/klog/v2"
 	"os"
-	"time"
-)
 
-const (
-	checkInterval = 20 * time.Second
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/annotation"
+	ctrlCfg "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/datapath"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/hostgw"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/overlay"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/prober"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/logging"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
 )
 
+var log = klog.NewKlogr()
+
 func main() {
-	klog.Infoln("Start node annotation check")
-	if err := wait.PollImmediateInfinite(checkInterval, Run); err != nil {
-		klog.Infoln("wait PollImmediateInfinite err:", err)
+	if err := ctrlCfg.AnnotationCFG.LoadAnnotationConfig(); err != nil {
+		log.Error(err, "unable to load annotation config")
 		os.Exit(1)
 	}
-	klog.Infoln("Check task completed, program exit")
-}
+	flush, err := logging.Setup(ctrlCfg.AnnotationCFG.LogFormat, ctrlCfg.AnnotationCFG.LogLevel)
+	if err != nil {
+		log.Error(err, "unable to set up logging")
+		os.Exit(1)
+	}
+	defer flush()
 
-func Run() (bool, error) {
 	// If the node name is not passed through the download API,
-	// it is considered a startup error and an error is returned,
-	// os.Exit(1)
+	// it is considered a startup error
 	nodeName, err := annotation.GetNodeName()
 	if err != nil {
-		klog.Infoln(err)
-		return false, err
+		log.Error(err, "failed to get node name")
+		os.Exit(1)
+	}
+	log.Info("Start node annotation agent", "node", nodeName)
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		log.Error(err, "unable to set up client config")
+		os.Exit(1)
+	}
+
+	options := manager.Options{
+		MetricsBindAddress:     ctrlCfg.AnnotationCFG.MetricsBindAddress,
+		HealthProbeBindAddress: ctrlCfg.AnnotationCFG.HealthProbeBindAddress,
+	}
+	fallback := ctrlCfg.AnnotationCFG.HostGWFallback || ctrlCfg.AnnotationCFG.OverlayFallback
+	if !fallback && !ctrlCfg.AnnotationCFG.PodNetworkProbe {
+		// only watch the node the agent runs on, the fallback datapaths and the prober need all peers
+		options.NewCache = cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&v1.Node{}: {Field: fields.OneTermEqualSelector("metadata.name", nodeName)},
+			},
+		})
+	}
+	mgr, err := manager.New(cfg, options)
+	if err != nil {
+		log.Error(err, "failed to create manager")
+		os.Exit(1)
 	}
-	klog.Infoln("Current node name:", nodeName)
-	controller, err := annotation.NewController()
+
+	metric.RegisterAnnotationPrometheus()
+	r, err := annotation.Add(mgr, nodeName, ctrlCfg.AnnotationCFG)
 	if err != nil {
-		klog.Infoln(err)
-		return false, err
+		log.Error(err, "add node annotation controller failed")
+		os.Exit(1)
 	}
-	// loop until successful or serious error
-	if err := controller.EnsureNodeInstanceId(nodeName); err != nil {
-		klog.Infof("failed to EnsureNodeInstanceId, %v", err)
-		return false, nil
+	if fallback {
+		opts := hostgw.Options{
+			HostGW:       ctrlCfg.AnnotationCFG.HostGWFallback,
+			Interface:    ctrlCfg.AnnotationCFG.HostGWInterface,
+			ResyncPeriod: ctrlCfg.AnnotationCFG.ResyncPeriod,
+		}
+		if ctrlCfg.AnnotationCFG.OverlayFallback {
+			opts.Tunnel = overlay.NewTunnel(ctrlCfg.AnnotationCFG.OverlayDevice, ctrlCfg.AnnotationCFG.OverlayPort)
+		}
+		if err := hostgw.Add(mgr, nodeName, opts); err != nil {
+			log.Error(err, "add fallback datapath controller failed")
+			os.Exit(1)
+		}
 	}
-	if err := controller.EnsureNodeZone(nodeName); err != nil {
-		klog.Infof("failed to EnsureNodeZone, %v", err)
-		return false, nil
+	if ctrlCfg.AnnotationCFG.PodNetworkProbe {
+		p := prober.New(mgr.GetClient(), nodeName, prober.NewICMPPinger(), prober.Options{
+			Interval: ctrlCfg.AnnotationCFG.ProbeInterval,
+			Timeout:  ctrlCfg.AnnotationCFG.ProbeTimeout,
+			Sample:   ctrlCfg.AnnotationCFG.ProbeSample,
+			Offset:   ctrlCfg.AnnotationCFG.ProbeOffset,
+		})
+		if err := mgr.Add(p); err != nil {
+			log.Error(err, "add pod network prober failed")
+			os.Exit(1)
+		}
+	}
+	if ctrlCfg.AnnotationCFG.DatapathCheck {
+		c := datapath.NewChecker(mgr.GetClient(), nodeName, datapath.Options{
+			Interval:   ctrlCfg.AnnotationCFG.DatapathCheckInterval,
+			MinMTU:     ctrlCfg.AnnotationCFG.DatapathMinMTU,
+			FixSysctls: ctrlCfg.AnnotationCFG.DatapathFixSysctls,
+		})
+		if err := mgr.Add(c); err != nil {
+			log.Error(err, "add datapath checker failed")
+			os.Exit(1)
+		}
+	}
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		log.Error(err, "unable to add healthz check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("node-annotations", r.Readyz); err != nil {
+		log.Error(err, "unable to add readyz check")
+		os.Exit(1)
+	}
+
+	log.Info("Starting the node annotation agent")
+	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+		log.Error(err, "unable to run the manager")
+		os.Exit(1)
 	}
-	return true, nil
 }
@@ -1,28 +1,32 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"os"
 	"runtime"
 
 	"k8s.io/client-go/rest"
-	"k8s.io/klog/v2/klogr"
+	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/alert"
 	ctrlCfg "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/health"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/logging"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/tracing"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/version"
 )
 
-var log = klogr.New()
+var log = klog.NewKlogr()
 
 func printVersion() {
-	log.Info(fmt.Sprintf("VPC Route Manager Version: %s, git commit: %s, build date: %s",
-		version.Version, version.GitCommit, version.BuildDate))
-	log.Info(fmt.Sprintf("Go version: %s", runtime.Version()))
-	log.Info(fmt.Sprintf("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH))
+	log.Info("VPC Route Manager", "version", version.Version, "gitCommit", version.GitCommit, "buildDate", version.BuildDate)
+	log.Info("Go runtime", "version", runtime.Version(), "os", runtime.GOOS, "arch", runtime.GOARCH)
 }
 
 func main() {
@@ -32,8 +36,35 @@ func main() {
 		os.Exit(1)
 	}
 
+	flushLogs, err := logging.Setup(ctrlCfg.ControllerCFG.LogFormat, ctrlCfg.ControllerCFG.LogLevel)
+	if err != nil {
+		log.Error(err, "unable to set up logging")
+		os.Exit(1)
+	}
+	defer flushLogs()
+
 	printVersion()
 
+	if err := ksyun.Init(); err != nil {
+		log.Error(err, "unable to load net config")
+		os.Exit(1)
+	}
+	if err := ksyun.DiscoverVpc(context.Background()); err != nil {
+		log.Error(err, "unable to discover vpc")
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), ctrlCfg.ControllerCFG.TracingConfig)
+	if err != nil {
+		log.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error(err, "failed to shutdown tracing")
+		}
+	}()
+
 	// Get a config to talk to the api-server
 	cfg := config.GetConfigOrDie()
 	cfg.QPS = ctrlCfg.ControllerCFG.RuntimeConfig.QPS
@@ -48,16 +79,33 @@ func main() {
 		os.Exit(1)
 	}
 
+	metric.RegisterPrometheus()
 	log.Info("Registering Components.")
 	if err := controller.AddToManager(mgr, ctrlCfg.ControllerCFG.Controllers); err != nil {
-		log.Error(err, "add controller: %s", err.Error())
+		log.Error(err, "add controller failed")
 		os.Exit(1)
 	} else {
-		log.Info(fmt.Sprintf("Loaded controllers: %v", ctrlCfg.ControllerCFG.Controllers))
+		log.Info("Loaded controllers", "controllers", ctrlCfg.ControllerCFG.Controllers)
+	}
+
+	alert.SetEventRecorder(mgr.GetEventRecorderFor("vpc-route-controller"))
+	ksyun.Alerts.SetStore(alert.NewConfigMapStore(mgr.GetAPIReader(), mgr.GetClient()))
+	health.SetCloudProbe(ksyun.CheckCloudAPI)
+	if err := mgr.AddHealthzCheck("route-sync", health.DefaultTracker.Healthz); err != nil {
+		log.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("cloud-api", health.DefaultTracker.Readyz); err != nil {
+		log.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+	if err := mgr.AddMetricsExtraHandler(health.DebugPath, health.DefaultTracker); err != nil {
+		log.Error(err, "unable to set up status endpoint")
+		os.Exit(1)
 	}
 
 	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
-		log.Error(err, "Manager exited non-zero: %s", err.Error())
+		log.Error(err, "Manager exited non-zero")
 		os.Exit(1)
 	}
 }
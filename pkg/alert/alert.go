@@ -0,0 +1,79 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severity of an alert, sinks drop alerts below their minimum severity
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+func (s Severity) level() int {
+	switch s {
+	case SeverityCritical:
+		return 2
+	case SeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ParseSeverity parses a configured severity, an empty string means info
+func ParseSeverity(s string) (Severity, error) {
+	switch Severity(strings.ToLower(s)) {
+	case "", SeverityInfo:
+		return SeverityInfo, nil
+	case SeverityWarning:
+		return SeverityWarning, nil
+	case SeverityCritical:
+		return SeverityCritical, nil
+	default:
+		return "", fmt.Errorf("unknown alert severity %q", s)
+	}
+}
+
+// Alert is a notification about a failure of the controller
+type Alert struct {
+	// Name identifies the failing operation, e.g. CreateRoute
+	Name     string
+	Severity Severity
+	Summary  string
+	Details  string
+	// Labels are part of the deduplication key, they must not hold per call values
+	Labels map[string]string
+	// Resolved is set when the failure is over
+	Resolved bool
+	Time     time.Time
+}
+
+// key identifies identical alerts for deduplication. Details are left out since
+// they carry request ids that differ on every failure.
+func (a *Alert) key() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s/%s/%t", a.Name, a.Severity, a.Resolved)
+	keys := make([]string, 0, len(a.Labels))
+	for k := range a.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "/%s=%s", k, a.Labels[k])
+	}
+	return b.String()
+}
+
+// AlertSink delivers alerts to a notification channel
+type AlertSink interface {
+	Name() string
+	Send(ctx context.Context, a Alert) error
+}
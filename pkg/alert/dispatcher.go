@@ -0,0 +1,171 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/config"
+)
+
+const (
+	SinkKingsoft = "kingsoft"
+	SinkWebhook  = "webhook"
+	SinkSlack    = "slack"
+	SinkEvent    = "event"
+
+	defaultDedupWindow      = 30 * time.Minute
+	defaultRateLimitPerHour = 30
+	defaultBurst            = 10
+)
+
+type sinkEntry struct {
+	sink        AlertSink
+	minSeverity Severity
+}
+
+// Dispatcher fans alerts out to the configured sinks, dropping duplicates and
+// limiting the rate so an outage does not flood on-call.
+type Dispatcher struct {
+	sinks   []sinkEntry
+	window  time.Duration
+	limiter *rate.Limiter
+
+	lock sync.Mutex
+	sent map[string]time.Time
+	now  func() time.Time
+}
+
+// NewDispatcher builds the sinks from conf.Alert. When no alert config is set
+// the kingsoft alarm sink is used if alarm_enabled is true.
+func NewDispatcher(conf *config.Config) (*Dispatcher, error) {
+	ac := conf.Alert
+	if ac == nil {
+		ac = &config.AlertConfig{}
+		if conf.AlarmEnabled {
+			ac.Sinks = []config.AlertSinkConfig{{Type: SinkKingsoft}}
+		}
+	}
+
+	d := &Dispatcher{
+		window: defaultDedupWindow,
+		sent:   make(map[string]time.Time),
+		now:    time.Now,
+	}
+	if ac.DedupWindow != "" {
+		window, err := time.ParseDuration(ac.DedupWindow)
+		if err != nil {
+			return nil, fmt.Errorf("parse alert dedup_window %q error: %v", ac.DedupWindow, err)
+		}
+		d.window = window
+	}
+	perHour, burst := ac.RateLimitPerHour, ac.Burst
+	if perHour <= 0 {
+		perHour = defaultRateLimitPerHour
+	}
+	if burst <= 0 {
+		burst = defaultBurst
+	}
+	d.limiter = rate.NewLimiter(rate.Limit(float64(perHour)/time.Hour.Seconds()), burst)
+
+	for i, sc := range ac.Sinks {
+		minSeverity, err := ParseSeverity(sc.MinSeverity)
+		if err != nil {
+			return nil, fmt.Errorf("alert sink %d: %v", i, err)
+		}
+		var sink AlertSink
+		switch sc.Type {
+		case SinkKingsoft:
+			sink = NewKingsoftSink(conf, sc, ac.SeverityPriority)
+		case SinkWebhook:
+			if sc.URL == "" {
+				return nil, fmt.Errorf("alert sink %d: webhook url is empty", i)
+			}
+			sink = NewWebhookSink(sc.URL, sc.Headers)
+		case SinkSlack:
+			if sc.URL == "" {
+				return nil, fmt.Errorf("alert sink %d: slack url is empty", i)
+			}
+			sink = NewSlackSink(sc.URL, sc.Headers)
+		case SinkEvent:
+			sink = NewEventSink()
+		default:
+			return nil, fmt.Errorf("alert sink %d: unknown type %q", i, sc.Type)
+		}
+		d.sinks = append(d.sinks, sinkEntry{sink: sink, minSeverity: minSeverity})
+	}
+	return d, nil
+}
+
+// Notify sends the alert to every sink accepting its severity. Duplicates within
+// the dedup window and alerts over the rate limit are dropped.
+func (d *Dispatcher) Notify(ctx context.Context, a Alert) {
+	if d == nil || len(d.sinks) == 0 {
+		return
+	}
+	if a.Time.IsZero() {
+		a.Time = d.now()
+	}
+	logger := klog.FromContext(ctx).WithValues("alert", a.Name, "severity", a.Severity, "resolved", a.Resolved)
+
+	switch d.admit(&a) {
+	case dropDuplicate:
+		logger.V(4).Info("Drop duplicated alert")
+		return
+	case dropRateLimited:
+		logger.Info("Drop alert over the rate limit")
+		return
+	}
+
+	for _, e := range d.sinks {
+		if a.Severity.level() < e.minSeverity.level() {
+			continue
+		}
+		if err := e.sink.Send(ctx, a); err != nil {
+			logger.Error(err, "Failed to send alert", "sink", e.sink.Name())
+		}
+	}
+}
+
+// drop is why admit drops an alert
+type drop int
+
+const (
+	dropNone drop = iota
+	dropDuplicate
+	dropRateLimited
+)
+
+// admit drops duplicates within the window and firing alerts over the rate limit.
+// An alert is only remembered once admitted, so a rate limited alert is sent when it
+// repeats after the limiter recovered.
+func (d *Dispatcher) admit(a *Alert) drop {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	now := d.now()
+	for k, t := range d.sent {
+		if now.Sub(t) >= d.window {
+			delete(d.sent, k)
+		}
+	}
+	key := a.key()
+	if _, ok := d.sent[key]; ok {
+		return dropDuplicate
+	}
+	if !a.Resolved && !d.limiter.AllowN(now, 1) {
+		return dropRateLimited
+	}
+	d.sent[key] = now
+	// a resolved alert ends the deduplication of its firing alerts and the other
+	// way round, so a failure coming back after recovery is reported again
+	for _, severity := range []Severity{SeverityInfo, SeverityWarning, SeverityCritical} {
+		opposite := *a
+		opposite.Severity, opposite.Resolved = severity, !a.Resolved
+		delete(d.sent, opposite.key())
+	}
+	return dropNone
+}
@@ -0,0 +1,83 @@
+package alert
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func newTestDispatcher(sink AlertSink, now *time.Time, limiter *rate.Limiter) *Dispatcher {
+	return &Dispatcher{
+		sinks:   []sinkEntry{{sink: sink, minSeverity: SeverityInfo}},
+		window:  10 * time.Minute,
+		limiter: limiter,
+		sent:    make(map[string]time.Time),
+		now:     func() time.Time { return *now },
+	}
+}
+
+func TestDispatcherDedupWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink := &recordSink{}
+	d := newTestDispatcher(sink, &now, rate.NewLimiter(rate.Inf, 1))
+
+	firing := Alert{Name: "ListRoutes", Severity: SeverityWarning, Labels: map[string]string{"vpc": "a"}}
+	d.Notify(ctx, firing)
+	now = now.Add(5 * time.Minute)
+	d.Notify(ctx, firing)
+	if len(sink.alerts) != 1 {
+		t.Fatalf("expected the duplicate within the window to be dropped, got %d alerts", len(sink.alerts))
+	}
+
+	other := firing
+	other.Labels = map[string]string{"vpc": "b"}
+	d.Notify(ctx, other)
+	if len(sink.alerts) != 2 {
+		t.Fatalf("expected an alert with other labels to be sent, got %d alerts", len(sink.alerts))
+	}
+
+	now = now.Add(5 * time.Minute)
+	d.Notify(ctx, firing)
+	if len(sink.alerts) != 3 {
+		t.Fatalf("expected the alert to be sent again after the window, got %d alerts", len(sink.alerts))
+	}
+
+	resolved := firing
+	resolved.Resolved = true
+	d.Notify(ctx, resolved)
+	d.Notify(ctx, firing)
+	if len(sink.alerts) != 5 {
+		t.Fatalf("expected a resolved alert to end the deduplication of the firing one, got %d alerts", len(sink.alerts))
+	}
+}
+
+func TestDispatcherRateLimit(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink := &recordSink{}
+	// one token per minute, burst of two
+	d := newTestDispatcher(sink, &now, rate.NewLimiter(rate.Every(time.Minute), 2))
+
+	for _, name := range []string{"a", "b", "c"} {
+		d.Notify(ctx, Alert{Name: name, Severity: SeverityCritical, Time: now})
+	}
+	if len(sink.alerts) != 2 {
+		t.Fatalf("expected the burst to be sent, got %d alerts", len(sink.alerts))
+	}
+
+	// a resolved alert is not rate limited
+	d.Notify(ctx, Alert{Name: "a", Severity: SeverityCritical, Resolved: true, Time: now})
+	if len(sink.alerts) != 3 {
+		t.Fatalf("expected the resolved alert to be sent, got %d alerts", len(sink.alerts))
+	}
+
+	// the limited alert was not remembered, it is sent once the limiter recovered
+	now = now.Add(time.Minute)
+	d.Notify(ctx, Alert{Name: "c", Severity: SeverityCritical, Time: now})
+	if len(sink.alerts) != 4 || sink.alerts[3].Name != "c" {
+		t.Fatalf("expected the rate limited alert to be sent after recovery, got %+v", sink.alerts)
+	}
+}
@@ -0,0 +1,72 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var (
+	recorderLock  sync.RWMutex
+	eventRecorder record.EventRecorder
+)
+
+// SetEventRecorder sets the recorder used by the event sink, events are dropped until it is set
+func SetEventRecorder(recorder record.EventRecorder) {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+	eventRecorder = recorder
+}
+
+// EventSink records alerts as events on the controller pod, which is taken from
+// the POD_NAME and POD_NAMESPACE environment variables.
+type EventSink struct {
+	ref *v1.ObjectReference
+}
+
+var _ AlertSink = &EventSink{}
+
+func NewEventSink() *EventSink {
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		namespace = "kube-system"
+	}
+	return &EventSink{
+		ref: &v1.ObjectReference{
+			Kind:      "Pod",
+			Name:      os.Getenv("POD_NAME"),
+			Namespace: namespace,
+		},
+	}
+}
+
+func (s *EventSink) Name() string {
+	return SinkEvent
+}
+
+func (s *EventSink) Send(_ context.Context, a Alert) error {
+	recorderLock.RLock()
+	recorder := eventRecorder
+	recorderLock.RUnlock()
+	if recorder == nil {
+		return fmt.Errorf("event recorder is not set")
+	}
+	if s.ref.Name == "" {
+		return fmt.Errorf("POD_NAME is not set")
+	}
+
+	eventType := v1.EventTypeWarning
+	reason := a.Name + "Failed"
+	if a.Resolved || a.Severity == SeverityInfo {
+		eventType = v1.EventTypeNormal
+	}
+	if a.Resolved {
+		reason = a.Name + "Resolved"
+	}
+	recorder.Eventf(s.ref, eventType, reason, "%s: %s", a.Summary, a.Details)
+	return nil
+}
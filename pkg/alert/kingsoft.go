@@ -0,0 +1,71 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+
+	prvd "github.com/kingsoftcloud/aksk-provider"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/alarm"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/config"
+	openstackTypes "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/types"
+)
+
+var defaultSeverityPriority = map[Severity]string{
+	SeverityCritical: "1",
+	SeverityWarning:  "2",
+	SeverityInfo:     "3",
+}
+
+// KingsoftSink creates alarms through the kingsoft AlarmReceptor api
+type KingsoftSink struct {
+	conf     *config.Config
+	provider prvd.AKSKProvider
+	priority map[Severity]string
+}
+
+var _ AlertSink = &KingsoftSink{}
+
+// NewKingsoftSink uses the sink credentials if set, then the credentials linked
+// in at build time, then the aksk provider of the controller.
+func NewKingsoftSink(conf *config.Config, sc config.AlertSinkConfig, priority map[string]string) *KingsoftSink {
+	s := &KingsoftSink{
+		conf:     conf,
+		priority: make(map[Severity]string, len(defaultSeverityPriority)),
+	}
+	for k, v := range defaultSeverityPriority {
+		s.priority[k] = v
+	}
+	for k, v := range priority {
+		s.priority[Severity(k)] = v
+	}
+
+	switch {
+	case sc.AK != "" && sc.SK != "":
+		s.provider = alarm.NewStaticAKSKProvider(sc.AK, sc.SK)
+	case alarm.AKForAlarm != "" && alarm.SKForAlarm != "":
+		s.provider = alarm.NewStaticAKSKProvider(alarm.AKForAlarm, alarm.SKForAlarm)
+	default:
+		s.provider = conf.AkskProvider
+	}
+	return s
+}
+
+func (s *KingsoftSink) Name() string {
+	return SinkKingsoft
+}
+
+func (s *KingsoftSink) Send(ctx context.Context, a Alert) error {
+	content := fmt.Sprintf("region: %s, cluster: %s, plugin: vpc-route-controller,  error: %s", s.conf.Region, s.conf.ClusterUUID, a.Details)
+	if a.Resolved {
+		content = fmt.Sprintf("region: %s, cluster: %s, plugin: vpc-route-controller,  resolved: %s", s.conf.Region, s.conf.ClusterUUID, a.Summary)
+	}
+	mesg := openstackTypes.AlarmArgs{
+		Name:     a.Name,
+		Priority: s.priority[a.Severity],
+		Product:  alarm.DefaultProduct,
+		NoDeal:   "1",
+		Content:  content,
+	}
+	return alarm.NewAlarmClient(ctx, s.conf, s.provider).CreateAlarm(mesg)
+}
@@ -0,0 +1,201 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const defaultEscalateAfter = 30 * time.Minute
+
+// FailureState is the state of one group of failures, persisted so a new
+// leader keeps escalating and resolving the alerts of the previous one.
+type FailureState struct {
+	Op        string    `json:"op"`
+	Code      string    `json:"code"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Count     int       `json:"count"`
+	LastError string    `json:"lastError"`
+	Escalated bool      `json:"escalated"`
+}
+
+func (s *FailureState) severity() Severity {
+	if s.Escalated {
+		return SeverityCritical
+	}
+	return SeverityWarning
+}
+
+// StateStore loads and saves the failure groups of the manager
+type StateStore interface {
+	Load(ctx context.Context) (map[string]*FailureState, error)
+	Save(ctx context.Context, state map[string]*FailureState) error
+}
+
+// Manager groups failures by operation and error code. It sends one firing
+// alert per group, escalates it to critical if the failure persists and
+// sends a resolved alert once the operation succeeds again.
+type Manager struct {
+	dispatcher    *Dispatcher
+	escalateAfter time.Duration
+	labels        map[string]string
+
+	lock   sync.Mutex
+	store  StateStore
+	loaded bool
+	groups map[string]*FailureState
+	now    func() time.Time
+}
+
+// NewManager creates a manager sending to d, labels are added to every alert
+func NewManager(d *Dispatcher, escalateAfter time.Duration, labels map[string]string) *Manager {
+	if escalateAfter <= 0 {
+		escalateAfter = defaultEscalateAfter
+	}
+	return &Manager{
+		dispatcher:    d,
+		escalateAfter: escalateAfter,
+		labels:        labels,
+		groups:        make(map[string]*FailureState),
+		now:           time.Now,
+	}
+}
+
+// SetStore sets where the state is persisted, the state is kept in memory only until it is set
+func (m *Manager) SetStore(store StateStore) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.store = store
+	m.loaded = false
+}
+
+// SetLabels replaces the labels added to every alert
+func (m *Manager) SetLabels(labels map[string]string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.labels = labels
+}
+
+// Failure records a failed operation. The state is persisted only when a group is
+// created or escalated, and alerts are sent after the lock is released, so the
+// cloud calls reporting failures are not held up by the store or slow sinks.
+func (m *Manager) Failure(ctx context.Context, op, code string, err error) {
+	alerts := m.failure(ctx, op, code, err)
+	m.notify(ctx, alerts)
+}
+
+func (m *Manager) failure(ctx context.Context, op, code string, err error) []Alert {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.load(ctx)
+
+	now := m.now()
+	key := op + "/" + code
+	s, ok := m.groups[key]
+	if !ok {
+		s = &FailureState{Op: op, Code: code, FirstSeen: now}
+		m.groups[key] = s
+	}
+	s.LastSeen = now
+	s.Count++
+	s.LastError = err.Error()
+
+	switch {
+	case !ok:
+	case !s.Escalated && now.Sub(s.FirstSeen) >= m.escalateAfter:
+		s.Escalated = true
+	default:
+		return nil
+	}
+	m.save(ctx)
+	return []Alert{m.alertOf(s, false)}
+}
+
+// Success resolves every failure group of op
+func (m *Manager) Success(ctx context.Context, op string) {
+	alerts := m.success(ctx, op)
+	m.notify(ctx, alerts)
+}
+
+func (m *Manager) success(ctx context.Context, op string) []Alert {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.load(ctx)
+
+	var alerts []Alert
+	for key, s := range m.groups {
+		if s.Op != op {
+			continue
+		}
+		alerts = append(alerts, m.alertOf(s, true))
+		delete(m.groups, key)
+	}
+	if len(alerts) != 0 {
+		m.save(ctx)
+	}
+	return alerts
+}
+
+func (m *Manager) notify(ctx context.Context, alerts []Alert) {
+	for _, a := range alerts {
+		m.dispatcher.Notify(ctx, a)
+	}
+}
+
+func (m *Manager) alertOf(s *FailureState, resolved bool) Alert {
+	labels := make(map[string]string, len(m.labels)+1)
+	for k, v := range m.labels {
+		labels[k] = v
+	}
+	labels["code"] = s.Code
+
+	a := Alert{
+		Name:     s.Op,
+		Severity: s.severity(),
+		Labels:   labels,
+		Resolved: resolved,
+		Details:  s.LastError,
+	}
+	switch {
+	case resolved:
+		a.Summary = fmt.Sprintf("vpc-route-controller %s recovered after %d failures since %s",
+			s.Op, s.Count, s.FirstSeen.Format(time.RFC3339))
+	case s.Escalated:
+		a.Summary = fmt.Sprintf("vpc-route-controller %s has been failing with %s since %s",
+			s.Op, s.Code, s.FirstSeen.Format(time.RFC3339))
+	default:
+		a.Summary = fmt.Sprintf("vpc-route-controller %s failed with %s", s.Op, s.Code)
+	}
+	return a
+}
+
+func (m *Manager) load(ctx context.Context) {
+	if m.loaded || m.store == nil {
+		return
+	}
+	groups, err := m.store.Load(ctx)
+	if err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to load alert state")
+		return
+	}
+	// failures seen before the state is loaded are kept, they are newer
+	for key, s := range groups {
+		if _, ok := m.groups[key]; !ok {
+			m.groups[key] = s
+		}
+	}
+	m.loaded = true
+}
+
+func (m *Manager) save(ctx context.Context) {
+	if m.store == nil {
+		return
+	}
+	if err := m.store.Save(ctx, m.groups); err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to save alert state")
+	}
+}
@@ -0,0 +1,181 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type recordSink struct {
+	alerts []Alert
+}
+
+func (s *recordSink) Name() string { return "record" }
+
+func (s *recordSink) Send(_ context.Context, a Alert) error {
+	s.alerts = append(s.alerts, a)
+	return nil
+}
+
+type memStore struct {
+	state map[string]*FailureState
+}
+
+func (s *memStore) Load(context.Context) (map[string]*FailureState, error) {
+	state := make(map[string]*FailureState, len(s.state))
+	for k, v := range s.state {
+		c := *v
+		state[k] = &c
+	}
+	return state, nil
+}
+
+func (s *memStore) Save(_ context.Context, state map[string]*FailureState) error {
+	s.state = make(map[string]*FailureState, len(state))
+	for k, v := range state {
+		c := *v
+		s.state[k] = &c
+	}
+	return nil
+}
+
+func newTestManager(sink AlertSink, now *time.Time) *Manager {
+	d := &Dispatcher{
+		sinks:   []sinkEntry{{sink: sink, minSeverity: SeverityInfo}},
+		window:  defaultDedupWindow,
+		limiter: rate.NewLimiter(rate.Inf, 1),
+		sent:    make(map[string]time.Time),
+		now:     func() time.Time { return *now },
+	}
+	m := NewManager(d, 30*time.Minute, nil)
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+func TestManagerLifecycle(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink := &recordSink{}
+	store := &memStore{}
+	m := newTestManager(sink, &now)
+	m.SetStore(store)
+
+	failure := errors.New("kop error")
+	for i := 0; i < 5; i++ {
+		m.Failure(ctx, "ListRoutes", "HTTP500", failure)
+		now = now.Add(5 * time.Minute)
+	}
+	if len(sink.alerts) != 1 || sink.alerts[0].Severity != SeverityWarning || sink.alerts[0].Resolved {
+		t.Fatalf("expected one firing warning, got %+v", sink.alerts)
+	}
+
+	// a new leader picks up the state and escalates
+	now = now.Add(10 * time.Minute)
+	m2 := newTestManager(sink, &now)
+	m2.SetStore(store)
+	m2.Failure(ctx, "ListRoutes", "HTTP500", failure)
+	m2.Failure(ctx, "ListRoutes", "HTTP500", failure)
+	if len(sink.alerts) != 2 || sink.alerts[1].Severity != SeverityCritical {
+		t.Fatalf("expected escalation to critical, got %+v", sink.alerts)
+	}
+
+	m2.Success(ctx, "FindRoute")
+	if len(sink.alerts) != 2 {
+		t.Fatalf("success of another operation must not resolve, got %+v", sink.alerts)
+	}
+	m2.Success(ctx, "ListRoutes")
+	if len(sink.alerts) != 3 || !sink.alerts[2].Resolved {
+		t.Fatalf("expected resolved alert, got %+v", sink.alerts)
+	}
+	if len(store.state) != 0 {
+		t.Fatalf("expected empty state after resolve, got %+v", store.state)
+	}
+
+	// the failure coming back is reported again
+	m2.Failure(ctx, "ListRoutes", "HTTP500", failure)
+	if len(sink.alerts) != 4 || sink.alerts[3].Resolved {
+		t.Fatalf("expected new firing alert, got %+v", sink.alerts)
+	}
+}
+
+type countStore struct {
+	memStore
+	saves int
+}
+
+func (s *countStore) Save(ctx context.Context, state map[string]*FailureState) error {
+	s.saves++
+	return s.memStore.Save(ctx, state)
+}
+
+// blockingSink blocks every send until released
+type blockingSink struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSink) Name() string { return "blocking" }
+
+func (s *blockingSink) Send(context.Context, Alert) error {
+	s.entered <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func TestManagerSavesOnStateChange(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &countStore{}
+	m := newTestManager(&recordSink{}, &now)
+	m.SetStore(store)
+
+	failure := errors.New("kop error")
+	for i := 0; i < 10; i++ {
+		m.Failure(ctx, "ListRoutes", "HTTP500", failure)
+		now = now.Add(time.Minute)
+	}
+	if store.saves != 1 {
+		t.Errorf("repeated failures saved %d times, want once for the new group", store.saves)
+	}
+	now = now.Add(30 * time.Minute)
+	m.Failure(ctx, "ListRoutes", "HTTP500", failure)
+	m.Failure(ctx, "ListRoutes", "HTTP500", failure)
+	if store.saves != 2 {
+		t.Errorf("escalation saved %d times in total, want 2", store.saves)
+	}
+	m.Success(ctx, "ListRoutes")
+	m.Success(ctx, "ListRoutes")
+	if store.saves != 3 {
+		t.Errorf("resolution saved %d times in total, want 3", store.saves)
+	}
+}
+
+func TestManagerSendsOutsideLock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink := &blockingSink{entered: make(chan struct{}), release: make(chan struct{})}
+	m := newTestManager(sink, &now)
+
+	sending := make(chan struct{})
+	go func() {
+		m.Failure(ctx, "ListRoutes", "HTTP500", errors.New("kop error"))
+		close(sending)
+	}()
+	<-sink.entered
+	// another operation is recorded while the first alert is stuck in the sink
+	done := make(chan struct{})
+	go func() {
+		m.Success(ctx, "FindRoute")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("recording an operation blocked on a slow sink")
+	}
+	close(sink.release)
+	<-sending
+}
@@ -0,0 +1,70 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Text   string       `json:"text,omitempty"`
+	Fields []slackField `json:"fields,omitempty"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// SlackSink posts Slack compatible incoming webhook messages
+type SlackSink struct {
+	webhook *WebhookSink
+}
+
+var _ AlertSink = &SlackSink{}
+
+func NewSlackSink(url string, headers map[string]string) *SlackSink {
+	return &SlackSink{webhook: NewWebhookSink(url, headers)}
+}
+
+func (s *SlackSink) Name() string {
+	return SinkSlack
+}
+
+func (s *SlackSink) Send(ctx context.Context, a Alert) error {
+	status, color := "FIRING", "warning"
+	switch {
+	case a.Resolved:
+		status, color = "RESOLVED", "good"
+	case a.Severity == SeverityCritical:
+		color = "danger"
+	case a.Severity == SeverityInfo:
+		color = "#439FE0"
+	}
+
+	keys := make([]string, 0, len(a.Labels))
+	for k := range a.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make([]slackField, 0, len(keys))
+	for _, k := range keys {
+		fields = append(fields, slackField{Title: k, Value: a.Labels[k], Short: true})
+	}
+
+	return s.webhook.post(ctx, slackMessage{
+		Text: fmt.Sprintf("[%s][%s] %s: %s", status, a.Severity, a.Name, a.Summary),
+		Attachments: []slackAttachment{{
+			Color:  color,
+			Text:   a.Details,
+			Fields: fields,
+		}},
+	})
+}
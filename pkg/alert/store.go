@@ -0,0 +1,91 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// StateConfigMapName is the ConfigMap the alert state is kept in
+	StateConfigMapName = "vpc-route-controller-alert-state"
+	stateKey           = "state.json"
+)
+
+// ConfigMapStore persists the alert state in a ConfigMap in the namespace of the controller
+type ConfigMapStore struct {
+	reader client.Reader
+	writer client.Client
+	key    types.NamespacedName
+}
+
+var _ StateStore = &ConfigMapStore{}
+
+// NewConfigMapStore reads with reader, which should not be a cached client
+// so the controller does not watch every ConfigMap, and writes with writer.
+func NewConfigMapStore(reader client.Reader, writer client.Client) *ConfigMapStore {
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		namespace = "kube-system"
+	}
+	return &ConfigMapStore{
+		reader: reader,
+		writer: writer,
+		key:    types.NamespacedName{Namespace: namespace, Name: StateConfigMapName},
+	}
+}
+
+func (s *ConfigMapStore) Load(ctx context.Context) (map[string]*FailureState, error) {
+	state := make(map[string]*FailureState)
+	cm := &v1.ConfigMap{}
+	if err := s.reader.Get(ctx, s.key, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("get configmap %s error: %v", s.key, err)
+	}
+	if data := cm.Data[stateKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &state); err != nil {
+			return nil, fmt.Errorf("unmarshal configmap %s error: %v", s.key, err)
+		}
+	}
+	return state, nil
+}
+
+func (s *ConfigMapStore) Save(ctx context.Context, state map[string]*FailureState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	cm := &v1.ConfigMap{}
+	if err := s.reader.Get(ctx, s.key, cm); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("get configmap %s error: %v", s.key, err)
+		}
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.key.Namespace, Name: s.key.Name},
+			Data:       map[string]string{stateKey: string(data)},
+		}
+		if err := s.writer.Create(ctx, cm); err != nil {
+			return fmt.Errorf("create configmap %s error: %v", s.key, err)
+		}
+		return nil
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[stateKey] = string(data)
+	if err := s.writer.Update(ctx, cm); err != nil {
+		return fmt.Errorf("update configmap %s error: %v", s.key, err)
+	}
+	return nil
+}
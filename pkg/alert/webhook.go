@@ -0,0 +1,74 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	kopHttp "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/http"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// WebhookPayload is the json body posted by the webhook sink
+type WebhookPayload struct {
+	Name     string            `json:"name"`
+	Severity Severity          `json:"severity"`
+	Summary  string            `json:"summary"`
+	Details  string            `json:"details,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Resolved bool              `json:"resolved"`
+	Time     time.Time         `json:"time"`
+}
+
+// WebhookSink posts every alert as json to a url
+type WebhookSink struct {
+	url     string
+	headers map[string]string
+	client  *kopHttp.Client
+}
+
+var _ AlertSink = &WebhookSink{}
+
+func NewWebhookSink(url string, headers map[string]string) *WebhookSink {
+	return &WebhookSink{
+		url:     url,
+		headers: headers,
+		client:  kopHttp.NewClient(&http.Client{Timeout: defaultWebhookTimeout}),
+	}
+}
+
+func (s *WebhookSink) Name() string {
+	return SinkWebhook
+}
+
+func (s *WebhookSink) Send(ctx context.Context, a Alert) error {
+	return s.post(ctx, WebhookPayload{
+		Name:     a.Name,
+		Severity: a.Severity,
+		Summary:  a.Summary,
+		Details:  a.Details,
+		Labels:   a.Labels,
+		Resolved: a.Resolved,
+		Time:     a.Time,
+	})
+}
+
+func (s *WebhookSink) post(ctx context.Context, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	_, err = s.client.DoRequest(req)
+	return err
+}
@@ -2,34 +2,118 @@ package annotation
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
 	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
-)
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
-type Controller struct {
-	Client *kubernetes.Clientset
-}
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metadata"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
+)
 
-func NewController() (*Controller, error) {
-	// /etc/kubernetes/admin.conf
-	config, err := clientcmd.BuildConfigFromFlags("", "")
+// Add registers the reconciler of the node the agent runs on. The manager cache
+// holds only this node unless host-gw fallback is enabled, see cmd/annotation.
+func Add(mgr manager.Manager, nodeName string, cfg *config.AnnotationConfig) (*ReconcileNode, error) {
+	md := metadata.NewClient(cfg.MetadataURL, cfg.MetadataTimeout, cfg.MetadataRetries, cfg.MetadataRetryInterval)
+	r := newReconciler(mgr.GetClient(), nodeName, cfg.ResyncPeriod, md)
+	err := builder.ControllerManagedBy(mgr).
+		Named("node-annotation").
+		For(&v1.Node{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetName() == nodeName
+		}))).
+		Complete(r)
 	if err != nil {
 		return nil, err
 	}
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, err
+	return r, nil
+}
+
+func newReconciler(c client.Client, nodeName string, resyncPeriod time.Duration, md *metadata.Client) *ReconcileNode {
+	return &ReconcileNode{
+		client:       c,
+		nodeName:     nodeName,
+		resyncPeriod: resyncPeriod,
+		md:           md,
+		cache:        make(map[string]string),
 	}
-	c := &Controller{Client: clientset}
-	return c, nil
 }
 
-func (c *Controller) GetNode(nodeName string) (*v1.Node, error) {
-	return c.Client.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+// ReconcileNode keeps the metadata derived annotations and labels of one node converged
+type ReconcileNode struct {
+	client       client.Client
+	nodeName     string
+	resyncPeriod time.Duration
+
+	md *metadata.Client
+
+	lock sync.Mutex
+	// metadata of the instance does not change, it is fetched once per path
+	cache     map[string]string
+	converged bool
 }
 
-func (c *Controller) UpdateNode(node *v1.Node) (*v1.Node, error) {
-	return c.Client.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{})
+var _ reconcile.Reconciler = &ReconcileNode{}
+
+func (r *ReconcileNode) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	logger := klog.FromContext(ctx).WithValues("node", request.Name)
+	ctx = klog.NewContext(ctx, logger)
+
+	node := &v1.Node{}
+	if err := r.client.Get(ctx, request.NamespacedName, node); err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		metric.NodeAnnotationReconcile.WithLabelValues("error").Inc()
+		return reconcile.Result{}, err
+	}
+
+	if err := r.EnsureNodeMetadata(ctx, node); err != nil {
+		metric.NodeAnnotationReconcile.WithLabelValues("error").Inc()
+		logger.Error(err, "Failed to ensure node metadata")
+		return reconcile.Result{}, err
+	}
+
+	r.lock.Lock()
+	r.converged = true
+	r.lock.Unlock()
+	metric.NodeAnnotationReconcile.WithLabelValues("success").Inc()
+	return reconcile.Result{RequeueAfter: r.resyncPeriod}, nil
+}
+
+// Readyz fails until the node annotations have been converged once
+func (r *ReconcileNode) Readyz(_ *http.Request) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.converged {
+		return fmt.Errorf("node %s annotations have not been converged yet", r.nodeName)
+	}
+	return nil
+}
+
+func (r *ReconcileNode) metadata(ctx context.Context, path string) (string, error) {
+	r.lock.Lock()
+	value, ok := r.cache[path]
+	r.lock.Unlock()
+	if ok {
+		return value, nil
+	}
+
+	value, err := r.md.Get(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	r.lock.Lock()
+	r.cache[path] = value
+	r.lock.Unlock()
+	return value, nil
 }
@@ -1,11 +1,18 @@
 package annotation
 
 import (
+	"context"
 	"fmt"
-	"io"
+	"strings"
+
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/klog/v2"
-	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
 )
 
 const (
@@ -17,10 +24,23 @@ const (
 	KCE1NodeAnnotationZoneKey = "appengine.sdns.ksyun.com/zone"
 	// KCE2NodeAnnotationZoneKey KCE2.0 node placement zone annotation key
 	KCE2NodeAnnotationZoneKey = "kce.sdns.ksyun.com/zone"
-)
 
-const (
-	metadataUrl = "http://11.255.255.100:8775/latest/meta-data/"
+	// NodeAnnotationRegionKey node region annotation key
+	NodeAnnotationRegionKey = "kce.sdns.ksyun.com/region"
+	// NodeAnnotationInstanceTypeKey node instance type annotation key
+	NodeAnnotationInstanceTypeKey = "kce.sdns.ksyun.com/instance-type"
+	// NodeAnnotationVpcIdKey node vpc id annotation key
+	NodeAnnotationVpcIdKey = "kce.sdns.ksyun.com/vpc-id"
+	// NodeAnnotationSubnetIdKey node subnet id annotation key
+	NodeAnnotationSubnetIdKey = "kce.sdns.ksyun.com/subnet-id"
+	// NodeAnnotationPrivateIPKey node primary private ip annotation key
+	NodeAnnotationPrivateIPKey = "kce.sdns.ksyun.com/private-ip"
+	// NodeAnnotationProjectIdKey node project id annotation key
+	NodeAnnotationProjectIdKey = "kce.sdns.ksyun.com/project-id"
+
+	// NodeAnnotationRouteCIDRKey is set by the route controller to the comma separated
+	// pod CIDRs the vpc routes of the node were created for
+	NodeAnnotationRouteCIDRKey = "kce.sdns.ksyun.com/route-cidr"
 )
 
 // IsExistedInstanceUUIDKey Check if the key exists
@@ -69,80 +89,127 @@ func setAnnotation(node *v1.Node, key, value string) *v1.Node {
 	return node
 }
 
-func getMetadataInstanceId() (string, error) {
-	return getMetadata("instance-id")
-}
-
-func getMetadataZone() (string, error) {
-	return getMetadata("placement/zone")
+// metadataItem is a value of the metadata service published on the node
+type metadataItem struct {
+	path       string
+	annotation string
+	// label is the well-known label also set to the value, if any
+	label string
+	// legacy is the KCE1.0 annotation, the annotation is not managed on nodes carrying it
+	legacy string
+	// optional items that can not be fetched are skipped instead of failing the reconcile
+	optional bool
 }
 
-func getMetadata(path string) (string, error) {
-	url := metadataUrl + path
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
+var (
+	instanceIdItem = metadataItem{
+		path:       "instance-id",
+		annotation: KCE2NodeAnnotationInstanceUUIDKey,
+		legacy:     KCE1NodeAnnotationInstanceUUIDKey,
 	}
-	defer resp.Body.Close()
-	regionByte, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+	zoneItem = metadataItem{
+		path:       "placement/zone",
+		annotation: KCE2NodeAnnotationZoneKey,
+		label:      v1.LabelTopologyZone,
+		legacy:     KCE1NodeAnnotationZoneKey,
 	}
-	// If failed, often 404
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Failed to obtain from metadata interface, accress path: %s, return: %s ", url, string(regionByte))
+
+	metadataItems = []metadataItem{
+		instanceIdItem,
+		zoneItem,
+		{path: "placement/region", annotation: NodeAnnotationRegionKey, label: v1.LabelTopologyRegion, optional: true},
+		{path: "instance-type", annotation: NodeAnnotationInstanceTypeKey, label: v1.LabelInstanceTypeStable, optional: true},
+		{path: "vpc-id", annotation: NodeAnnotationVpcIdKey, optional: true},
+		{path: "subnet-id", annotation: NodeAnnotationSubnetIdKey, optional: true},
+		{path: "local-ipv4", annotation: NodeAnnotationPrivateIPKey, optional: true},
+		{path: "project-id", annotation: NodeAnnotationProjectIdKey, optional: true},
 	}
-	return string(regionByte), nil
+)
+
+// EnsureNodeInstanceId keeps the instanceId annotation equal to the metadata,
+// nodes carrying the KCE1.0 annotation are left untouched
+func (r *ReconcileNode) EnsureNodeInstanceId(ctx context.Context, node *v1.Node) error {
+	return r.ensureMetadata(ctx, node, instanceIdItem)
+}
+
+// EnsureNodeZone keeps the zone annotation and topology label equal to the metadata,
+// the annotation of nodes carrying the KCE1.0 annotation is left untouched
+func (r *ReconcileNode) EnsureNodeZone(ctx context.Context, node *v1.Node) error {
+	return r.ensureMetadata(ctx, node, zoneItem)
 }
 
-// EnsureNodeInstanceId Adding instanceId annotation to nodes,
-// If instanceId annotation already exist, skip directly
-func (c *Controller) EnsureNodeInstanceId(nodeName string) error {
-	klog.Infoln("Call EnsureNodeInstanceId, node:", nodeName)
-	node, err := c.GetNode(nodeName)
-	if err != nil {
-		return err
+// EnsureNodeMetadata keeps all metadata derived annotations and labels converged
+func (r *ReconcileNode) EnsureNodeMetadata(ctx context.Context, node *v1.Node) error {
+	return r.ensureMetadata(ctx, node, metadataItems...)
+}
+
+func (r *ReconcileNode) ensureMetadata(ctx context.Context, node *v1.Node, items ...metadataItem) error {
+	logger := klog.FromContext(ctx)
+	annotations := make(map[string]string)
+	labels := make(map[string]string)
+	for _, item := range items {
+		_, legacy := node.Annotations[item.legacy]
+		legacy = legacy && item.legacy != ""
+		if legacy && item.label == "" {
+			continue
+		}
+		value, err := r.metadata(ctx, item.path)
+		if err != nil {
+			if item.optional {
+				logger.V(4).Info("Skip unavailable metadata", "path", item.path, "err", err.Error())
+				continue
+			}
+			return fmt.Errorf("get %s from metadata: %v", item.path, err)
+		}
+		if !legacy && node.Annotations[item.annotation] != value {
+			annotations[item.annotation] = value
+		}
+		if item.label == "" || node.Labels[item.label] == value {
+			continue
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) != 0 {
+			logger.Info("Skip invalid label value", "label", item.label, "value", value, "err", strings.Join(errs, "; "))
+			continue
+		}
+		labels[item.label] = value
 	}
-	if IsExistedInstanceUUIDKey(node) {
-		klog.Infoln("Current node already annotation InstanceUUID, annotation:", node.Annotations)
+	return r.patchNode(ctx, node, annotations, labels)
+}
+
+// patchNode sets the annotations and labels with a strategic merge patch, so it
+// does not race with kubelet updating the node status
+func (r *ReconcileNode) patchNode(ctx context.Context, node *v1.Node, annotations, labels map[string]string) error {
+	if len(annotations) == 0 && len(labels) == 0 {
 		return nil
 	}
-	instanceId, err := getMetadataInstanceId()
-	if err != nil {
-		return err
+	getter := func(obj runtime.Object) (client.Object, error) {
+		n, ok := obj.(*v1.Node)
+		if !ok {
+			return nil, fmt.Errorf("expect node, got %T", obj)
+		}
+		for k, v := range annotations {
+			setAnnotation(n, k, v)
+		}
+		if n.Labels == nil && len(labels) != 0 {
+			n.Labels = make(map[string]string)
+		}
+		for k, v := range labels {
+			n.Labels[k] = v
+		}
+		return n, nil
 	}
-	klog.Infoln("Node instance Id:", instanceId)
-	node = SetInstanceUUID(node, instanceId)
-	klog.Infoln("Node set annotations:", node.Annotations)
-	_, err = c.UpdateNode(node)
-	if err != nil {
-		return err
+	if err := helper.PatchM(r.client, node.DeepCopy(), getter, helper.PatchSpec); err != nil {
+		return fmt.Errorf("patch node %s metadata: %v", node.Name, err)
 	}
-	klog.Infoln("Node update completed")
-	return nil
-}
 
-func (c *Controller) EnsureNodeZone(nodeName string) error {
-	klog.Infoln("Call EnsureNodeZone, node:", nodeName)
-	node, err := c.GetNode(nodeName)
-	if err != nil {
-		return err
-	}
-	if IsExistedZoneKey(node) {
-		klog.Infoln("Current node already annotation Zone, annotation:", node.Annotations)
-		return nil
-	}
-	zone, err := getMetadataZone()
-	if err != nil {
-		return err
+	logger := klog.FromContext(ctx)
+	for k, v := range annotations {
+		metric.NodeAnnotationRepair.WithLabelValues(k).Inc()
+		logger.Info("Node annotated", "key", k, "value", v, "previous", node.Annotations[k])
 	}
-	klog.Infoln("Node placement zone:", zone)
-	node = SetZone(node, zone)
-	klog.Infoln("Node set annotations:", node.Annotations)
-	_, err = c.UpdateNode(node)
-	if err != nil {
-		return err
+	for k, v := range labels {
+		metric.NodeAnnotationRepair.WithLabelValues(k).Inc()
+		logger.Info("Node labeled", "key", k, "value", v, "previous", node.Labels[k])
 	}
-	klog.Infoln("Node update completed")
 	return nil
 }
@@ -0,0 +1,157 @@
+package annotation
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metadata"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metadata/fakemetadata"
+)
+
+const testNodeName = "10.0.0.2"
+
+func newTestReconciler(t *testing.T, node *v1.Node, server *fakemetadata.Server, timeout time.Duration, retries int) (*ReconcileNode, client.Client) {
+	t.Helper()
+	c := fake.NewClientBuilder().WithObjects(node).Build()
+	md := metadata.NewClient(server.BaseURL(), timeout, retries, 10*time.Millisecond)
+	return newReconciler(c, testNodeName, time.Minute, md), c
+}
+
+func getNode(t *testing.T, c client.Client) *v1.Node {
+	t.Helper()
+	node := &v1.Node{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: testNodeName}, node); err != nil {
+		t.Fatalf("get node: %v", err)
+	}
+	return node
+}
+
+func TestEnsureNodeInstanceIdAndZone(t *testing.T) {
+	server := fakemetadata.NewServer(map[string]string{
+		"instance-id":    "d5b4b9e0-0000-4000-8000-000000000001",
+		"placement/zone": "cn-beijing-6a",
+	})
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		instanceId  string
+		zone        string
+	}{
+		{
+			name:       "missing annotations are set",
+			instanceId: "d5b4b9e0-0000-4000-8000-000000000001",
+			zone:       "cn-beijing-6a",
+		},
+		{
+			name: "edited annotations are restored",
+			annotations: map[string]string{
+				KCE2NodeAnnotationInstanceUUIDKey: "wrong",
+				KCE2NodeAnnotationZoneKey:         "wrong",
+			},
+			instanceId: "d5b4b9e0-0000-4000-8000-000000000001",
+			zone:       "cn-beijing-6a",
+		},
+		{
+			name: "kce1 annotations are left untouched",
+			annotations: map[string]string{
+				KCE1NodeAnnotationInstanceUUIDKey: "kce1-instance",
+				KCE1NodeAnnotationZoneKey:         "kce1-zone",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName, Annotations: tt.annotations}}
+			r, c := newTestReconciler(t, node, server, time.Second, 0)
+			ctx := context.Background()
+
+			if err := r.EnsureNodeInstanceId(ctx, getNode(t, c)); err != nil {
+				t.Fatalf("EnsureNodeInstanceId: %v", err)
+			}
+			if err := r.EnsureNodeZone(ctx, getNode(t, c)); err != nil {
+				t.Fatalf("EnsureNodeZone: %v", err)
+			}
+
+			got := getNode(t, c)
+			if v := got.Annotations[KCE2NodeAnnotationInstanceUUIDKey]; v != tt.instanceId {
+				t.Errorf("instance id annotation = %q, want %q", v, tt.instanceId)
+			}
+			if v := got.Annotations[KCE2NodeAnnotationZoneKey]; v != tt.zone {
+				t.Errorf("zone annotation = %q, want %q", v, tt.zone)
+			}
+			if v := got.Labels[v1.LabelTopologyZone]; v != "cn-beijing-6a" {
+				t.Errorf("zone label = %q, want %q", v, "cn-beijing-6a")
+			}
+			for k, v := range tt.annotations {
+				if k != KCE2NodeAnnotationInstanceUUIDKey && k != KCE2NodeAnnotationZoneKey && got.Annotations[k] != v {
+					t.Errorf("annotation %s = %q, want %q", k, got.Annotations[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestEnsureNodeInstanceIdMetadataErrors(t *testing.T) {
+	ctx := context.Background()
+	newNode := func() *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName}}
+	}
+
+	t.Run("not found is not retried", func(t *testing.T) {
+		server := fakemetadata.NewServer(nil)
+		defer server.Close()
+		r, c := newTestReconciler(t, newNode(), server, time.Second, 3)
+		if err := r.EnsureNodeInstanceId(ctx, getNode(t, c)); err == nil {
+			t.Fatal("expected error for missing instance-id")
+		}
+		if n := server.Requests("instance-id"); n != 1 {
+			t.Errorf("requests = %d, want 1", n)
+		}
+		if _, ok := getNode(t, c).Annotations[KCE2NodeAnnotationInstanceUUIDKey]; ok {
+			t.Error("annotation set although metadata failed")
+		}
+	})
+
+	t.Run("server errors are retried", func(t *testing.T) {
+		server := fakemetadata.NewServer(map[string]string{"instance-id": "i-1"})
+		defer server.Close()
+		server.Fail("instance-id", http.StatusInternalServerError, 2)
+		r, c := newTestReconciler(t, newNode(), server, time.Second, 3)
+		if err := r.EnsureNodeInstanceId(ctx, getNode(t, c)); err != nil {
+			t.Fatalf("EnsureNodeInstanceId: %v", err)
+		}
+		if n := server.Requests("instance-id"); n != 3 {
+			t.Errorf("requests = %d, want 3", n)
+		}
+		if v := getNode(t, c).Annotations[KCE2NodeAnnotationInstanceUUIDKey]; v != "i-1" {
+			t.Errorf("instance id annotation = %q, want %q", v, "i-1")
+		}
+	})
+
+	t.Run("slow responses time out", func(t *testing.T) {
+		server := fakemetadata.NewServer(map[string]string{"placement/zone": "cn-beijing-6a"})
+		defer server.Close()
+		server.SetDelay(time.Second)
+		r, c := newTestReconciler(t, newNode(), server, 50*time.Millisecond, 1)
+		start := time.Now()
+		if err := r.EnsureNodeZone(ctx, getNode(t, c)); err == nil {
+			t.Fatal("expected timeout error")
+		}
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Errorf("EnsureNodeZone took %s, the timeout was not applied", d)
+		}
+		if n := server.Requests("placement/zone"); n != 2 {
+			t.Errorf("requests = %d, want 2", n)
+		}
+	})
+}
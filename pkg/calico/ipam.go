@@ -0,0 +1,99 @@
+// Package calico reads the IPAM resources of calico running with the kubernetes
+// datastore, to route the address blocks calico assigns to nodes by itself.
+package calico
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+)
+
+var (
+	// BlockAffinityGVK claims an IPAM block for a node
+	BlockAffinityGVK = schema.GroupVersionKind{Group: "crd.projectcalico.org", Version: "v1", Kind: "BlockAffinity"}
+	// IPAMBlockGVK is an address block and its allocations
+	IPAMBlockGVK = schema.GroupVersionKind{Group: "crd.projectcalico.org", Version: "v1", Kind: "IPAMBlock"}
+)
+
+const (
+	affinityStateConfirmed = "confirmed"
+	// hostAffinityPrefix prefixes the node in the affinity of an IPAMBlock
+	hostAffinityPrefix = "host:"
+)
+
+// Node returns the node a BlockAffinity or IPAMBlock is affine to, empty if none
+func Node(obj *unstructured.Unstructured) string {
+	switch obj.GroupVersionKind().Kind {
+	case BlockAffinityGVK.Kind:
+		node, _, _ := unstructured.NestedString(obj.Object, "spec", "node")
+		return node
+	case IPAMBlockGVK.Kind:
+		affinity, _, _ := unstructured.NestedString(obj.Object, "spec", "affinity")
+		if strings.HasPrefix(affinity, hostAffinityPrefix) {
+			return strings.TrimPrefix(affinity, hostAffinityPrefix)
+		}
+	}
+	return ""
+}
+
+// AffineBlocks returns the IPv4 blocks affine to node, sorted and without duplicates. A
+// block is affine once its BlockAffinity is confirmed, and stays affine while its
+// IPAMBlock names the node, so pods keep their route until calico releases the block.
+func AffineBlocks(node string, affinities, blocks []unstructured.Unstructured) ([]ip.IP4Net, error) {
+	seen := make(map[ip.IP4Net]bool)
+	var cidrs []ip.IP4Net
+	add := func(obj *unstructured.Unstructured) error {
+		s, _, _ := unstructured.NestedString(obj.Object, "spec", "cidr")
+		if strings.Contains(s, ":") {
+			// IPv6 blocks are not routed
+			return nil
+		}
+		cidr, err := ip.ParseIP4Net(s)
+		if err != nil {
+			return fmt.Errorf("invalid cidr %q of %s %s: %v", s, obj.GetKind(), obj.GetName(), err)
+		}
+		if !seen[cidr] {
+			seen[cidr] = true
+			cidrs = append(cidrs, cidr)
+		}
+		return nil
+	}
+
+	for i := range affinities {
+		a := &affinities[i]
+		state, _, _ := unstructured.NestedString(a.Object, "spec", "state")
+		if Node(a) != node || state != affinityStateConfirmed || deleted(a) {
+			continue
+		}
+		if err := add(a); err != nil {
+			return nil, err
+		}
+	}
+	for i := range blocks {
+		b := &blocks[i]
+		if Node(b) != node || deleted(b) {
+			continue
+		}
+		if err := add(b); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(cidrs, func(i, j int) bool {
+		if cidrs[i].IP != cidrs[j].IP {
+			return cidrs[i].IP < cidrs[j].IP
+		}
+		return cidrs[i].PrefixLen < cidrs[j].PrefixLen
+	})
+	return cidrs, nil
+}
+
+// deleted reports whether spec.deleted is set, a string on BlockAffinity and a bool on IPAMBlock
+func deleted(obj *unstructured.Unstructured) bool {
+	v, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "deleted")
+	return found && fmt.Sprint(v) == "true"
+}
@@ -0,0 +1,82 @@
+package calico
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func newObject(gvk schema.GroupVersionKind, name string, spec map[string]interface{}) unstructured.Unstructured {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(name)
+	return obj
+}
+
+func affinity(node, cidr, state string, deleted string) unstructured.Unstructured {
+	return newObject(BlockAffinityGVK, node+"-"+cidr, map[string]interface{}{
+		"node": node, "cidr": cidr, "state": state, "deleted": deleted,
+	})
+}
+
+func block(affinity, cidr string, deleted bool) unstructured.Unstructured {
+	return newObject(IPAMBlockGVK, cidr, map[string]interface{}{
+		"affinity": affinity, "cidr": cidr, "deleted": deleted,
+	})
+}
+
+func TestNode(t *testing.T) {
+	a := affinity("node-a", "10.0.0.0/26", affinityStateConfirmed, "false")
+	b := block("host:node-b", "10.0.0.64/26", false)
+	unaffine := block("", "10.0.0.128/26", false)
+	if got := Node(&a); got != "node-a" {
+		t.Errorf("Node(BlockAffinity) = %q, want node-a", got)
+	}
+	if got := Node(&b); got != "node-b" {
+		t.Errorf("Node(IPAMBlock) = %q, want node-b", got)
+	}
+	if got := Node(&unaffine); got != "" {
+		t.Errorf("Node(unaffine IPAMBlock) = %q, want empty", got)
+	}
+}
+
+func TestAffineBlocks(t *testing.T) {
+	affinities := []unstructured.Unstructured{
+		affinity("node-a", "10.0.0.64/26", affinityStateConfirmed, "false"),
+		affinity("node-a", "10.0.0.0/26", affinityStateConfirmed, "false"),
+		affinity("node-a", "10.0.1.0/26", "pending", "false"),
+		affinity("node-a", "10.0.2.0/26", affinityStateConfirmed, "true"),
+		affinity("node-b", "10.0.3.0/26", affinityStateConfirmed, "false"),
+		affinity("node-a", "fd00::/122", affinityStateConfirmed, "false"),
+	}
+	blocks := []unstructured.Unstructured{
+		block("host:node-a", "10.0.0.0/26", false),
+		// affinity pending deletion, the block still holds pods
+		block("host:node-a", "10.0.4.0/26", false),
+		block("host:node-a", "10.0.5.0/26", true),
+		block("host:node-b", "10.0.3.0/26", false),
+	}
+	cidrs, err := AffineBlocks("node-a", affinities, blocks)
+	if err != nil {
+		t.Fatalf("AffineBlocks() error = %v", err)
+	}
+	var got []string
+	for _, cidr := range cidrs {
+		got = append(got, cidr.String())
+	}
+	want := []string{"10.0.0.0/26", "10.0.0.64/26", "10.0.4.0/26"}
+	if len(got) != len(want) {
+		t.Fatalf("AffineBlocks() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("AffineBlocks() = %v, want %v", got, want)
+		}
+	}
+
+	invalid := []unstructured.Unstructured{affinity("node-a", "bad", affinityStateConfirmed, "false")}
+	if _, err := AffineBlocks("node-a", invalid, nil); err == nil {
+		t.Errorf("AffineBlocks() with invalid cidr, want error")
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+)
+
+const (
+	flagAnnotationResyncPeriod = "resync-period"
+	flagMetadataURL            = "metadata-url"
+	flagMetadataTimeout        = "metadata-timeout"
+	flagMetadataRetries        = "metadata-retries"
+	flagMetadataRetryInterval  = "metadata-retry-interval"
+	flagHostGWFallback         = "host-gw-fallback"
+	flagHostGWInterface        = "host-gw-iface"
+	flagOverlayFallback        = "overlay-fallback"
+	flagOverlayDevice          = "overlay-device"
+	flagOverlayPort            = "overlay-port"
+	flagPodNetworkProbe        = "pod-network-probe"
+	flagProbeInterval          = "probe-interval"
+	flagProbeTimeout           = "probe-timeout"
+	flagProbeSample            = "probe-sample"
+	flagProbeOffset            = "probe-offset"
+	flagDatapathCheck          = "datapath-check"
+	flagDatapathCheckInterval  = "datapath-check-interval"
+	flagDatapathMinMTU         = "datapath-min-mtu"
+	flagDatapathFixSysctls     = "datapath-fix-sysctls"
+
+	defaultAnnotationResyncPeriod   = 10 * time.Minute
+	defaultAnnotationMetricsAddress = ":10261"
+	defaultAnnotationHealthAddress  = ":10260"
+
+	defaultMetadataURL           = "http://11.255.255.100:8775/latest/meta-data/"
+	defaultMetadataTimeout       = 5 * time.Second
+	defaultMetadataRetries       = 3
+	defaultMetadataRetryInterval = 1 * time.Second
+
+	defaultOverlayDevice = "kce-tun0"
+	defaultOverlayPort   = 8285
+
+	defaultProbeInterval = 30 * time.Second
+	defaultProbeTimeout  = 1 * time.Second
+	defaultProbeOffset   = 0
+
+	defaultDatapathCheckInterval = 1 * time.Minute
+	defaultDatapathMinMTU        = 1280
+)
+
+var AnnotationCFG = &AnnotationConfig{}
+
+// AnnotationConfig stores the configuration of the node annotation agent
+type AnnotationConfig struct {
+	MetricsBindAddress     string
+	HealthProbeBindAddress string
+	// ResyncPeriod is how often the node is reconciled without any change
+	ResyncPeriod time.Duration
+	LogLevel     int
+	LogFormat    string
+
+	// MetadataURL is the base url of the instance metadata service
+	MetadataURL           string
+	MetadataTimeout       time.Duration
+	MetadataRetries       int
+	MetadataRetryInterval time.Duration
+
+	// HostGWFallback routes the pod CIDRs of peers in the same subnet via their node ip
+	// while their vpc routes are missing
+	HostGWFallback bool
+	// HostGWInterface is the interface of the host-gw routes, the one of the node InternalIP if empty
+	HostGWInterface string
+
+	// OverlayFallback tunnels the pod CIDRs of peers without vpc route and host-gw route over UDP
+	OverlayFallback bool
+	OverlayDevice   string
+	OverlayPort     int
+
+	// PodNetworkProbe pings a probe address in the pod CIDR of the peers and reports
+	// the result in the PodNetworkReachable node condition
+	PodNetworkProbe bool
+	ProbeInterval   time.Duration
+	ProbeTimeout    time.Duration
+	// ProbeSample is how many peers are probed per interval, all if 0
+	ProbeSample int
+	// ProbeOffset is the offset of the probe address in the pod CIDR of a peer without
+	// probe address annotation, such peers are not probed if 0
+	ProbeOffset int
+
+	// DatapathCheck checks ip forwarding, rp_filter and the primary interface and
+	// reports the result in the RouteDatapathReady node condition
+	DatapathCheck         bool
+	DatapathCheckInterval time.Duration
+	// DatapathMinMTU is the smallest accepted MTU of the primary interface
+	DatapathMinMTU int
+	// DatapathFixSysctls enables ip forwarding and relaxes strict rp_filter when the checks fail
+	DatapathFixSysctls bool
+}
+
+func (cfg *AnnotationConfig) BindFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&cfg.MetricsBindAddress, flagMetricsBindAddr, defaultAnnotationMetricsAddress,
+		"The address the metric endpoint binds to.")
+	fs.StringVar(&cfg.HealthProbeBindAddress, flagHealthProbeBindAddr, defaultAnnotationHealthAddress,
+		"The address the health probes binds to.")
+	fs.DurationVar(&cfg.ResyncPeriod, flagAnnotationResyncPeriod, defaultAnnotationResyncPeriod,
+		"The period for reconciling the node annotations without any change. The minimum value is 1 minute")
+	fs.StringVar(&cfg.LogFormat, flagLogFormat, "text", "The log format, one of 'text' or 'json'.")
+	fs.StringVar(&cfg.MetadataURL, flagMetadataURL, defaultMetadataURL, "The base url of the instance metadata service.")
+	fs.DurationVar(&cfg.MetadataTimeout, flagMetadataTimeout, defaultMetadataTimeout,
+		"The timeout of one request to the metadata service.")
+	fs.IntVar(&cfg.MetadataRetries, flagMetadataRetries, defaultMetadataRetries,
+		"How many times a failed or timed out metadata request is retried.")
+	fs.DurationVar(&cfg.MetadataRetryInterval, flagMetadataRetryInterval, defaultMetadataRetryInterval,
+		"The interval between retries of a metadata request.")
+	fs.BoolVar(&cfg.HostGWFallback, flagHostGWFallback, false,
+		"Add kernel routes to the pod CIDRs of nodes in the same subnet whose vpc routes are missing.")
+	fs.StringVar(&cfg.HostGWInterface, flagHostGWInterface, "",
+		"The interface of the host-gw fallback routes, the interface of the node InternalIP if empty.")
+	fs.BoolVar(&cfg.OverlayFallback, flagOverlayFallback, false,
+		"Tunnel the pod traffic to nodes whose vpc routes are missing and that have no host-gw route over UDP.")
+	fs.StringVar(&cfg.OverlayDevice, flagOverlayDevice, defaultOverlayDevice, "The name of the TUN device of the overlay fallback.")
+	fs.IntVar(&cfg.OverlayPort, flagOverlayPort, defaultOverlayPort, "The UDP port of the overlay fallback on all nodes.")
+	fs.BoolVar(&cfg.PodNetworkProbe, flagPodNetworkProbe, false,
+		"Ping the pod CIDRs of the other nodes and report the result in the PodNetworkReachable node condition.")
+	fs.DurationVar(&cfg.ProbeInterval, flagProbeInterval, defaultProbeInterval, "The interval between two pod network probes.")
+	fs.DurationVar(&cfg.ProbeTimeout, flagProbeTimeout, defaultProbeTimeout, "The timeout of one pod network echo request.")
+	fs.IntVar(&cfg.ProbeSample, flagProbeSample, 0,
+		"How many nodes are probed per interval, rotating through all nodes. All nodes are probed if 0.")
+	fs.IntVar(&cfg.ProbeOffset, flagProbeOffset, defaultProbeOffset,
+		"The offset of the probe address in the pod CIDR of a node without probe address annotation. Such nodes are not probed if 0.")
+	fs.BoolVar(&cfg.DatapathCheck, flagDatapathCheck, false,
+		"Check ip forwarding, rp_filter and the primary interface, and report the result in the RouteDatapathReady node condition.")
+	fs.DurationVar(&cfg.DatapathCheckInterval, flagDatapathCheckInterval, defaultDatapathCheckInterval,
+		"The interval between two datapath checks.")
+	fs.IntVar(&cfg.DatapathMinMTU, flagDatapathMinMTU, defaultDatapathMinMTU, "The smallest accepted MTU of the primary interface.")
+	fs.BoolVar(&cfg.DatapathFixSysctls, flagDatapathFixSysctls, false,
+		"Set net.ipv4.ip_forward to 1 and relax strict rp_filter to loose when the datapath checks fail.")
+}
+
+// Validate the annotation agent configuration
+func (cfg *AnnotationConfig) Validate() error {
+	if cfg.ResyncPeriod < 1*time.Minute {
+		cfg.ResyncPeriod = 1 * time.Minute
+	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return fmt.Errorf("invalid %s %q, must be 'text' or 'json'", flagLogFormat, cfg.LogFormat)
+	}
+	if _, err := url.Parse(cfg.MetadataURL); err != nil || cfg.MetadataURL == "" {
+		return fmt.Errorf("invalid %s %q", flagMetadataURL, cfg.MetadataURL)
+	}
+	if cfg.MetadataTimeout <= 0 {
+		return fmt.Errorf("invalid %s %v, must be positive", flagMetadataTimeout, cfg.MetadataTimeout)
+	}
+	if cfg.MetadataRetries < 0 {
+		return fmt.Errorf("invalid %s %d, must not be negative", flagMetadataRetries, cfg.MetadataRetries)
+	}
+	if cfg.OverlayFallback {
+		if cfg.OverlayPort <= 0 || cfg.OverlayPort > 65535 {
+			return fmt.Errorf("invalid %s %d", flagOverlayPort, cfg.OverlayPort)
+		}
+		if cfg.OverlayDevice == "" || len(cfg.OverlayDevice) > 15 {
+			return fmt.Errorf("invalid %s %q, must be 1 to 15 characters", flagOverlayDevice, cfg.OverlayDevice)
+		}
+	}
+	if cfg.PodNetworkProbe {
+		if cfg.ProbeInterval <= 0 {
+			return fmt.Errorf("invalid %s %v, must be positive", flagProbeInterval, cfg.ProbeInterval)
+		}
+		if cfg.ProbeTimeout <= 0 {
+			return fmt.Errorf("invalid %s %v, must be positive", flagProbeTimeout, cfg.ProbeTimeout)
+		}
+		if cfg.ProbeSample < 0 {
+			return fmt.Errorf("invalid %s %d, must not be negative", flagProbeSample, cfg.ProbeSample)
+		}
+		if cfg.ProbeOffset < 0 {
+			return fmt.Errorf("invalid %s %d, must not be negative", flagProbeOffset, cfg.ProbeOffset)
+		}
+	}
+	if cfg.DatapathCheck {
+		if cfg.DatapathCheckInterval <= 0 {
+			return fmt.Errorf("invalid %s %v, must be positive", flagDatapathCheckInterval, cfg.DatapathCheckInterval)
+		}
+		if cfg.DatapathMinMTU < 0 {
+			return fmt.Errorf("invalid %s %d, must not be negative", flagDatapathMinMTU, cfg.DatapathMinMTU)
+		}
+	}
+	return nil
+}
+
+func (cfg *AnnotationConfig) LoadAnnotationConfig() error {
+	fs := pflag.NewFlagSet("", pflag.ExitOnError)
+	klogFlags := flag.NewFlagSet("klog", flag.ExitOnError)
+	klog.InitFlags(klogFlags)
+	fs.AddGoFlagSet(flag.CommandLine)
+	fs.AddGoFlagSet(klogFlags)
+	cfg.BindFlags(fs)
+
+	if err := fs.Parse(os.Args); err != nil {
+		return err
+	}
+	if v := klogFlags.Lookup("v"); v != nil {
+		cfg.LogLevel, _ = strconv.Atoi(v.Value.String())
+	}
+
+	return cfg.Validate()
+}
@@ -2,16 +2,62 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/cloud-provider/config"
+	"k8s.io/klog/v2"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	flagControllers                  = "controllers"
 	flagRouteReconciliationPeriod    = "route-reconciliation-period"
+	flagLogFormat                    = "log-format"
+	flagInstanceIdResolvers          = "instance-id-resolvers"
+	flagControllerMetadataURL        = "metadata-url"
+	flagNodeSelector                 = "node-selector"
+	flagNodePolicyFile               = "node-policy-file"
+	flagAggregateRoutes              = "aggregate-routes"
+	flagRouteQuota                   = "route-quota"
+	flagPodCIDRSource                = "pod-cidr-source"
+	flagSecondaryNetworkRoutes       = "secondary-network-routes"
+	flagIPMasqConfigMap              = "ipmasq-configmap"
+	flagIPMasqExtraCIDRs             = "ipmasq-extra-cidrs"
+	flagAllocateNodeCIDRs            = "allocate-node-cidrs"
+	flagClusterCIDR                  = "cluster-cidr"
+	flagNodeCIDRMaskSize             = "node-cidr-mask-size"
+	flagConfigureCloudRoutes         = "configure-cloud-routes"
 	defaultRouteReconciliationPeriod = 5 * time.Minute
+	defaultIPMasqConfigMap           = "kube-system/ip-masq-agent-config"
+	defaultNodeCIDRMaskSize          = 24
+)
+
+// Instance id resolvers, tried in the configured order
+const (
+	InstanceIdResolverAnnotation        = "annotation"
+	InstanceIdResolverProviderID        = "providerID"
+	InstanceIdResolverDescribeInstances = "describeInstances"
+	InstanceIdResolverMetadata          = "metadata"
+)
+
+var defaultInstanceIdResolvers = []string{
+	InstanceIdResolverAnnotation,
+	InstanceIdResolverProviderID,
+	InstanceIdResolverDescribeInstances,
+	InstanceIdResolverMetadata,
+}
+
+// Pod CIDR sources, where the CIDRs routed to a node come from
+const (
+	// PodCIDRSourceNode uses the pod CIDRs of the node spec
+	PodCIDRSourceNode = "node"
+	// PodCIDRSourceCalicoIPAM uses the IPAM blocks calico assigned to the node
+	PodCIDRSourceCalicoIPAM = "calico-ipam"
 )
 
 var ControllerCFG = &ControllerConfig{}
@@ -21,15 +67,75 @@ type ControllerConfig struct {
 	config.KubeCloudSharedConfiguration
 	Controllers []string
 	LogLevel    int
+	LogFormat   string
+
+	// InstanceIdResolvers are the ordered sources of the instance id of a node
+	InstanceIdResolvers []string
+	// MetadataURL is the metadata service used by the metadata resolver
+	MetadataURL string
+
+	// NodeSelector selects the nodes routes are created for
+	NodeSelector string
+	// NodePolicyFile holds include and exclude policies evaluated before the node selector
+	NodePolicyFile string
+	NodePolicies   []NodePolicy
+
+	// AggregateRoutes creates one route per summarized pod CIDR of a node instead of
+	// one route for its first pod CIDR
+	AggregateRoutes bool
+	// RouteQuota is the number of routes the vpc route table allows, 0 if unknown
+	RouteQuota int
+	// PodCIDRSource is where the CIDRs routed to a node come from
+	PodCIDRSource string
+	// SecondaryNetworkRoutes routes the ranges of the multus networks that opt into vpc routing
+	SecondaryNetworkRoutes bool
+	// IPMasqConfigMap is the namespace/name of the ip-masq-agent ConfigMap kept by the ipmasq controller
+	IPMasqConfigMap string
+	// IPMasqExtraCIDRs are not masqueraded in addition to the vpc and pod CIDRs
+	IPMasqExtraCIDRs []string
+	// NodeCIDRMaskSize is the prefix length of the pod CIDRs the cidr-allocator controller
+	// carves out of ClusterCIDR
+	NodeCIDRMaskSize int
 
 	RuntimeConfig RuntimeConfig
+	TracingConfig TracingConfig
 }
 
 func (cfg *ControllerConfig) BindFlags(fs *pflag.FlagSet) {
 	fs.StringSliceVar(&cfg.Controllers, flagControllers, []string{"route"}, "A list of controllers to enable.")
 	fs.DurationVar(&cfg.RouteReconciliationPeriod.Duration, flagRouteReconciliationPeriod, defaultRouteReconciliationPeriod,
 		"The period for reconciling routes created for nodes by cloud provider. The minimum value is 1 minute")
+	fs.StringVar(&cfg.LogFormat, flagLogFormat, "text", "The log format, one of 'text' or 'json'.")
+	fs.StringSliceVar(&cfg.InstanceIdResolvers, flagInstanceIdResolvers, defaultInstanceIdResolvers,
+		"The ordered sources of the instance id of a node, any of 'annotation', 'providerID', 'describeInstances' and 'metadata'.")
+	fs.StringVar(&cfg.MetadataURL, flagControllerMetadataURL, defaultMetadataURL,
+		"The base url of the instance metadata service used by the metadata instance id resolver.")
+	fs.StringVar(&cfg.NodeSelector, flagNodeSelector, "",
+		"The label selector of the nodes routes are created for, e.g. 'pool in (a,b),!gpu'. All nodes are selected if empty.")
+	fs.StringVar(&cfg.NodePolicyFile, flagNodePolicyFile, "",
+		"The yaml file of include and exclude node policies, evaluated in order before the node selector.")
+	fs.BoolVar(&cfg.AggregateRoutes, flagAggregateRoutes, false,
+		"Create routes for all IPv4 pod CIDRs of a node, merging contiguous CIDRs into the smallest set of routes.")
+	fs.IntVar(&cfg.RouteQuota, flagRouteQuota, 0,
+		"The number of routes the vpc route table allows. If 0, the quota is learned when creating a route fails because the route table is full.")
+	fs.StringVar(&cfg.PodCIDRSource, flagPodCIDRSource, PodCIDRSourceNode,
+		"Where the CIDRs routed to a node come from, 'node' for the pod CIDRs of the node spec or 'calico-ipam' for the IPAM blocks affine to the node.")
+	fs.BoolVar(&cfg.SecondaryNetworkRoutes, flagSecondaryNetworkRoutes, false,
+		"Create routes for the per node ranges of the multus NetworkAttachmentDefinitions annotated with kce.sdns.ksyun.com/vpc-route=true.")
+	fs.StringVar(&cfg.IPMasqConfigMap, flagIPMasqConfigMap, defaultIPMasqConfigMap,
+		"The namespace/name of the ip-masq-agent ConfigMap whose NonMasqueradeCIDRs the ipmasq controller keeps in sync.")
+	fs.StringSliceVar(&cfg.IPMasqExtraCIDRs, flagIPMasqExtraCIDRs, nil,
+		"The CIDRs the ipmasq controller adds to NonMasqueradeCIDRs besides the vpc CIDRs and the pod CIDRs of the nodes.")
+	fs.BoolVar(&cfg.AllocateNodeCIDRs, flagAllocateNodeCIDRs, false,
+		"Allocate the pod CIDRs of nodes from --cluster-cidr in the cidr-allocator controller, avoiding the vpc CIDRs and existing vpc routes.")
+	fs.StringVar(&cfg.ClusterCIDR, flagClusterCIDR, "",
+		"The IPv4 CIDR of the pods. If set, pod CIDRs of nodes are allocated from it, routes are only created for node CIDRs inside it and only routes inside it are deleted as conflicts.")
+	fs.IntVar(&cfg.NodeCIDRMaskSize, flagNodeCIDRMaskSize, defaultNodeCIDRMaskSize,
+		"The prefix length of the pod CIDRs allocated to nodes.")
+	fs.BoolVar(&cfg.ConfigureCloudRoutes, flagConfigureCloudRoutes, true,
+		"Create and delete the vpc routes of nodes. If false, the route controller only reports the routes it would change.")
 	cfg.RuntimeConfig.BindFlags(fs)
+	cfg.TracingConfig.BindFlags(fs)
 }
 
 // Validate the controller configuration
@@ -37,17 +143,74 @@ func (cfg *ControllerConfig) Validate() error {
 	if cfg.RouteReconciliationPeriod.Duration < 1*time.Minute {
 		cfg.RouteReconciliationPeriod.Duration = 1 * time.Minute
 	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return fmt.Errorf("invalid %s %q, must be 'text' or 'json'", flagLogFormat, cfg.LogFormat)
+	}
+	if len(cfg.InstanceIdResolvers) == 0 {
+		return fmt.Errorf("%s must not be empty", flagInstanceIdResolvers)
+	}
+	for _, name := range cfg.InstanceIdResolvers {
+		switch name {
+		case InstanceIdResolverAnnotation, InstanceIdResolverProviderID,
+			InstanceIdResolverDescribeInstances, InstanceIdResolverMetadata:
+		default:
+			return fmt.Errorf("unknown %s %q", flagInstanceIdResolvers, name)
+		}
+	}
+	if cfg.RouteQuota < 0 {
+		return fmt.Errorf("invalid %s %d, must not be negative", flagRouteQuota, cfg.RouteQuota)
+	}
+	if cfg.PodCIDRSource != PodCIDRSourceNode && cfg.PodCIDRSource != PodCIDRSourceCalicoIPAM {
+		return fmt.Errorf("unknown %s %q", flagPodCIDRSource, cfg.PodCIDRSource)
+	}
+	if parts := strings.Split(cfg.IPMasqConfigMap, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid %s %q, must be namespace/name", flagIPMasqConfigMap, cfg.IPMasqConfigMap)
+	}
+	for _, cidr := range cfg.IPMasqExtraCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid %s %q: %v", flagIPMasqExtraCIDRs, cidr, err)
+		}
+	}
+	if cfg.ClusterCIDR != "" {
+		addr, cidr, err := net.ParseCIDR(cfg.ClusterCIDR)
+		if err != nil || addr.To4() == nil {
+			return fmt.Errorf("invalid %s %q, must be an IPv4 CIDR", flagClusterCIDR, cfg.ClusterCIDR)
+		}
+		if ones, _ := cidr.Mask.Size(); cfg.NodeCIDRMaskSize < ones || cfg.NodeCIDRMaskSize > 32 {
+			return fmt.Errorf("invalid %s %d, must be between %d and 32", flagNodeCIDRMaskSize, cfg.NodeCIDRMaskSize, ones)
+		}
+	}
+	if cfg.AllocateNodeCIDRs && cfg.ClusterCIDR == "" {
+		return fmt.Errorf("%s requires %s", flagAllocateNodeCIDRs, flagClusterCIDR)
+	}
+	if _, err := labels.Parse(cfg.NodeSelector); err != nil {
+		return fmt.Errorf("invalid %s %q: %v", flagNodeSelector, cfg.NodeSelector, err)
+	}
+	policies, err := LoadNodePolicies(cfg.NodePolicyFile)
+	if err != nil {
+		return err
+	}
+	cfg.NodePolicies = policies
+	if cfg.TracingConfig.SamplingRatio < 0 || cfg.TracingConfig.SamplingRatio > 1 {
+		return fmt.Errorf("invalid %s %v, must be between 0 and 1", flagTracingSamplingRatio, cfg.TracingConfig.SamplingRatio)
+	}
 	return nil
 }
 
 func (cfg *ControllerConfig) LoadControllerConfig() error {
 	fs := pflag.NewFlagSet("", pflag.ExitOnError)
+	klogFlags := flag.NewFlagSet("klog", flag.ExitOnError)
+	klog.InitFlags(klogFlags)
 	fs.AddGoFlagSet(flag.CommandLine)
+	fs.AddGoFlagSet(klogFlags)
 	cfg.BindFlags(fs)
 
 	if err := fs.Parse(os.Args); err != nil {
 		return err
 	}
+	if v := klogFlags.Lookup("v"); v != nil {
+		cfg.LogLevel, _ = strconv.Atoi(v.Value.String())
+	}
 
 	if err := cfg.Validate(); err != nil {
 		return err
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	NodePolicyInclude = "include"
+	NodePolicyExclude = "exclude"
+)
+
+// NodePolicy includes or excludes the nodes matching a label selector from route
+// creation. The first matching policy wins.
+type NodePolicy struct {
+	Name     string `json:"name"`
+	Selector string `json:"selector"`
+	Action   string `json:"action"`
+}
+
+// NodePolicies is the content of the node policy file
+type NodePolicies struct {
+	Policies []NodePolicy `json:"policies"`
+}
+
+// LoadNodePolicies reads the yaml or json node policy file at path
+func LoadNodePolicies(path string) ([]NodePolicy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read node policy file %s error: %v", path, err)
+	}
+	var p NodePolicies
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("parse node policy file %s error: %v", path, err)
+	}
+	for i, policy := range p.Policies {
+		if policy.Action != NodePolicyInclude && policy.Action != NodePolicyExclude {
+			return nil, fmt.Errorf("node policy %d %q: invalid action %q, must be %q or %q",
+				i, policy.Name, policy.Action, NodePolicyInclude, NodePolicyExclude)
+		}
+		if _, err := labels.Parse(policy.Selector); err != nil {
+			return nil, fmt.Errorf("node policy %d %q: invalid selector %q: %v", i, policy.Name, policy.Selector, err)
+		}
+	}
+	return p.Policies, nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"github.com/spf13/pflag"
+)
+
+const (
+	flagTracingEndpoint      = "tracing-endpoint"
+	flagTracingInsecure      = "tracing-insecure"
+	flagTracingSamplingRatio = "tracing-sampling-ratio"
+	flagTracingServiceName   = "tracing-service-name"
+
+	defaultTracingSamplingRatio = 1.0
+	defaultTracingServiceName   = "vpc-route-controller"
+)
+
+// TracingConfig stores the configuration for OpenTelemetry tracing
+type TracingConfig struct {
+	// Endpoint is the host:port of the OTLP gRPC collector, tracing is disabled when empty
+	Endpoint      string
+	Insecure      bool
+	SamplingRatio float64
+	ServiceName   string
+}
+
+func (c *TracingConfig) BindFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.Endpoint, flagTracingEndpoint, "",
+		"The OTLP gRPC collector endpoint (host:port) spans are exported to. Tracing is disabled if empty.")
+	fs.BoolVar(&c.Insecure, flagTracingInsecure, false, "Disable TLS when connecting to the OTLP collector.")
+	fs.Float64Var(&c.SamplingRatio, flagTracingSamplingRatio, defaultTracingSamplingRatio,
+		"The fraction of root spans to sample, between 0 and 1.")
+	fs.StringVar(&c.ServiceName, flagTracingServiceName, defaultTracingServiceName,
+		"The service name reported with every span.")
+}
@@ -0,0 +1,214 @@
+package cidrallocator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	ctrlCfg "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/nodeipam"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+)
+
+// retryPeriod is the wait before allocating again for a node no CIDR could be allocated to
+const retryPeriod = time.Minute
+
+// Add creates the cidr-allocator controller, which sets the pod CIDRs of nodes
+// without one to a free range of the cluster CIDR
+func Add(mgr manager.Manager) error {
+	cfg := ctrlCfg.ControllerCFG
+	if !cfg.AllocateNodeCIDRs {
+		klog.InfoS("Node cidr allocation is disabled, cidr-allocator controller is not started", "flag", "--allocate-node-cidrs")
+		return nil
+	}
+	// validated when loading the config, the allocator is created on every allocation
+	if _, err := nodeipam.NewAllocator(cfg.ClusterCIDR, cfg.NodeCIDRMaskSize); err != nil {
+		return err
+	}
+	r := &ReconcileCIDRAllocator{
+		client:      mgr.GetClient(),
+		record:      mgr.GetEventRecorderFor("cidr-allocator"),
+		clusterCIDR: cfg.ClusterCIDR,
+		maskSize:    cfg.NodeCIDRMaskSize,
+		pending:     make(map[string]ip.IP4Net),
+	}
+
+	recoverPanic := true
+	c, err := controller.New("cidr-allocator", mgr, controller.Options{
+		Reconciler:              r,
+		MaxConcurrentReconciles: 1,
+		RecoverPanic:            &recoverPanic,
+	})
+	if err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &corev1.Node{}}, &handler.EnqueueRequestForObject{}, predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			node, ok := e.ObjectNew.(*corev1.Node)
+			return ok && !hasPodCIDR(node)
+		},
+	})
+}
+
+// ReconcileCIDRAllocator implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileCIDRAllocator{}
+
+// ReconcileCIDRAllocator allocates the pod CIDRs of nodes
+type ReconcileCIDRAllocator struct {
+	client client.Client
+	record record.EventRecorder
+
+	clusterCIDR string
+	maskSize    int
+
+	// pending are the CIDRs allocated to nodes whose update is not yet in the cache
+	pending map[string]ip.IP4Net
+}
+
+func (r *ReconcileCIDRAllocator) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	node := &corev1.Node{}
+	if err := r.client.Get(ctx, request.NamespacedName, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			delete(r.pending, request.Name)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if hasPodCIDR(node) {
+		delete(r.pending, node.Name)
+		return reconcile.Result{}, nil
+	}
+
+	cidr, ok := r.pending[node.Name]
+	if !ok {
+		var err error
+		if cidr, err = r.allocate(ctx, node.Name); err != nil {
+			klog.ErrorS(err, "Failed to allocate pod cidr", "node", node.Name)
+			r.record.Event(nodeRef(node), corev1.EventTypeWarning, helper.CIDRNotAvailable, err.Error())
+			return reconcile.Result{RequeueAfter: retryPeriod}, nil
+		}
+		r.pending[node.Name] = cidr
+	}
+	if err := r.setPodCIDR(node, cidr); err != nil {
+		r.record.Event(nodeRef(node), corev1.EventTypeWarning, helper.CIDRAssignmentFailed, err.Error())
+		return reconcile.Result{}, err
+	}
+	klog.InfoS("Allocated pod cidr", "node", node.Name, "cidr", cidr.String())
+	return reconcile.Result{}, nil
+}
+
+// allocate returns a CIDR of the cluster CIDR used by no other node, outside the
+// vpc CIDRs and overlapping no route of the vpc route table
+func (r *ReconcileCIDRAllocator) allocate(ctx context.Context, nodeName string) (ip.IP4Net, error) {
+	allocator, err := nodeipam.NewAllocator(r.clusterCIDR, r.maskSize)
+	if err != nil {
+		return ip.IP4Net{}, err
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := r.client.List(ctx, nodes); err != nil {
+		return ip.IP4Net{}, fmt.Errorf("list nodes: %v", err)
+	}
+	for i := range nodes.Items {
+		for _, n := range podCIDRs(&nodes.Items[i]) {
+			allocator.Occupy(n)
+		}
+	}
+	for name, n := range r.pending {
+		if name != nodeName {
+			allocator.Occupy(n)
+		}
+	}
+
+	vpcCIDRs, err := ksyun.VpcCIDRs(ctx)
+	if err != nil {
+		return ip.IP4Net{}, fmt.Errorf("describe vpc cidrs: %v", err)
+	}
+	// every route of the table is reserved, not only the host routes of nodes
+	routes, err := ksyun.ListRouteTable(ctx)
+	if err != nil {
+		return ip.IP4Net{}, fmt.Errorf("list route table: %v", err)
+	}
+	reserved := vpcCIDRs
+	for _, route := range routes {
+		if route.DestinationCIDR == "0.0.0.0/0" {
+			// the default route overlaps everything and reserves nothing
+			continue
+		}
+		reserved = append(reserved, route.DestinationCIDR)
+	}
+	for _, s := range reserved {
+		n, err := ip.ParseIP4Net(s)
+		if err != nil {
+			// IPv6 ranges can not overlap the cluster cidr
+			continue
+		}
+		allocator.Occupy(n)
+	}
+
+	cidr, err := allocator.Next()
+	if err != nil {
+		return ip.IP4Net{}, fmt.Errorf("allocate pod cidr from %s: %v", r.clusterCIDR, err)
+	}
+	return cidr, nil
+}
+
+// setPodCIDR sets the pod CIDRs of the node spec, which are immutable once set
+func (r *ReconcileCIDRAllocator) setPodCIDR(node *corev1.Node, cidr ip.IP4Net) error {
+	getter := func(obj runtime.Object) (client.Object, error) {
+		n, ok := obj.(*corev1.Node)
+		if !ok {
+			return nil, fmt.Errorf("expect node, got %T", obj)
+		}
+		n.Spec.PodCIDR = cidr.String()
+		n.Spec.PodCIDRs = []string{cidr.String()}
+		return n, nil
+	}
+	if err := helper.PatchM(r.client, node.DeepCopy(), getter, helper.PatchSpec); err != nil {
+		return fmt.Errorf("set pod cidr %s: %v", cidr, err)
+	}
+	return nil
+}
+
+func hasPodCIDR(node *corev1.Node) bool {
+	return node.Spec.PodCIDR != "" || len(node.Spec.PodCIDRs) != 0
+}
+
+// podCIDRs returns the IPv4 pod CIDRs of the node
+func podCIDRs(node *corev1.Node) []ip.IP4Net {
+	var cidrs []ip.IP4Net
+	for _, s := range append(node.Spec.PodCIDRs, node.Spec.PodCIDR) {
+		addr, n, err := net.ParseCIDR(s)
+		if err != nil || addr.To4() == nil {
+			continue
+		}
+		cidrs = append(cidrs, ip.FromIPNet(n))
+	}
+	return cidrs
+}
+
+func nodeRef(node *corev1.Node) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind: "Node",
+		Name: node.Name,
+		UID:  types.UID(node.Name),
+	}
+}
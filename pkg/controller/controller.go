@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/cidrallocator"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/ipmasq"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/route"
 	"fmt"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -8,7 +10,9 @@ import (
 
 func init() {
 	controllerMap = map[string]func(manager.Manager) error{
-		"route": route.Add,
+		"route":          route.Add,
+		"ipmasq":         ipmasq.Add,
+		"cidr-allocator": cidrallocator.Add,
 	}
 }
 
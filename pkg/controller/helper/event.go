@@ -7,6 +7,25 @@ const (
 	FailedCreateRoute  = "CreateRouteFailed"
 	FailedSyncRoute    = "SyncRouteFailed"
 	SucceedCreateRoute = "CreatedRoute"
+	InvalidProviderID  = "InvalidProviderID"
+	RouteGatewayDrift  = "RouteGatewayDrift"
+
+	RouteTransition       = "RouteTransition"
+	RouteTransitionFailed = "RouteTransitionFailed"
+
+	RouteQuotaExceeded = "RouteQuotaExceeded"
+
+	RouteOutsideClusterCIDR = "RouteOutsideClusterCIDR"
+
+	RouteDatapathBroken    = "RouteDatapathBroken"
+	RouteDatapathRecovered = "RouteDatapathRecovered"
+
+	SucceedSyncIPMasq = "SyncedIPMasqConfig"
+	FailedSyncIPMasq  = "SyncIPMasqConfigFailed"
+
+	// same reasons as the node ipam controller of kube-controller-manager
+	CIDRNotAvailable     = "CIDRNotAvailable"
+	CIDRAssignmentFailed = "CIDRAssignmentFailed"
 )
 
 var re = regexp.MustCompile(".*(Message:.*)")
@@ -0,0 +1,99 @@
+package helper
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
+)
+
+const (
+	// LabelNodeType is the label virtual-kubelet and serverless nodes are marked with
+	LabelNodeType           = "type"
+	LabelNodeTypeServerless = "serverless"
+	// TaintVirtualKubelet is the taint key set by virtual-kubelet providers
+	TaintVirtualKubelet = "virtual-kubelet.io/provider"
+
+	// AnnotationRoutePaused pauses route creation for a single node when set to "true"
+	AnnotationRoutePaused = "kce.sdns.ksyun.com/route-paused"
+)
+
+// Reasons a node is skipped by the NodeFilter
+const (
+	SkipReasonExcludeLabel     = "ExcludeLabel"
+	SkipReasonVirtualKubelet   = "VirtualKubelet"
+	SkipReasonServerless       = "Serverless"
+	SkipReasonRoutePaused      = "RoutePaused"
+	SkipReasonExcludedByPolicy = "ExcludedByPolicy"
+	SkipReasonNotSelected      = "NotSelected"
+)
+
+type nodePolicy struct {
+	name     string
+	selector labels.Selector
+	include  bool
+}
+
+// NodeFilter decides which nodes get routes
+type NodeFilter struct {
+	selector labels.Selector
+	policies []nodePolicy
+}
+
+// NewNodeFilter builds a NodeFilter from the node selector and the ordered include
+// and exclude policies. An empty selector selects all nodes.
+func NewNodeFilter(selector string, policies []config.NodePolicy) (*NodeFilter, error) {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("parse node selector %q: %v", selector, err)
+	}
+	f := &NodeFilter{selector: s}
+	for _, p := range policies {
+		ps, err := labels.Parse(p.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("parse selector %q of node policy %q: %v", p.Selector, p.Name, err)
+		}
+		f.policies = append(f.policies, nodePolicy{name: p.Name, selector: ps, include: p.Action == config.NodePolicyInclude})
+	}
+	return f, nil
+}
+
+// Skip returns the reason and a message if no route should be created for node.
+// The exclude labels, virtual nodes and the pause annotation are checked first, then
+// the first policy matching the node, and the node selector last.
+func (f *NodeFilter) Skip(node *v1.Node) (reason, message string, skip bool) {
+	if HasExcludeLabel(node) {
+		return SkipReasonExcludeLabel, "Node has the exclude-node label", true
+	}
+	switch node.Labels[LabelNodeType] {
+	case LabelNodeTypeVK:
+		return SkipReasonVirtualKubelet, "Node is a virtual-kubelet node", true
+	case LabelNodeTypeServerless:
+		return SkipReasonServerless, "Node is a serverless node", true
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == TaintVirtualKubelet {
+			return SkipReasonVirtualKubelet, fmt.Sprintf("Node has the %s taint", TaintVirtualKubelet), true
+		}
+	}
+	if node.Annotations[AnnotationRoutePaused] == "true" {
+		return SkipReasonRoutePaused, fmt.Sprintf("Route creation is paused by the %s annotation", AnnotationRoutePaused), true
+	}
+
+	set := labels.Set(node.Labels)
+	for _, p := range f.policies {
+		if !p.selector.Matches(set) {
+			continue
+		}
+		if p.include {
+			return "", "", false
+		}
+		return SkipReasonExcludedByPolicy, fmt.Sprintf("Node is excluded by node policy %q", p.name), true
+	}
+	if !f.selector.Matches(set) {
+		return SkipReasonNotSelected, fmt.Sprintf("Node does not match the node selector %q", f.selector.String()), true
+	}
+	return "", "", false
+}
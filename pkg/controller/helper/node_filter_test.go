@@ -0,0 +1,72 @@
+package helper
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
+)
+
+func TestNodeFilterSkip(t *testing.T) {
+	filter, err := NewNodeFilter("pool in (a,b)", []config.NodePolicy{
+		{Name: "gpu", Selector: "gpu=true", Action: config.NodePolicyExclude},
+		{Name: "edge", Selector: "edge", Action: config.NodePolicyInclude},
+	})
+	if err != nil {
+		t.Fatalf("NewNodeFilter: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		taints      []v1.Taint
+		reason      string
+	}{
+		{name: "selected", labels: map[string]string{"pool": "a"}},
+		{name: "not selected", labels: map[string]string{"pool": "c"}, reason: SkipReasonNotSelected},
+		{name: "exclude label", labels: map[string]string{"pool": "a", LabelNodeExcludeNode: ""}, reason: SkipReasonExcludeLabel},
+		{name: "virtual-kubelet label", labels: map[string]string{"pool": "a", LabelNodeType: LabelNodeTypeVK}, reason: SkipReasonVirtualKubelet},
+		{name: "serverless label", labels: map[string]string{"pool": "a", LabelNodeType: LabelNodeTypeServerless}, reason: SkipReasonServerless},
+		{
+			name:   "virtual-kubelet taint",
+			labels: map[string]string{"pool": "a"},
+			taints: []v1.Taint{{Key: TaintVirtualKubelet, Value: "kci", Effect: v1.TaintEffectNoSchedule}},
+			reason: SkipReasonVirtualKubelet,
+		},
+		{
+			name:        "paused",
+			labels:      map[string]string{"pool": "a"},
+			annotations: map[string]string{AnnotationRoutePaused: "true"},
+			reason:      SkipReasonRoutePaused,
+		},
+		{
+			name:        "pause annotation not true",
+			labels:      map[string]string{"pool": "a"},
+			annotations: map[string]string{AnnotationRoutePaused: "false"},
+		},
+		{name: "excluded by policy", labels: map[string]string{"pool": "a", "gpu": "true"}, reason: SkipReasonExcludedByPolicy},
+		{name: "included by policy outside selector", labels: map[string]string{"edge": ""}},
+		{name: "first matching policy wins", labels: map[string]string{"edge": "", "gpu": "true"}, reason: SkipReasonExcludedByPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node", Labels: tt.labels, Annotations: tt.annotations},
+				Spec:       v1.NodeSpec{Taints: tt.taints},
+			}
+			reason, _, skip := filter.Skip(node)
+			if skip != (tt.reason != "") || reason != tt.reason {
+				t.Errorf("Skip() = %q, %v, want %q", reason, skip, tt.reason)
+			}
+		})
+	}
+}
+
+func TestNewNodeFilterInvalidSelector(t *testing.T) {
+	if _, err := NewNodeFilter("pool in (a", nil); err == nil {
+		t.Error("expected error for invalid node selector")
+	}
+}
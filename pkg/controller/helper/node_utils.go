@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
@@ -59,7 +60,7 @@ func PatchM(mclient client.Client, target client.Object, getter func(runtime.Obj
 		return nil
 	}
 
-	klog.Infof("try to patch %s/%s, %s ", target.GetNamespace(), target.GetName(), string(patchBytes))
+	klog.InfoS("Patching object", "namespace", target.GetNamespace(), "name", target.GetName(), "patch", string(patchBytes))
 	if resource == PatchSpec || resource == PatchAll {
 		err := mclient.Patch(
 			context.TODO(), ntarget,
@@ -96,6 +97,32 @@ func FindCondition(conds []v1.NodeCondition, conditionType v1.NodeConditionType)
 	}
 }
 
+// SetNodeCondition patches the condition conditionType of node, adding it if missing.
+// LastTransitionTime only moves when the status changes.
+func SetNodeCondition(mclient client.Client, node *v1.Node, conditionType v1.NodeConditionType,
+	status v1.ConditionStatus, reason, message string) error {
+	getter := func(obj runtime.Object) (client.Object, error) {
+		n, ok := obj.(*v1.Node)
+		if !ok {
+			return nil, fmt.Errorf("expect node, got %T", obj)
+		}
+		cond, found := FindCondition(n.Status.Conditions, conditionType)
+		cond.Type = conditionType
+		if cond.Status != status {
+			cond.LastTransitionTime = metav1.Now()
+		}
+		cond.LastHeartbeatTime = metav1.Now()
+		cond.Status = status
+		cond.Reason = reason
+		cond.Message = message
+		if !found {
+			n.Status.Conditions = append(n.Status.Conditions, *cond)
+		}
+		return n, nil
+	}
+	return PatchM(mclient, node.DeepCopy(), getter, PatchStatus)
+}
+
 // GetNodeCondition will get pointer to Node's existing condition.
 // returns nil if no matching condition found.
 func GetNodeCondition(node *v1.Node, conditionType v1.NodeConditionType) *v1.NodeCondition {
@@ -123,6 +150,6 @@ func FindNodeByNodeName(nodes []v1.Node, nodeName string) *v1.Node {
 			return &n
 		}
 	}
-	klog.Infof("node %s not found ", nodeName)
+	klog.InfoS("Node not found", "node", nodeName)
 	return nil
 }
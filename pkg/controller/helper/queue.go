@@ -69,15 +69,15 @@ func (t *Queue) EnqueueSkippableTask(obj interface{}) {
 // enqueue enqueues ns/name of the given api object in the task queue.
 func (t *Queue) enqueue(obj interface{}, skippable bool) {
 	if t.IsShuttingDown() {
-		klog.Errorf("queue has been shutdown, failed to enqueue. key: %+v", obj)
+		klog.InfoS("Queue has been shutdown, failed to enqueue", "item", obj)
 		return
 	}
 
-	klog.V(3).Infof("queuing, item: %+v", obj)
+	klog.V(3).InfoS("Queuing", "item", obj)
 	e := obj.(Event)
 	key, err := t.fn(e.Obj)
 	if err != nil {
-		klog.Errorf("creating object key, item: %+v, error: %s", obj, err.Error())
+		klog.ErrorS(err, "Failed to create object key", "item", obj)
 		return
 	}
 	t.queue.Add(Element{
@@ -108,9 +108,9 @@ func (t *Queue) worker() {
 		ts := time.Now().UnixNano()
 
 		item := key.(Element)
-		klog.V(3).Infof("syncing: key: %s", item.Key)
+		klog.V(3).InfoS("Syncing", "key", item.Key)
 		if err := t.sync(key); err != nil {
-			klog.Errorf("requeuing: key: %s, error: %s", item.Key, err.Error())
+			klog.ErrorS(err, "Sync failed, requeuing", "key", item.Key)
 			t.queue.AddRateLimited(Element{
 				Key:   item.Key,
 				Event: item.Event,
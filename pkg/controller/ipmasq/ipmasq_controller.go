@@ -0,0 +1,224 @@
+package ipmasq
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	ctrlCfg "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ipmasq"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun"
+)
+
+// Add creates the ipmasq controller, which keeps the NonMasqueradeCIDRs of the
+// ip-masq-agent ConfigMap in sync with the vpc CIDRs and the pod CIDRs of the nodes
+func Add(mgr manager.Manager) error {
+	parts := strings.SplitN(ctrlCfg.ControllerCFG.IPMasqConfigMap, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid ip-masq-agent configmap %q", ctrlCfg.ControllerCFG.IPMasqConfigMap)
+	}
+	r := &ReconcileIPMasq{
+		client:          mgr.GetClient(),
+		reader:          mgr.GetAPIReader(),
+		record:          mgr.GetEventRecorderFor("ipmasq-controller"),
+		configMap:       types.NamespacedName{Namespace: parts[0], Name: parts[1]},
+		extraCIDRs:      ctrlCfg.ControllerCFG.IPMasqExtraCIDRs,
+		reconcilePeriod: ctrlCfg.ControllerCFG.RouteReconciliationPeriod.Duration,
+	}
+
+	recoverPanic := true
+	c, err := controller.New("ipmasq-controller", mgr, controller.Options{
+		Reconciler:              r,
+		MaxConcurrentReconciles: 1,
+		RecoverPanic:            &recoverPanic,
+	})
+	if err != nil {
+		return err
+	}
+	// every node change reconciles the single ConfigMap
+	toConfigMap := handler.EnqueueRequestsFromMapFunc(func(client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: r.configMap}}
+	})
+	if err := c.Watch(&source.Kind{Type: &corev1.Node{}}, toConfigMap, predicateForPodCIDRs()); err != nil {
+		return err
+	}
+	// the ConfigMap is read from the api server and not watched, edits are reverted by the periodical sync
+	ticks := make(chan event.GenericEvent)
+	if err := c.Watch(&source.Channel{Source: ticks}, toConfigMap); err != nil {
+		return err
+	}
+	return mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return r.periodicalSync(ctx, ticks)
+	}))
+}
+
+// predicateForPodCIDRs passes the creation and deletion of nodes and changes of their pod CIDRs
+func predicateForPodCIDRs() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldNode, ok1 := e.ObjectOld.(*corev1.Node)
+			newNode, ok2 := e.ObjectNew.(*corev1.Node)
+			if !ok1 || !ok2 {
+				return false
+			}
+			return oldNode.Spec.PodCIDR != newNode.Spec.PodCIDR ||
+				!reflect.DeepEqual(oldNode.Spec.PodCIDRs, newNode.Spec.PodCIDRs)
+		},
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// ReconcileIPMasq implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileIPMasq{}
+
+// ReconcileIPMasq reconciles the ip-masq-agent ConfigMap
+type ReconcileIPMasq struct {
+	client client.Client
+	// reader reads the ConfigMap from the api server, so not all ConfigMaps are cached
+	reader client.Reader
+	record record.EventRecorder
+
+	configMap       types.NamespacedName
+	extraCIDRs      []string
+	reconcilePeriod time.Duration
+
+	// vpcCIDRs are refreshed once per reconcile period
+	vpcCIDRs    []string
+	vpcDescribe time.Time
+}
+
+func (r *ReconcileIPMasq) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	vpcCIDRs, err := r.getVpcCIDRs(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	podCIDRs, err := r.podCIDRs(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	cidrs, err := ipmasq.NonMasqueradeCIDRs(vpcCIDRs, podCIDRs, r.extraCIDRs)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if err := r.syncConfigMap(ctx, cidrs); err != nil {
+		klog.ErrorS(err, "Failed to sync ip-masq-agent configmap", "configmap", r.configMap)
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, nil
+}
+
+// syncConfigMap writes cidrs into the ip-masq-agent config, the ConfigMap is created if missing
+func (r *ReconcileIPMasq) syncConfigMap(ctx context.Context, cidrs []string) error {
+	cm := &corev1.ConfigMap{}
+	err := r.reader.Get(ctx, r.configMap, cm)
+	if apierrors.IsNotFound(err) {
+		config, _, err := ipmasq.Render("", cidrs)
+		if err != nil {
+			return err
+		}
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: r.configMap.Namespace, Name: r.configMap.Name},
+			Data:       map[string]string{ipmasq.ConfigKey: config},
+		}
+		if err := r.client.Create(ctx, cm); err != nil {
+			return fmt.Errorf("create configmap: %v", err)
+		}
+		klog.InfoS("Created ip-masq-agent configmap", "configmap", r.configMap, "nonMasqueradeCIDRs", cidrs)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get configmap: %v", err)
+	}
+
+	config, changed, err := ipmasq.Render(cm.Data[ipmasq.ConfigKey], cidrs)
+	if err != nil {
+		r.record.Event(cm, corev1.EventTypeWarning, helper.FailedSyncIPMasq, err.Error())
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[ipmasq.ConfigKey] = config
+	if err := r.client.Update(ctx, cm); err != nil {
+		return fmt.Errorf("update configmap: %v", err)
+	}
+	klog.InfoS("Updated ip-masq-agent configmap", "configmap", r.configMap, "nonMasqueradeCIDRs", cidrs)
+	r.record.Event(cm, corev1.EventTypeNormal, helper.SucceedSyncIPMasq,
+		fmt.Sprintf("NonMasqueradeCIDRs set to %s", strings.Join(cidrs, ",")))
+	return nil
+}
+
+// getVpcCIDRs returns the vpc CIDRs, described again once they are older than the
+// reconcile period. The last known CIDRs are used while describing the vpc fails.
+func (r *ReconcileIPMasq) getVpcCIDRs(ctx context.Context) ([]string, error) {
+	if r.vpcCIDRs != nil && time.Since(r.vpcDescribe) < r.reconcilePeriod {
+		return r.vpcCIDRs, nil
+	}
+	cidrs, err := ksyun.VpcCIDRs(ctx)
+	if err != nil {
+		if r.vpcCIDRs != nil {
+			klog.ErrorS(err, "Failed to describe vpc, using the last known vpc cidrs", "cidrs", r.vpcCIDRs)
+			return r.vpcCIDRs, nil
+		}
+		return nil, fmt.Errorf("describe vpc cidrs: %v", err)
+	}
+	if !reflect.DeepEqual(cidrs, r.vpcCIDRs) {
+		klog.InfoS("Vpc cidrs changed", "old", r.vpcCIDRs, "new", cidrs)
+	}
+	r.vpcCIDRs, r.vpcDescribe = cidrs, time.Now()
+	return cidrs, nil
+}
+
+// podCIDRs returns the pod CIDRs of all nodes
+func (r *ReconcileIPMasq) podCIDRs(ctx context.Context) ([]string, error) {
+	nodes := &corev1.NodeList{}
+	if err := r.client.List(ctx, nodes); err != nil {
+		return nil, fmt.Errorf("list nodes: %v", err)
+	}
+	var cidrs []string
+	for _, node := range nodes.Items {
+		cidrs = append(cidrs, node.Spec.PodCIDR)
+		cidrs = append(cidrs, node.Spec.PodCIDRs...)
+	}
+	return cidrs, nil
+}
+
+// periodicalSync enqueues the ConfigMap once per reconcile period, which picks up
+// new vpc CIDRs and reverts edits of the ConfigMap
+func (r *ReconcileIPMasq) periodicalSync(ctx context.Context, ticks chan<- event.GenericEvent) error {
+	ticker := time.NewTicker(r.reconcilePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			select {
+			case ticks <- event.GenericEvent{Object: &corev1.ConfigMap{}}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	v1 "k8s.io/api/core/v1"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+)
+
+// routeCIDRsForNode returns the CIDRs routes are created for, the pod CIDRs of the
+// node found by the pod CIDR source. With aggregate routes they are summarized into
+// the smallest set of routes, the gateway of all of them is the instance of the node.
+func (r *ReconcileRoute) routeCIDRsForNode(ctx context.Context, node *v1.Node) ([]string, error) {
+	podCidrs, err := r.podCIDRs.PodCIDRs(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	if r.aggregateRoutes {
+		podCidrs = ip.Summarize(podCidrs)
+	}
+	var cidrs []string
+	for _, n := range podCidrs {
+		cidrs = append(cidrs, n.String())
+	}
+	return cidrs, nil
+}
+
+// nodeIPv4PodCIDRs returns the IPv4 pod CIDRs of the node, IPv6 ones are ignored
+func nodeIPv4PodCIDRs(node *v1.Node) ([]ip.IP4Net, error) {
+	var cidrs []ip.IP4Net
+	seen := make(map[string]bool)
+	for _, podCidr := range append(node.Spec.PodCIDRs, node.Spec.PodCIDR) {
+		if podCidr == "" || seen[podCidr] {
+			continue
+		}
+		seen[podCidr] = true
+		addr, n, err := net.ParseCIDR(podCidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pod cidr on node spec: %v", podCidr)
+		}
+		if addr.To4() == nil {
+			continue
+		}
+		cidrs = append(cidrs, ip.FromIPNet(n))
+	}
+	return cidrs, nil
+}
@@ -0,0 +1,86 @@
+package route
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+)
+
+// parseClusterCIDR returns the cluster CIDR, nil if it is not configured
+func parseClusterCIDR(cidr string) (*net.IPNet, error) {
+	if cidr == "" {
+		return nil, nil
+	}
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster cidr %q: %v", cidr, err)
+	}
+	return n, nil
+}
+
+// inClusterCIDR reports whether cidr lies within the cluster CIDR, every CIDR does
+// when no cluster CIDR is configured
+func (r *ReconcileRoute) inClusterCIDR(cidr string) bool {
+	if r.clusterCIDR == nil {
+		return true
+	}
+	contains, _, err := containsRoute(r.clusterCIDR, cidr)
+	return err == nil && contains
+}
+
+// outsideClusterCIDR returns the cidrs not within the cluster CIDR
+func (r *ReconcileRoute) outsideClusterCIDR(cidrs []string) []string {
+	var outside []string
+	for _, cidr := range cidrs {
+		if !r.inClusterCIDR(cidr) {
+			outside = append(outside, cidr)
+		}
+	}
+	return outside
+}
+
+// checkClusterCIDR refuses routes for node CIDRs outside the cluster CIDR, which
+// would hijack addresses of the vpc or of another cluster. The event is recorded
+// once per node until its outside CIDRs change.
+func (r *ReconcileRoute) checkClusterCIDR(node *corev1.Node, cidrs []string) error {
+	outside := r.outsideClusterCIDR(cidrs)
+	if len(outside) == 0 {
+		r.outsideCIDRs.Remove(node.Name)
+		return nil
+	}
+	reported := strings.Join(outside, ",")
+	err := fmt.Errorf("pod cidr %s of node %s is outside cluster cidr %s", reported, node.Name, r.clusterCIDR)
+	if previous, ok := r.outsideCIDRs.Get(node.Name); ok && previous.(string) == reported {
+		klog.V(4).InfoS("Refusing to create route for node", "node", node.Name, "err", err)
+		return err
+	}
+	klog.ErrorS(err, "Refusing to create route for node", "node", node.Name)
+	nodeRef := &corev1.ObjectReference{
+		Kind:      "Node",
+		Name:      node.Name,
+		UID:       types.UID(node.Name),
+		Namespace: "",
+	}
+	r.record.Event(nodeRef, corev1.EventTypeWarning, helper.RouteOutsideClusterCIDR, err.Error())
+	r.outsideCIDRs.Set(node.Name, reported)
+	return err
+}
+
+// pruneOutsideCIDRs forgets the outside CIDRs reported for nodes that are gone
+func (r *ReconcileRoute) pruneOutsideCIDRs(nodes *corev1.NodeList) {
+	names := make(map[string]bool, len(nodes.Items))
+	for _, node := range nodes.Items {
+		names[node.Name] = true
+	}
+	for _, name := range r.outsideCIDRs.Keys() {
+		if !names[name] {
+			r.outsideCIDRs.Remove(name)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package route
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/prober"
+)
+
+// checkDatapaths compares the routed nodes with the pod network probe results the node
+// agents publish. An event is emitted when most peers can no longer reach the pods of
+// a node although its route exists, and once they reach them again.
+func (r *ReconcileRoute) checkDatapaths(nodes *corev1.NodeList, routed []string) {
+	votes := prober.Tally(nodes.Items)
+	isRouted := make(map[string]bool, len(routed))
+	for _, name := range routed {
+		isRouted[name] = true
+		v := votes[name]
+		_, wasBroken := r.brokenDatapaths.Get(name)
+		nodeRef := &corev1.ObjectReference{
+			Kind:      "Node",
+			Name:      name,
+			UID:       types.UID(name),
+			Namespace: "",
+		}
+		switch {
+		case v.Broken() && !wasBroken:
+			r.brokenDatapaths.Set(name, v)
+			klog.InfoS("Route exists but pods of node are unreachable", "node", name,
+				"unreachableFrom", v.Unreachable, "reporters", v.Reporters)
+			r.record.Event(nodeRef, corev1.EventTypeWarning, helper.RouteDatapathBroken,
+				fmt.Sprintf("Route exists but pods of node are unreachable from %d of %d probing nodes", v.Unreachable, v.Reporters))
+		case !v.Broken() && wasBroken:
+			r.brokenDatapaths.Remove(name)
+			klog.InfoS("Pods of node are reachable again", "node", name, "reporters", v.Reporters)
+			r.record.Event(nodeRef, corev1.EventTypeNormal, helper.RouteDatapathRecovered,
+				fmt.Sprintf("Pods of node are reachable again from %d of %d probing nodes", v.Reporters-v.Unreachable, v.Reporters))
+		}
+	}
+	// nodes without route are not expected to be reachable
+	for _, name := range r.brokenDatapaths.Keys() {
+		if !isRouted[name] {
+			r.brokenDatapaths.Remove(name)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	cmap "github.com/orcaman/concurrent-map"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/annotation"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metadata"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/providerid"
+)
+
+const (
+	defaultResolverMetadataTimeout = 5 * time.Second
+	defaultResolverMetadataRetries = 1
+	// negativeCacheTTL is how long the remote resolvers are not asked again for a
+	// node they did not know
+	negativeCacheTTL = time.Minute
+)
+
+// instanceIdResolver finds the instance id of a node from one source
+type instanceIdResolver interface {
+	Name() string
+	// Remote resolvers call an api, their results are cached per node UID
+	Remote() bool
+	// Resolve returns an empty id without error when the source does not know the node
+	Resolve(ctx context.Context, node *v1.Node) (string, error)
+}
+
+// instanceIdResolverChain tries the resolvers in order and writes the id found
+// by any other resolver back to the instanceId annotation of the node.
+type instanceIdResolverChain struct {
+	client    client.Client
+	record    record.EventRecorder
+	resolvers []instanceIdResolver
+
+	// cache maps node UID to the cachedInstanceId found by the remote resolvers
+	cache cmap.ConcurrentMap
+	// invalidProviderIDs maps node UID to the providerID last reported as invalid
+	invalidProviderIDs cmap.ConcurrentMap
+	now                func() time.Time
+}
+
+// cachedInstanceId is a result of the remote resolvers, an empty id expires
+type cachedInstanceId struct {
+	id      string
+	expires time.Time
+}
+
+func newInstanceIdResolverChain(c client.Client, recorder record.EventRecorder, names []string, metadataURL string) (*instanceIdResolverChain, error) {
+	chain := &instanceIdResolverChain{
+		client:             c,
+		record:             recorder,
+		cache:              cmap.New(),
+		invalidProviderIDs: cmap.New(),
+		now:                time.Now,
+	}
+	for _, name := range names {
+		var r instanceIdResolver
+		switch name {
+		case config.InstanceIdResolverAnnotation:
+			r = annotationResolver{}
+		case config.InstanceIdResolverProviderID:
+			r = providerIDResolver{}
+		case config.InstanceIdResolverDescribeInstances:
+			r = describeInstancesResolver{}
+		case config.InstanceIdResolverMetadata:
+			r = &metadataResolver{md: metadata.NewClient(metadataURL,
+				defaultResolverMetadataTimeout, defaultResolverMetadataRetries, time.Second)}
+		default:
+			return nil, fmt.Errorf("unknown instance id resolver %q", name)
+		}
+		chain.resolvers = append(chain.resolvers, r)
+	}
+	return chain, nil
+}
+
+// InstanceId returns the instance id of node, or an empty string if no resolver knows it
+func (c *instanceIdResolverChain) InstanceId(ctx context.Context, node *v1.Node) string {
+	return c.resolve(ctx, node, true)
+}
+
+// Lookup returns the instance id of node like InstanceId, but neither writes it back
+// to the node nor records events, for callers that must not change the cluster
+func (c *instanceIdResolverChain) Lookup(ctx context.Context, node *v1.Node) string {
+	return c.resolve(ctx, node, false)
+}
+
+// resolve tries the resolvers in order, with update the id is written back to the
+// node and resolver failures are recorded as events
+func (c *instanceIdResolverChain) resolve(ctx context.Context, node *v1.Node, update bool) string {
+	logger := klog.FromContext(ctx).WithValues("node", node.Name)
+	uid := string(node.UID)
+	remote := false
+	for _, r := range c.resolvers {
+		if r.Remote() && !remote {
+			remote = true
+			if o, ok := c.cache.Get(uid); ok {
+				cached := o.(cachedInstanceId)
+				if cached.id != "" {
+					if update {
+						c.writeBack(ctx, node, cached.id)
+					}
+					return cached.id
+				}
+				if c.now().Before(cached.expires) {
+					return ""
+				}
+			}
+		}
+		id, err := r.Resolve(ctx, node)
+		if err != nil {
+			logger.Error(err, "Failed to resolve instance id", "resolver", r.Name())
+			if update && r.Name() == config.InstanceIdResolverProviderID {
+				c.reportInvalidProviderID(node, err)
+			}
+			continue
+		}
+		if id == "" {
+			continue
+		}
+		logger.V(4).Info("Resolved instance id", "resolver", r.Name(), "instanceID", id)
+		if r.Remote() {
+			c.cache.Set(uid, cachedInstanceId{id: id})
+		}
+		if update && r.Name() != config.InstanceIdResolverAnnotation {
+			c.writeBack(ctx, node, id)
+		}
+		return id
+	}
+	if remote {
+		c.cache.Set(uid, cachedInstanceId{expires: c.now().Add(negativeCacheTTL)})
+	}
+	return ""
+}
+
+// reportInvalidProviderID records the InvalidProviderID event once per node until its
+// providerID changes
+func (c *instanceIdResolverChain) reportInvalidProviderID(node *v1.Node, err error) {
+	uid := string(node.UID)
+	if o, ok := c.invalidProviderIDs.Get(uid); ok && o.(string) == node.Spec.ProviderID {
+		return
+	}
+	c.invalidProviderIDs.Set(uid, node.Spec.ProviderID)
+	c.record.Event(node, v1.EventTypeWarning, helper.InvalidProviderID,
+		fmt.Sprintf("Cannot get instance id from providerID: %s", err.Error()))
+}
+
+// Prune drops the cached ids and reported providerIDs of nodes that are gone
+func (c *instanceIdResolverChain) Prune(nodes *v1.NodeList) {
+	uids := make(map[string]bool, len(nodes.Items))
+	for _, node := range nodes.Items {
+		uids[string(node.UID)] = true
+	}
+	for _, m := range []cmap.ConcurrentMap{c.cache, c.invalidProviderIDs} {
+		for _, uid := range m.Keys() {
+			if !uids[uid] {
+				m.Remove(uid)
+			}
+		}
+	}
+}
+
+func (c *instanceIdResolverChain) writeBack(ctx context.Context, node *v1.Node, id string) {
+	if node.Annotations[annotation.KCE2NodeAnnotationInstanceUUIDKey] == id {
+		return
+	}
+	getter := func(obj runtime.Object) (client.Object, error) {
+		n, ok := obj.(*v1.Node)
+		if !ok {
+			return nil, fmt.Errorf("expect node, got %T", obj)
+		}
+		return annotation.SetInstanceUUID(n, id), nil
+	}
+	if err := helper.PatchM(c.client, node.DeepCopy(), getter, helper.PatchSpec); err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to write back instance id annotation", "node", node.Name, "instanceID", id)
+	}
+}
+
+type annotationResolver struct{}
+
+func (annotationResolver) Name() string { return config.InstanceIdResolverAnnotation }
+func (annotationResolver) Remote() bool { return false }
+
+func (annotationResolver) Resolve(_ context.Context, node *v1.Node) (string, error) {
+	if id := node.Annotations[annotation.KCE1NodeAnnotationInstanceUUIDKey]; id != "" {
+		return id, nil
+	}
+	return node.Annotations[annotation.KCE2NodeAnnotationInstanceUUIDKey], nil
+}
+
+type providerIDResolver struct{}
+
+func (providerIDResolver) Name() string { return config.InstanceIdResolverProviderID }
+func (providerIDResolver) Remote() bool { return false }
+
+func (providerIDResolver) Resolve(_ context.Context, node *v1.Node) (string, error) {
+	if node.Spec.ProviderID == "" {
+		return "", nil
+	}
+	p, err := providerid.Parse(node.Spec.ProviderID)
+	if err != nil {
+		return "", err
+	}
+	return p.InstanceId, nil
+}
+
+type describeInstancesResolver struct{}
+
+func (describeInstancesResolver) Name() string { return config.InstanceIdResolverDescribeInstances }
+func (describeInstancesResolver) Remote() bool { return true }
+
+func (describeInstancesResolver) Resolve(ctx context.Context, node *v1.Node) (string, error) {
+	ip := nodeInternalIP(node)
+	if ip == "" {
+		return "", nil
+	}
+	return ksyun.GetInstanceIdFromIP(ctx, ip)
+}
+
+// metadataResolver asks the metadata service of the host the controller runs on,
+// so it only knows the node whose InternalIP is the local ipv4 of the host.
+type metadataResolver struct {
+	md *metadata.Client
+
+	lock    sync.Mutex
+	localIP string
+}
+
+func (*metadataResolver) Name() string { return config.InstanceIdResolverMetadata }
+func (*metadataResolver) Remote() bool { return true }
+
+func (r *metadataResolver) Resolve(ctx context.Context, node *v1.Node) (string, error) {
+	ip := nodeInternalIP(node)
+	if ip == "" {
+		return "", nil
+	}
+	r.lock.Lock()
+	localIP := r.localIP
+	r.lock.Unlock()
+	if localIP == "" {
+		var err error
+		if localIP, err = r.md.Get(ctx, "local-ipv4"); err != nil {
+			return "", err
+		}
+		r.lock.Lock()
+		r.localIP = localIP
+		r.lock.Unlock()
+	}
+	if localIP != ip {
+		return "", nil
+	}
+	return r.md.Get(ctx, "instance-id")
+}
+
+func nodeInternalIP(node *v1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			return addr.Address
+		}
+	}
+	return ""
+}
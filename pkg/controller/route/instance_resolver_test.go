@@ -0,0 +1,202 @@
+package route
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/annotation"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/fakekop"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metadata/fakemetadata"
+)
+
+var defaultTestResolvers = []string{
+	config.InstanceIdResolverAnnotation, config.InstanceIdResolverProviderID, config.InstanceIdResolverDescribeInstances,
+}
+
+func TestInstanceIdResolverChain(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolvers  []string
+		annotated  string
+		providerID string
+		// metadata is served by the metadata service of the controller host
+		metadata map[string]string
+		// instances maps the private ip of each instance in the vpc to its id
+		instances    map[string]string
+		want         string
+		wantReasons  []string
+		wantDescribe int
+		// wantAnnotation is the instanceId annotation of the node afterwards
+		wantAnnotation string
+	}{
+		{
+			name:           "annotation",
+			annotated:      instanceA,
+			instances:      map[string]string{"10.0.0.2": instanceC},
+			want:           instanceA,
+			wantAnnotation: instanceA,
+		},
+		{
+			name:           "providerID",
+			providerID:     "ksyun://cn-test-1/" + instanceB,
+			instances:      map[string]string{"10.0.0.2": instanceC},
+			want:           instanceB,
+			wantAnnotation: instanceB,
+		},
+		{
+			name:           "invalid providerID falls back to describe instances",
+			providerID:     "ksyun://cn-test-1/not-an-instance",
+			instances:      map[string]string{"10.0.0.2": instanceC},
+			want:           instanceC,
+			wantReasons:    []string{helper.InvalidProviderID},
+			wantDescribe:   1,
+			wantAnnotation: instanceC,
+		},
+		{
+			name:           "describe instances",
+			instances:      map[string]string{"10.0.0.2": instanceC},
+			want:           instanceC,
+			wantDescribe:   1,
+			wantAnnotation: instanceC,
+		},
+		{
+			name:         "unknown node",
+			instances:    map[string]string{"10.0.0.3": instanceC},
+			wantDescribe: 1,
+		},
+		{
+			name:           "metadata of the local node",
+			resolvers:      []string{config.InstanceIdResolverAnnotation, config.InstanceIdResolverMetadata},
+			metadata:       map[string]string{"local-ipv4": "10.0.0.2", "instance-id": instanceA},
+			want:           instanceA,
+			wantAnnotation: instanceA,
+		},
+		{
+			name:      "metadata of another node",
+			resolvers: []string{config.InstanceIdResolverAnnotation, config.InstanceIdResolverMetadata},
+			metadata:  map[string]string{"local-ipv4": "10.0.0.3", "instance-id": instanceA},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kop := fakekop.NewServer("vpc-test", "10.0.0.0/16")
+			defer kop.Close()
+			for ip, id := range tt.instances {
+				kop.AddInstance(id, ip)
+			}
+			md := fakemetadata.NewServer(tt.metadata)
+			defer md.Close()
+			node := newTestNode("a", "10.0.0.2", "172.16.1.0/24", tt.annotated, 0)
+			node.Spec.ProviderID = tt.providerID
+			r, c, recorder := newTestReconciler(t, kop, node)
+			resolvers := tt.resolvers
+			if resolvers == nil {
+				resolvers = defaultTestResolvers
+			}
+			chain, err := newInstanceIdResolverChain(c, recorder, resolvers, md.BaseURL())
+			if err != nil {
+				t.Fatalf("newInstanceIdResolverChain() error = %v", err)
+			}
+			r.instanceIds = chain
+
+			if got := chain.InstanceId(context.Background(), getTestNode(t, c, "a")); got != tt.want {
+				t.Errorf("InstanceId() = %q, want %q", got, tt.want)
+			}
+			if got := eventReasons(recorder); !reflect.DeepEqual(got, tt.wantReasons) {
+				t.Errorf("events = %v, want %v", got, tt.wantReasons)
+			}
+			if got := kop.Requests("DescribeInstances"); got != tt.wantDescribe {
+				t.Errorf("DescribeInstances requests = %d, want %d", got, tt.wantDescribe)
+			}
+			got := getTestNode(t, c, "a").Annotations[annotation.KCE2NodeAnnotationInstanceUUIDKey]
+			if got != tt.wantAnnotation {
+				t.Errorf("instanceId annotation = %q, want %q", got, tt.wantAnnotation)
+			}
+		})
+	}
+}
+
+func TestInstanceIdResolverChainLookup(t *testing.T) {
+	kop := fakekop.NewServer("vpc-test", "10.0.0.0/16")
+	defer kop.Close()
+	kop.AddInstance(instanceC, "10.0.0.2")
+	node := newTestNode("a", "10.0.0.2", "172.16.1.0/24", "", 0)
+	node.Spec.ProviderID = "ksyun://cn-test-1/not-an-instance"
+	r, c, recorder := newTestReconciler(t, kop, node)
+	chain := r.instanceIds
+
+	if got := chain.Lookup(context.Background(), getTestNode(t, c, "a")); got != instanceC {
+		t.Fatalf("Lookup() = %q, want %q", got, instanceC)
+	}
+	if got := eventReasons(recorder); len(got) != 0 {
+		t.Errorf("Lookup() recorded events %v", got)
+	}
+	if _, ok := getTestNode(t, c, "a").Annotations[annotation.KCE2NodeAnnotationInstanceUUIDKey]; ok {
+		t.Errorf("Lookup() wrote back the instanceId annotation")
+	}
+
+	// the invalid providerID is reported once, however often the node is resolved
+	for i := 0; i < 3; i++ {
+		if got := chain.InstanceId(context.Background(), node); got != instanceC {
+			t.Fatalf("InstanceId() = %q, want %q", got, instanceC)
+		}
+	}
+	if got := eventReasons(recorder); !reflect.DeepEqual(got, []string{helper.InvalidProviderID}) {
+		t.Errorf("events = %v, want [%s]", got, helper.InvalidProviderID)
+	}
+}
+
+func TestInstanceIdResolverChainCache(t *testing.T) {
+	kop := fakekop.NewServer("vpc-test", "10.0.0.0/16")
+	defer kop.Close()
+	kop.AddInstance(instanceA, "10.0.0.2")
+	known := newTestNode("a", "10.0.0.2", "172.16.1.0/24", "", 0)
+	unknown := newTestNode("b", "10.0.0.3", "172.16.2.0/24", "", 0)
+	r, c, _ := newTestReconciler(t, kop, known, unknown)
+	chain := r.instanceIds
+	now := testEpoch
+	chain.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// a cache hit writes the id back to a node whose annotation was removed
+	if got := chain.InstanceId(ctx, known); got != instanceA {
+		t.Fatalf("InstanceId() = %q, want %q", got, instanceA)
+	}
+	if got := chain.InstanceId(ctx, known); got != instanceA {
+		t.Fatalf("InstanceId() of the cached node = %q, want %q", got, instanceA)
+	}
+	if got := kop.Requests("DescribeInstances"); got != 1 {
+		t.Errorf("DescribeInstances requests = %d, want 1", got)
+	}
+	node := getTestNode(t, c, "a")
+	delete(node.Annotations, annotation.KCE2NodeAnnotationInstanceUUIDKey)
+	if err := c.Update(ctx, node); err != nil {
+		t.Fatalf("update node: %v", err)
+	}
+	chain.InstanceId(ctx, getTestNode(t, c, "a"))
+	if got := getTestNode(t, c, "a").Annotations[annotation.KCE2NodeAnnotationInstanceUUIDKey]; got != instanceA {
+		t.Errorf("instanceId annotation after a cache hit = %q, want %q", got, instanceA)
+	}
+
+	// a node unknown to the api is not looked up again until the negative entry expires
+	for i := 0; i < 2; i++ {
+		if got := chain.InstanceId(ctx, unknown); got != "" {
+			t.Fatalf("InstanceId() of the unknown node = %q, want none", got)
+		}
+	}
+	if got := kop.Requests("DescribeInstances"); got != 2 {
+		t.Errorf("DescribeInstances requests = %d, want 2", got)
+	}
+	now = now.Add(negativeCacheTTL)
+	kop.AddInstance(instanceB, "10.0.0.3")
+	if got := chain.InstanceId(ctx, unknown); got != instanceB {
+		t.Errorf("InstanceId() after the negative entry expired = %q, want %q", got, instanceB)
+	}
+	if got := kop.Requests("DescribeInstances"); got != 3 {
+		t.Errorf("DescribeInstances requests = %d, want 3", got)
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/model"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/tracing"
 )
 
 var (
@@ -47,17 +49,21 @@ func createRouteForInstance(ctx context.Context, instanceId, cidr string) (
 					return true, nil
 				}
 				// fail fast, wait next time reconcile
-				klog.Errorf("Backoff creating route: same cidr exsits: %s", innerErr.Error())
+				klog.ErrorS(innerErr, "Backoff creating route: same cidr exists", "instanceID", instanceId, "cidr", cidr)
 				return false, innerErr
 			}
-			klog.Errorf("Backoff creating route: %s", innerErr.Error())
+			if ksyun.IsRouteQuotaExceeded(innerErr) {
+				// retrying does not help until a route is deleted
+				return false, innerErr
+			}
+			klog.ErrorS(innerErr, "Backoff creating route", "instanceID", instanceId, "cidr", cidr)
 			return false, nil
 		}
 		return true, nil
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("error create route for node %v, err: %v", instanceId, err)
+		return nil, fmt.Errorf("error create route for node %v, err: %w", instanceId, err)
 	}
 
 	if route == nil {
@@ -67,6 +73,39 @@ func createRouteForInstance(ctx context.Context, instanceId, cidr string) (
 	return route, nil
 }
 
+// replaceRouteForInstance points the route of cidr at instanceId. The api has no
+// way to change the gateway of a route, so it is deleted and created again.
+func replaceRouteForInstance(ctx context.Context, instanceId, cidr string) (*model.Route, error) {
+	routeLock.Lock()
+	defer routeLock.Unlock()
+	if err := ksyun.DeleteRoute(ctx, cidr); err != nil {
+		return nil, fmt.Errorf("error delete drifted route %s: %v", cidr, err)
+	}
+	err := wait.ExponentialBackoff(createBackoff, func() (bool, error) {
+		err := ksyun.CreateRoute(ctx, instanceId, cidr)
+		if err == nil {
+			return true, nil
+		}
+		if strings.Contains(err.Error(), "same with a route") {
+			// someone else created the route in the meantime, it is checked below
+			return true, nil
+		}
+		klog.ErrorS(err, "Backoff replacing route", "instanceID", instanceId, "cidr", cidr)
+		return false, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error create route %s for instance %s: %v", cidr, instanceId, err)
+	}
+	route, err := ksyun.FindRoute(ctx, cidr)
+	if err != nil {
+		return nil, err
+	}
+	if route == nil || route.InstanceId != instanceId {
+		return nil, fmt.Errorf("route %s does not point at instance %s after replacing", cidr, instanceId)
+	}
+	return route, nil
+}
+
 func deleteRouteForInstance(ctx context.Context, cidr string) error {
 	routeLock.Lock()
 	defer routeLock.Unlock()
@@ -78,64 +117,132 @@ func (r *ReconcileRoute) syncRoutes(ctx context.Context, nodes *v1.NodeList) err
 	if err != nil {
 		return fmt.Errorf("error listing routes: %v", err)
 	}
+	// the quota counts every entry of the route table, not only the host routes
+	table, err := ksyun.ListRouteTable(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing route table: %v", err)
+	}
 
+	deleted := 0
 	for _, route := range routes {
-		if conflictWithNodes(ctx, route, nodes) {
+		if r.conflictWithNodes(ctx, route, nodes) {
+			ctx := tracing.WithAttributes(ctx, tracing.AttrCIDR.String(route.DestinationCIDR))
 			if err = deleteRouteForInstance(ctx, route.DestinationCIDR); err != nil {
-				klog.Errorf("Could not delete conflict route %s %s, %s", route.Name, route.DestinationCIDR, err.Error())
+				klog.ErrorS(err, "Could not delete conflict route", "route", route.Name, "cidr", route.DestinationCIDR)
 				continue
 			}
-			klog.Infof("Delete conflict route %s, %s SUCCESS.", route.Name, route.DestinationCIDR)
+			klog.InfoS("Deleted conflict route", "route", route.Name, "cidr", route.DestinationCIDR)
+			deleted++
 		}
 	}
+	deleted += r.deleteOrphanedNetworkRoutes(ctx, routes)
 
-	for _, node := range nodes.Items {
-		if !needSyncRoute(&node) {
+	r.quota.Reset(len(table) - deleted)
+	podCidrCount, routeCidrCount, quotaPending := 0, 0, 0
+	var routed []string
+	for _, node := range sortNodesByAge(nodes.Items) {
+		if !r.needSyncRoute(ctx, &node) {
 			continue
 		}
 
-		_, ipv4RouteCidr, err := getIPv4RouteForNode(&node)
-		if err != nil || ipv4RouteCidr == "" {
+		routeCidrs, err := r.routeCIDRsForNode(ctx, &node)
+		if err != nil || len(routeCidrs) == 0 {
 			continue
 		}
+		podCidrs, _ := r.podCIDRs.PodCIDRs(ctx, &node)
+		podCidrCount += len(podCidrs)
+		routeCidrCount += len(routeCidrs)
 
-		err = r.addRouteForNode(ctx, ipv4RouteCidr, &node, routes)
+		if r.checkClusterCIDR(&node, routeCidrs) != nil {
+			continue
+		}
+
+		ctx := tracing.WithAttributes(ctx,
+			tracing.AttrNodeName.String(node.Name), tracing.AttrCIDR.String(strings.Join(routeCidrs, ",")))
+		if missing := missingRoutes(routeCidrs, routes); missing > 0 && !r.quota.Allow(missing) {
+			quotaPending++
+			r.routeQuotaExceeded(&node, routeCidrs, nil)
+			continue
+		}
+		err = r.addRouteForNode(ctx, routeCidrs, &node, routes)
 		if err != nil {
+			if ksyun.IsRouteQuotaExceeded(err) {
+				quotaPending++
+			}
 			continue
 		}
 
+		if err := r.syncNetworkRoutes(ctx, &node, routes); err != nil {
+			klog.ErrorS(err, "Failed to sync secondary network routes", "node", node.Name)
+		}
 		if err := r.updateNetworkingCondition(ctx, &node, true); err != nil {
-			klog.Errorf("update node %s network condition err: %s", node.Name, err.Error())
+			klog.ErrorS(err, "Failed to update node network condition", "node", node.Name)
 		}
+		routed = append(routed, node.Name)
+	}
+	r.checkDatapaths(nodes, routed)
+
+	if quotaPending == 0 {
+		ksyun.Alerts.Success(ctx, alertOpRouteQuota)
+	} else {
+		klog.InfoS("Routes of nodes are waiting for route table quota", "nodes", quotaPending, "usage", r.quota.String())
+		r.alertRouteQuota(ctx, fmt.Errorf("routes of %d nodes are waiting for route table quota, %s", quotaPending, r.quota))
+	}
+	metric.RouteTableEntries.WithLabelValues("desired").Set(float64(routeCidrCount))
+	metric.RouteTableEntries.WithLabelValues("pod_cidrs").Set(float64(podCidrCount))
+	if r.aggregateRoutes {
+		klog.InfoS("Aggregated node routes", "podCIDRs", podCidrCount, "routes", routeCidrCount,
+			"saved", podCidrCount-routeCidrCount, "routeTableEntries", len(table)-deleted)
 	}
 	return nil
 }
 
-func conflictWithNodes(ctx context.Context, route *model.Route, nodes *v1.NodeList) bool {
+// conflictWithNodes reports whether route overlaps the CIDR of a node without pointing
+// at it. Routes outside the cluster CIDR belong to the vpc or another cluster and never conflict.
+func (r *ReconcileRoute) conflictWithNodes(ctx context.Context, route *model.Route, nodes *v1.NodeList) bool {
+	if !r.inClusterCIDR(route.DestinationCIDR) {
+		return false
+	}
 	for _, node := range nodes.Items {
-		ipv4Cidr, _, err := getIPv4RouteForNode(&node)
+		routeCidrs, err := r.routeCIDRsForNode(ctx, &node)
 		if err != nil {
-			klog.Errorf("error get ipv4 cidr from node: %v", node.Name)
+			klog.ErrorS(err, "Failed to get ipv4 cidr from node", "node", node.Name)
 			continue
 		}
-		if ipv4Cidr == nil {
-			continue
-		}
-		equal, contains, err := containsRoute(ipv4Cidr, route.DestinationCIDR)
-		if err != nil {
-			klog.Errorf("error get conflict state from node: %v and route: %v", node.Name, route)
-			continue
-		}
-		instanceId := getNodeInstanceId(ctx, &node)
-		if contains || (equal && route.InstanceId != instanceId) {
-			klog.Warningf("conflict route with node %v(%v) found, route: %+v", node.Name, ipv4Cidr, route)
+		for _, routeCidr := range routeCidrs {
+			_, ipv4Cidr, err := net.ParseCIDR(routeCidr)
+			if err != nil {
+				continue
+			}
+			equal, contains, err := containsRoute(ipv4Cidr, route.DestinationCIDR)
+			if err != nil {
+				klog.ErrorS(err, "Failed to get conflict state", "node", node.Name, "route", route.Name, "cidr", route.DestinationCIDR)
+				continue
+			}
+			if !equal && !contains {
+				continue
+			}
+			// with aggregate routes, a route of the node inside its summarized CIDR is
+			// left for removePreviousRoutes to delete once the summarized route exists
+			if (!contains || r.aggregateRoutes) && route.InstanceId == r.instanceIdOf(ctx, &node) {
+				continue
+			}
+			klog.InfoS("Conflict route with node found", "node", node.Name, "podCIDR", routeCidr, "route", route.Name, "cidr", route.DestinationCIDR, "gateway", route.InstanceId)
 			return true
 		}
-
 	}
 	return false
 }
 
+// instanceIdOf returns the instance id of node. With configure-cloud-routes disabled
+// the node is not changed, so the id is looked up without writing it back.
+func (r *ReconcileRoute) instanceIdOf(ctx context.Context, node *v1.Node) string {
+	if !r.configRoutes {
+		return r.instanceIds.Lookup(ctx, node)
+	}
+	return r.instanceIds.InstanceId(ctx, node)
+}
+
 func findRoute(ctx context.Context, cidr string, cachedRoutes []*model.Route) (*model.Route, error) {
 	if cidr == "" {
 		return nil, fmt.Errorf("empty query condition")
@@ -177,20 +284,25 @@ func containsRoute(outside *net.IPNet, insideRoute string) (containsEqual bool,
 	return true, true, nil
 }
 
-func needSyncRoute(node *v1.Node) bool {
-	if helper.HasExcludeLabel(node) {
-		klog.Infof("node %s has exclude label, skip creating route", node.Name)
+// needSyncRoute reports whether a route should be created for node. Nodes skipped by
+// the node filter get the RouteSkipped condition, their existing routes are kept.
+func (r *ReconcileRoute) needSyncRoute(ctx context.Context, node *v1.Node) bool {
+	reason, message, skip := r.nodeFilter.Skip(node)
+	if err := r.updateRouteSkippedCondition(ctx, node, skip, reason, message); err != nil {
+		klog.ErrorS(err, "Failed to update node route skipped condition", "node", node.Name)
+	}
+	if skip {
 		return false
 	}
 
 	readyCondition, ok := helper.FindCondition(node.Status.Conditions, v1.NodeReady)
 	if ok && readyCondition.Status == v1.ConditionUnknown {
-		klog.Infof("node %s is in unknown status, skip creating route", node.Name)
+		klog.V(4).InfoS("Node is in unknown status, skip creating route", "node", node.Name)
 		return false
 	}
 
 	if node.DeletionTimestamp != nil {
-		klog.Infof("node %s has deletionTimestamp, skip creating route", node.Name)
+		klog.V(4).InfoS("Node has deletionTimestamp, skip creating route", "node", node.Name)
 		return false
 	}
 
@@ -219,9 +331,9 @@ func getIPv4RouteForNode(node *v1.Node) (*net.IPNet, string, error) {
 	return ipv4CIDR, ipv4CIDRStr, nil
 }
 
-func (r *ReconcileRoute) NodeList() (*v1.NodeList, error) {
+func (r *ReconcileRoute) NodeList(ctx context.Context) (*v1.NodeList, error) {
 	nodes := &v1.NodeList{}
-	err := r.client.List(context.TODO(), nodes)
+	err := r.client.List(ctx, nodes)
 	if err != nil {
 		return nil, err
 	}
@@ -235,32 +347,3 @@ func (r *ReconcileRoute) NodeList() (*v1.NodeList, error) {
 	nodes.Items = mnodes
 	return nodes, nil
 }
-
-func getNodeInstanceId(ctx context.Context, node *v1.Node) string {
-	annotations := node.Annotations
-	if _, ok := annotations["appengine.sdns.ksyun.com/instance-uuid"]; ok {
-		return annotations["appengine.sdns.ksyun.com/instance-uuid"]
-	}
-
-	if _, ok := annotations["kce.sdns.ksyun.com/instanceId"]; ok {
-		return annotations["kce.sdns.ksyun.com/instanceId"]
-	}
-
-	if node.Spec.ProviderID != "" {
-		return node.Spec.ProviderID
-	}
-
-	/*
-	for _, addr := range node.Status.Addresses {
-		if addr.Type == "InternalIP" {
-			nodeIP := addr.Address
-			instanceId, err := ksyun.GetInstanceIdFromIP(ctx, nodeIP)
-			if err != nil {
-				return ""
-			}
-			return instanceId
-		}
-	}*/
-
-	return ""
-}
@@ -0,0 +1,311 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/model"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/multus"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/tracing"
+)
+
+// networkRoutes are the secondary network routes of a node and the instance they point at
+type networkRoutes struct {
+	instanceId string
+	cidrs      []string
+}
+
+// syncNetworkRoutes routes the ranges of the secondary networks of the node to its
+// instance, deletes the routes of ranges the node no longer has, and records the
+// status of each network in the network-routes annotation of the node.
+func (r *ReconcileRoute) syncNetworkRoutes(ctx context.Context, node *corev1.Node, cachedRoutes []*model.Route) error {
+	if !r.secondaryNetworks {
+		return nil
+	}
+	networks, invalid, err := r.listNetworks(ctx)
+	if err != nil {
+		return err
+	}
+	previous := multus.Statuses(node)
+	if len(networks) == 0 && len(invalid) == 0 && len(previous) == 0 {
+		return nil
+	}
+	instanceId := r.instanceIds.InstanceId(ctx, node)
+	if instanceId == "" {
+		return fmt.Errorf("cannot find instance uuid.")
+	}
+	nodeRef := &corev1.ObjectReference{
+		Kind:      "Node",
+		Name:      node.Name,
+		UID:       types.UID(instanceId),
+		Namespace: "",
+	}
+
+	statuses := make(map[string]multus.Status)
+	for key, err := range invalid {
+		// keep the routes of a network whose definition turned invalid
+		statuses[key] = multus.Status{CIDRs: previous[key].CIDRs, State: multus.StateFailed, Message: err.Error()}
+	}
+	for _, network := range networks {
+		status := r.syncNetwork(ctx, node, nodeRef, instanceId, network, cachedRoutes)
+		if status.State == multus.StateFailed {
+			// a failed network keeps its previous routes until its new ranges are routed
+			status.CIDRs = mergeCIDRs(previous[network.Key()].CIDRs, status.CIDRs)
+		}
+		if status.State == multus.StateNoRange && len(previous[network.Key()].CIDRs) == 0 {
+			continue
+		}
+		statuses[network.Key()] = status
+	}
+
+	desired := make(map[string]bool)
+	var routed []string
+	for _, status := range statuses {
+		for _, cidr := range status.CIDRs {
+			desired[cidr] = true
+			routed = append(routed, cidr)
+		}
+	}
+	for key, status := range previous {
+		for _, cidr := range status.CIDRs {
+			if desired[cidr] {
+				continue
+			}
+			if err := r.deleteNetworkRoute(ctx, node.Name, instanceId, cidr); err != nil {
+				klog.ErrorS(err, "Failed to delete route of secondary network", "node", node.Name, "network", key, "cidr", cidr)
+				desired[cidr] = true
+				routed = append(routed, cidr)
+				s := statuses[key]
+				s.CIDRs = append(s.CIDRs, cidr)
+				if s.State == "" {
+					s.State, s.Message = multus.StateFailed, fmt.Sprintf("delete route %s: %s", cidr, helper.GetLogMessage(err))
+				}
+				statuses[key] = s
+			}
+		}
+	}
+	r.networkRoutes.Set(node.Name, networkRoutes{instanceId: instanceId, cidrs: routed})
+	return r.recordNetworkStatuses(ctx, node, statuses)
+}
+
+// syncNetwork ensures the routes of the ranges of network allocated to the node
+func (r *ReconcileRoute) syncNetwork(ctx context.Context, node *corev1.Node, nodeRef *corev1.ObjectReference,
+	instanceId string, network *multus.Network, cachedRoutes []*model.Route) multus.Status {
+	ranges, err := r.networkRanges(ctx, network, node.Name)
+	if err != nil {
+		return multus.Status{State: multus.StateFailed, Message: err.Error()}
+	}
+	if len(ranges) == 0 {
+		return multus.Status{State: multus.StateNoRange, Message: "No range of the network is allocated to the node"}
+	}
+	status := multus.Status{State: multus.StateRouted}
+	for _, n := range ranges {
+		cidr := n.String()
+		ctx := tracing.WithAttributes(ctx, tracing.AttrCIDR.String(cidr))
+		route, err := r.ensureRoute(ctx, node, nodeRef, instanceId, cidr, cachedRoutes)
+		if err != nil || route == nil {
+			status.State = multus.StateFailed
+			status.Message = fmt.Sprintf("create route %s: %s", cidr, helper.GetLogMessage(err))
+			continue
+		}
+		status.CIDRs = append(status.CIDRs, cidr)
+	}
+	return status
+}
+
+// listNetworks returns the networks that opt into vpc routing, and the parse error
+// of the invalid ones by network key
+func (r *ReconcileRoute) listNetworks(ctx context.Context) ([]*multus.Network, map[string]error, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(multus.NetworkAttachmentDefinitionGVK.GroupVersion().WithKind(multus.NetworkAttachmentDefinitionGVK.Kind + "List"))
+	if err := r.networkReader.List(ctx, list); err != nil {
+		return nil, nil, fmt.Errorf("list network attachment definitions: %v", err)
+	}
+	var networks []*multus.Network
+	invalid := make(map[string]error)
+	for i := range list.Items {
+		network, err := multus.ParseNetwork(&list.Items[i])
+		if err != nil {
+			invalid[list.Items[i].GetNamespace()+"/"+list.Items[i].GetName()] = err
+			continue
+		}
+		if network != nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks, invalid, nil
+}
+
+// networkRanges returns the ranges of network allocated to the node
+func (r *ReconcileRoute) networkRanges(ctx context.Context, network *multus.Network, node string) ([]ip.IP4Net, error) {
+	var pools []unstructured.Unstructured
+	if network.IPAM.Type == multus.IPAMWhereabouts && network.IPAM.NodeSliceSize != "" {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(multus.NodeSlicePoolGVK.GroupVersion().WithKind(multus.NodeSlicePoolGVK.Kind + "List"))
+		if err := r.networkReader.List(ctx, list, client.InNamespace(network.Namespace)); err != nil {
+			return nil, fmt.Errorf("list node slice pools: %v", err)
+		}
+		pools = list.Items
+	}
+	return multus.NodeRanges(network, node, pools)
+}
+
+// deleteNetworkRoute deletes the route of cidr if it still points at the instance of the node
+func (r *ReconcileRoute) deleteNetworkRoute(ctx context.Context, node, instanceId, cidr string) error {
+	ctx = tracing.WithAttributes(ctx, tracing.AttrCIDR.String(cidr))
+	route, err := ksyun.FindRoute(ctx, cidr)
+	if err != nil {
+		return err
+	}
+	if route == nil || route.InstanceId != instanceId {
+		return nil
+	}
+	start := time.Now()
+	defer func() { metric.RouteLatency.WithLabelValues("delete").Observe(metric.MsSince(start)) }()
+	if err := deleteRouteForInstance(ctx, cidr); err != nil {
+		return err
+	}
+	klog.InfoS("Deleted route of secondary network", "node", node, "cidr", cidr)
+	return nil
+}
+
+// deleteNetworkRoutesOfNode deletes the secondary network routes of a deleted node
+func (r *ReconcileRoute) deleteNetworkRoutesOfNode(ctx context.Context, node string) error {
+	o, ok := r.networkRoutes.Get(node)
+	if !ok {
+		return nil
+	}
+	routes := o.(networkRoutes)
+	var errs []string
+	for _, cidr := range routes.cidrs {
+		if err := r.deleteNetworkRoute(ctx, node, routes.instanceId, cidr); err != nil {
+			errs = append(errs, fmt.Sprintf("delete route %s: %v", cidr, err))
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("delete secondary network routes of node %s: %s", node, strings.Join(errs, "; "))
+	}
+	r.networkRoutes.Remove(node)
+	return nil
+}
+
+// deleteOrphanedNetworkRoutes deletes the routes inside the ranges of the secondary
+// networks that point at no current node. The routes of nodes deleted while this process
+// did not track them are only found this way. Nothing is deleted while the instance of
+// a node is unknown, its routes could not be told apart. It returns the number deleted.
+func (r *ReconcileRoute) deleteOrphanedNetworkRoutes(ctx context.Context, routes []*model.Route) int {
+	if !r.secondaryNetworks {
+		return 0
+	}
+	networks, _, err := r.listNetworks(ctx)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list secondary networks for orphaned routes")
+		return 0
+	}
+	if len(networks) == 0 {
+		return 0
+	}
+	// excluded nodes are current nodes too, so all nodes are listed
+	nodes := &corev1.NodeList{}
+	if err := r.client.List(ctx, nodes); err != nil {
+		klog.ErrorS(err, "Failed to list nodes for orphaned secondary network routes")
+		return 0
+	}
+	instances := make(map[string]bool, len(nodes.Items))
+	for i := range nodes.Items {
+		instanceId := r.instanceIds.InstanceId(ctx, &nodes.Items[i])
+		if instanceId == "" {
+			klog.V(4).InfoS("Instance of node unknown, skip deleting orphaned secondary network routes", "node", nodes.Items[i].Name)
+			return 0
+		}
+		instances[instanceId] = true
+	}
+	deleted := 0
+	for _, route := range multus.OrphanedRoutes(networks, routes, instances) {
+		ctx := tracing.WithAttributes(ctx, tracing.AttrCIDR.String(route.DestinationCIDR))
+		if err := deleteRouteForInstance(ctx, route.DestinationCIDR); err != nil {
+			klog.ErrorS(err, "Failed to delete orphaned route of secondary network", "cidr", route.DestinationCIDR, "gateway", route.InstanceId)
+			continue
+		}
+		klog.InfoS("Deleted orphaned route of secondary network", "cidr", route.DestinationCIDR, "gateway", route.InstanceId)
+		deleted++
+	}
+	return deleted
+}
+
+// recordNetworkStatuses patches the network-routes annotation of the node when it changed
+func (r *ReconcileRoute) recordNetworkStatuses(ctx context.Context, node *corev1.Node, statuses map[string]multus.Status) error {
+	value := multus.FormatStatuses(statuses)
+	if node.Annotations[multus.NodeAnnotationNetworkRoutesKey] == value {
+		return nil
+	}
+	getter := func(obj runtime.Object) (client.Object, error) {
+		n, ok := obj.(*corev1.Node)
+		if !ok {
+			return nil, fmt.Errorf("expect node, got %T", obj)
+		}
+		if value == "" {
+			delete(n.Annotations, multus.NodeAnnotationNetworkRoutesKey)
+			return n, nil
+		}
+		if n.Annotations == nil {
+			n.Annotations = make(map[string]string)
+		}
+		n.Annotations[multus.NodeAnnotationNetworkRoutesKey] = value
+		return n, nil
+	}
+	if err := helper.PatchM(r.client, node.DeepCopy(), getter, helper.PatchSpec); err != nil {
+		return fmt.Errorf("record secondary network routes: %v", err)
+	}
+	return nil
+}
+
+func mergeCIDRs(a, b []string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, cidr := range append(append([]string{}, a...), b...) {
+		if !seen[cidr] {
+			seen[cidr] = true
+			merged = append(merged, cidr)
+		}
+	}
+	return merged
+}
+
+// watchNetworks reconciles all nodes when a network attachment definition changes.
+// Changed whereabouts node slices are picked up by the periodical sync.
+func (r *ReconcileRoute) watchNetworks(c controller.Controller) error {
+	allNodes := handler.EnqueueRequestsFromMapFunc(func(client.Object) []reconcile.Request {
+		nodes := &corev1.NodeList{}
+		if err := r.client.List(context.Background(), nodes); err != nil {
+			klog.ErrorS(err, "Failed to list nodes for network attachment definition change")
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(nodes.Items))
+		for _, node := range nodes.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: node.Name}})
+		}
+		return requests
+	})
+	if err := c.Watch(&source.Kind{Type: newUnstructured(multus.NetworkAttachmentDefinitionGVK)}, allNodes); err != nil {
+		return fmt.Errorf("watch network attachment definitions: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package route
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/calico"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+)
+
+// calicoNodeIndex indexes the calico IPAM resources by the node they are affine to
+const calicoNodeIndex = "calico.node"
+
+// podCIDRSource finds the IPv4 CIDRs the pods of a node get their addresses from
+type podCIDRSource interface {
+	Name() string
+	// PodCIDRs returns the IPv4 CIDRs routed to the instance of node
+	PodCIDRs(ctx context.Context, node *v1.Node) ([]ip.IP4Net, error)
+}
+
+func newPodCIDRSource(ctx context.Context, mgr manager.Manager, name string, aggregate bool) (podCIDRSource, error) {
+	switch name {
+	case config.PodCIDRSourceNode:
+		return nodePodCIDRSource{all: aggregate}, nil
+	case config.PodCIDRSourceCalicoIPAM:
+		for _, gvk := range []schema.GroupVersionKind{calico.BlockAffinityGVK, calico.IPAMBlockGVK} {
+			err := mgr.GetFieldIndexer().IndexField(ctx, newUnstructured(gvk), calicoNodeIndex, func(obj client.Object) []string {
+				if node := calico.Node(obj.(*unstructured.Unstructured)); node != "" {
+					return []string{node}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("index calico %s by node: %v", gvk.Kind, err)
+			}
+		}
+		return &calicoPodCIDRSource{reader: mgr.GetCache()}, nil
+	default:
+		return nil, fmt.Errorf("unknown pod cidr source %q", name)
+	}
+}
+
+// nodePodCIDRSource uses the pod CIDRs of the node spec. Only the first IPv4 pod CIDR
+// is routed, unless all are summarized into aggregate routes.
+type nodePodCIDRSource struct {
+	all bool
+}
+
+func (s nodePodCIDRSource) Name() string { return config.PodCIDRSourceNode }
+
+func (s nodePodCIDRSource) PodCIDRs(_ context.Context, node *v1.Node) ([]ip.IP4Net, error) {
+	if s.all {
+		return nodeIPv4PodCIDRs(node)
+	}
+	cidr, _, err := getIPv4RouteForNode(node)
+	if err != nil || cidr == nil || cidr.IP.To4() == nil {
+		return nil, err
+	}
+	return []ip.IP4Net{ip.FromIPNet(cidr)}, nil
+}
+
+// calicoPodCIDRSource uses the IPAM blocks calico assigned to the node, every block
+// gets its own route unless they are summarized into aggregate routes
+type calicoPodCIDRSource struct {
+	reader client.Reader
+}
+
+func (s *calicoPodCIDRSource) Name() string { return config.PodCIDRSourceCalicoIPAM }
+
+func (s *calicoPodCIDRSource) PodCIDRs(ctx context.Context, node *v1.Node) ([]ip.IP4Net, error) {
+	affinities, err := s.list(ctx, calico.BlockAffinityGVK, node.Name)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := s.list(ctx, calico.IPAMBlockGVK, node.Name)
+	if err != nil {
+		return nil, err
+	}
+	return calico.AffineBlocks(node.Name, affinities, blocks)
+}
+
+func (s *calicoPodCIDRSource) list(ctx context.Context, gvk schema.GroupVersionKind, node string) ([]unstructured.Unstructured, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err := s.reader.List(ctx, list, client.MatchingFields{calicoNodeIndex: node}); err != nil {
+		return nil, fmt.Errorf("list calico %s of node %s: %v", gvk.Kind, node, err)
+	}
+	return list.Items, nil
+}
+
+// watch reconciles the node of every changed BlockAffinity and IPAMBlock
+func (s *calicoPodCIDRSource) watch(c controller.Controller) error {
+	toNode := handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil
+		}
+		if node := calico.Node(u); node != "" {
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: node}}}
+		}
+		return nil
+	})
+	for _, gvk := range []schema.GroupVersionKind{calico.BlockAffinityGVK, calico.IPAMBlockGVK} {
+		if err := c.Watch(&source.Kind{Type: newUnstructured(gvk)}, toNode); err != nil {
+			return fmt.Errorf("watch calico %s: %v", gvk.Kind, err)
+		}
+	}
+	return nil
+}
+
+func newUnstructured(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	return u
+}
@@ -8,6 +8,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun"
 )
 
@@ -28,31 +29,39 @@ func (sp *predicateForNodeEvent) Update(e event.UpdateEvent) bool {
 				return false
 			}
 			if !ok1 && ok2 {
-				klog.Infof("node uuid changed: %s instance uuid changed: %v - %v", oldNode.Name, "", newId1)
+				klog.InfoS("Node instance uuid changed", "node", oldNode.Name, "old", "", "new", newId1)
 				return true
 			}
 			if !ok3 && ok4 {
-				klog.Infof("node uuid changed: %s instance uuid changed: %v - %v", oldNode.Name, "", newId2)
+				klog.InfoS("Node instance uuid changed", "node", oldNode.Name, "old", "", "new", newId2)
 				return true
 			}
 		}
 
 		if oldNode.UID != newNode.UID {
-			klog.Infof("node changed: %s UID Changed: %v - %v", oldNode.Name, oldNode.UID, newNode.UID)
+			klog.InfoS("Node UID changed", "node", oldNode.Name, "old", oldNode.UID, "new", newNode.UID)
 			return true
 		}
 		if oldNode.Spec.PodCIDR != newNode.Spec.PodCIDR {
-			klog.Infof("node changed: %s Pod CIDR Changed: %v - %v", oldNode.Name, oldNode.Spec.PodCIDR, newNode.Spec.PodCIDR)
+			klog.InfoS("Node pod CIDR changed", "node", oldNode.Name, "old", oldNode.Spec.PodCIDR, "new", newNode.Spec.PodCIDR)
 			return true
 		}
 
 		if oldNode.Spec.ProviderID != newNode.Spec.ProviderID {
-			klog.Infof("node changed: % Pod ProviderID Changed: %v - %v", oldNode.Name, oldNode.Spec.ProviderID, newNode.Spec.ProviderID)
+			klog.InfoS("Node providerID changed", "node", oldNode.Name, "old", oldNode.Spec.ProviderID, "new", newNode.Spec.ProviderID)
 			return true
 		}
 
 		if !reflect.DeepEqual(oldNode.Spec.PodCIDRs, newNode.Spec.PodCIDRs) {
-			klog.Infof("node changed: %s Pod CIDRs Changed: %v - %v", oldNode.Name, oldNode.Spec.PodCIDRs, newNode.Spec.PodCIDRs)
+			klog.InfoS("Node pod CIDRs changed", "node", oldNode.Name, "old", oldNode.Spec.PodCIDRs, "new", newNode.Spec.PodCIDRs)
+			return true
+		}
+
+		// labels, taints and the pause annotation decide whether the node is skipped
+		if !reflect.DeepEqual(oldNode.Labels, newNode.Labels) ||
+			!reflect.DeepEqual(oldNode.Spec.Taints, newNode.Spec.Taints) ||
+			oldNode.Annotations[helper.AnnotationRoutePaused] != newNode.Annotations[helper.AnnotationRoutePaused] {
+			klog.V(4).InfoS("Node scoping changed", "node", oldNode.Name)
 			return true
 		}
 
@@ -0,0 +1,181 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/model"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
+)
+
+// alertOpRouteQuota groups the route quota alerts, they are resolved once every node got its routes
+const alertOpRouteQuota = "RouteQuota"
+
+// routeQuota tracks the route table quota of the vpc. The quota is configured, or
+// learned from the number of routes when CreateRoute fails because the table is full.
+type routeQuota struct {
+	lock sync.Mutex
+
+	configured int
+	learned    int
+	used       int
+	// probed is set once a create was let through a full learned quota in this sync,
+	// to find out whether the quota was raised
+	probed bool
+}
+
+func newRouteQuota(configured int) *routeQuota {
+	return &routeQuota{configured: configured}
+}
+
+func (q *routeQuota) limit() int {
+	if q.configured > 0 {
+		return q.configured
+	}
+	return q.learned
+}
+
+// Reset starts a sync with the number of routes in the route table
+func (q *routeQuota) Reset(used int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.used = used
+	q.probed = false
+	q.report()
+}
+
+// Allow reports whether n routes may be created
+func (q *routeQuota) Allow(n int) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	limit := q.limit()
+	if limit == 0 || q.used+n <= limit {
+		return true
+	}
+	if q.configured == 0 && !q.probed {
+		q.probed = true
+		return true
+	}
+	return false
+}
+
+// Full reports whether no route can be created
+func (q *routeQuota) Full() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	limit := q.limit()
+	return limit > 0 && q.used >= limit
+}
+
+// Created records a created route. A learned quota that was exceeded is forgotten.
+func (q *routeQuota) Created() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.used++
+	if q.learned > 0 && q.used > q.learned {
+		q.learned = 0
+	}
+	q.report()
+}
+
+// Exceeded records that CreateRoute failed because the route table is full
+func (q *routeQuota) Exceeded() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.configured == 0 {
+		q.learned = q.used
+	}
+	q.report()
+}
+
+// String describes the usage for events and logs
+func (q *routeQuota) String() string {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if limit := q.limit(); limit > 0 {
+		return fmt.Sprintf("%d/%d routes used", q.used, limit)
+	}
+	return fmt.Sprintf("%d routes used", q.used)
+}
+
+func (q *routeQuota) report() {
+	metric.RouteTableEntries.WithLabelValues("used").Set(float64(q.used))
+	limit := q.limit()
+	if limit == 0 {
+		metric.RouteTableEntries.DeleteLabelValues("quota")
+		metric.RouteTableEntries.DeleteLabelValues("remaining")
+		return
+	}
+	remaining := limit - q.used
+	if remaining < 0 {
+		remaining = 0
+	}
+	metric.RouteTableEntries.WithLabelValues("quota").Set(float64(limit))
+	metric.RouteTableEntries.WithLabelValues("remaining").Set(float64(remaining))
+}
+
+// missingRoutes returns how many of cidrs have no route in routes
+func missingRoutes(cidrs []string, routes []*model.Route) int {
+	missing := 0
+	for _, cidr := range cidrs {
+		found := false
+		for _, route := range routes {
+			if route.DestinationCIDR == cidr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing++
+		}
+	}
+	return missing
+}
+
+// sortNodesByAge orders nodes oldest first, so once quota frees up the routes of
+// the nodes waiting longest are created first
+func sortNodesByAge(nodes []corev1.Node) []corev1.Node {
+	sorted := make([]corev1.Node, len(nodes))
+	copy(sorted, nodes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ti, tj := sorted[i].CreationTimestamp, sorted[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// routeQuotaExceeded reports that the routes of the node cannot be created because
+// the route table is full. The alert is raised by the caller, once per sync.
+func (r *ReconcileRoute) routeQuotaExceeded(node *corev1.Node, cidrs []string, err error) {
+	if err == nil {
+		err = fmt.Errorf("route table quota is full, %s", r.quota)
+	}
+	klog.ErrorS(err, "Route table quota exceeded, route is created once quota frees up", "node", node.Name, "cidr", cidrs, "usage", r.quota.String())
+	nodeRef := &corev1.ObjectReference{
+		Kind:      "Node",
+		Name:      node.Name,
+		UID:       types.UID(node.Name),
+		Namespace: "",
+	}
+	r.record.Event(nodeRef, corev1.EventTypeWarning, helper.RouteQuotaExceeded,
+		fmt.Sprintf("Route table quota exceeded (%s), route for %s is created once quota frees up",
+			r.quota, strings.Join(cidrs, ",")))
+}
+
+// alertRouteQuota raises the route quota alert, it is resolved by the first sync
+// without nodes waiting for quota
+func (r *ReconcileRoute) alertRouteQuota(ctx context.Context, err error) {
+	ksyun.Alerts.Failure(ctx, alertOpRouteQuota, helper.RouteQuotaExceeded, err)
+}
@@ -0,0 +1,148 @@
+package route
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/fakekop"
+)
+
+func TestRouteQuotaConfigured(t *testing.T) {
+	q := newRouteQuota(3)
+	q.Reset(2)
+	if !q.Allow(1) || q.Allow(2) {
+		t.Errorf("Allow() with 2/3 routes used lets through more than one route")
+	}
+	q.Created()
+	if !q.Full() || q.Allow(1) {
+		t.Errorf("Full() = %v with %s", q.Full(), q)
+	}
+	if got := q.String(); got != "3/3 routes used" {
+		t.Errorf("String() = %q, want %q", got, "3/3 routes used")
+	}
+	// a configured quota is never replaced by the learned one
+	q.Exceeded()
+	q.Reset(1)
+	if q.Full() || !q.Allow(2) {
+		t.Errorf("Allow(2) with %s = false", q)
+	}
+}
+
+func TestRouteQuotaLearned(t *testing.T) {
+	q := newRouteQuota(0)
+	q.Reset(2)
+	if q.Full() || !q.Allow(10) {
+		t.Fatalf("unknown quota limits routes, %s", q)
+	}
+	q.Exceeded()
+	if !q.Full() {
+		t.Fatalf("Full() = false after the quota was exceeded with %s", q)
+	}
+	// one create per sync probes whether the quota was raised
+	if !q.Allow(1) || q.Allow(1) {
+		t.Errorf("Allow() does not let exactly one probe through a full learned quota")
+	}
+	q.Reset(2)
+	if !q.Allow(1) {
+		t.Errorf("Allow() does not probe again in the next sync")
+	}
+	q.Created()
+	if q.Full() || q.String() != "3 routes used" {
+		t.Errorf("learned quota is kept after it was exceeded, %s", q)
+	}
+}
+
+func TestSyncRoutesQuota(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured int
+		kopQuota   int
+		// raised is the quota of the route table for a second sync, none if 0
+		raised      int
+		wantRoutes  map[string]string
+		wantReasons []string
+		wantCreates int
+	}{
+		{
+			name:       "configured quota",
+			configured: 3,
+			wantRoutes: map[string]string{"172.16.1.0/24": instanceA, "172.16.2.0/24": instanceB},
+			wantReasons: []string{
+				helper.SucceedCreateRoute, helper.SucceedCreateRoute, helper.RouteQuotaExceeded,
+			},
+			wantCreates: 2,
+		},
+		{
+			name:       "learned quota",
+			kopQuota:   3,
+			wantRoutes: map[string]string{"172.16.1.0/24": instanceA, "172.16.2.0/24": instanceB},
+			wantReasons: []string{
+				helper.SucceedCreateRoute, helper.SucceedCreateRoute, helper.RouteQuotaExceeded,
+			},
+			wantCreates: 3,
+		},
+		{
+			name:       "raised quota is probed",
+			kopQuota:   3,
+			raised:     4,
+			wantRoutes: map[string]string{"172.16.1.0/24": instanceA, "172.16.2.0/24": instanceB, "172.16.3.0/24": instanceC},
+			wantReasons: []string{
+				helper.SucceedCreateRoute, helper.SucceedCreateRoute, helper.RouteQuotaExceeded, helper.SucceedCreateRoute,
+			},
+			wantCreates: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kop := fakekop.NewServer("vpc-test", "10.0.0.0/16")
+			defer kop.Close()
+			// the default route is no host route, but counts against the quota
+			kop.AddRoute("InternetGateway", "0.0.0.0/0", "")
+			kop.SetQuota(tt.kopQuota)
+			// the routes of the oldest nodes are created first, whatever their names
+			r, c, recorder := newTestReconciler(t, kop,
+				newTestNode("c", "10.0.0.4", "172.16.3.0/24", instanceC, 2),
+				newTestNode("b", "10.0.0.3", "172.16.2.0/24", instanceB, 1),
+				newTestNode("a", "10.0.0.2", "172.16.1.0/24", instanceA, 0),
+			)
+			r.quota = newRouteQuota(tt.configured)
+			ctx := context.Background()
+
+			nodes, err := r.NodeList(ctx)
+			if err != nil {
+				t.Fatalf("NodeList() error = %v", err)
+			}
+			if err := r.syncRoutes(ctx, nodes); err != nil {
+				t.Fatalf("syncRoutes() error = %v", err)
+			}
+			if tt.raised != 0 {
+				kop.SetQuota(tt.raised)
+				if nodes, err = r.NodeList(ctx); err != nil {
+					t.Fatalf("NodeList() error = %v", err)
+				}
+				if err := r.syncRoutes(ctx, nodes); err != nil {
+					t.Fatalf("second syncRoutes() error = %v", err)
+				}
+			}
+			if got := routeTable(kop); !reflect.DeepEqual(got, tt.wantRoutes) {
+				t.Errorf("routes = %v, want %v", got, tt.wantRoutes)
+			}
+			if got := eventReasons(recorder); !reflect.DeepEqual(got, tt.wantReasons) {
+				t.Errorf("events = %v, want %v", got, tt.wantReasons)
+			}
+			if got := kop.Requests("CreateRoute"); got != tt.wantCreates {
+				t.Errorf("CreateRoute requests = %d, want %d", got, tt.wantCreates)
+			}
+			if _, ok := tt.wantRoutes["172.16.3.0/24"]; !ok {
+				cond := helper.GetNodeCondition(getTestNode(t, c, "c"), corev1.NodeNetworkUnavailable)
+				if cond != nil && cond.Status == corev1.ConditionFalse {
+					t.Errorf("youngest node without route is network available")
+				}
+			}
+		})
+	}
+}
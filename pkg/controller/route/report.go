@@ -0,0 +1,109 @@
+package route
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/model"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/health"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
+)
+
+// Route states of the report
+const (
+	reportRouted             = "routed"
+	reportMissing            = "missing"
+	reportDrift              = "drift"
+	reportOutsideClusterCIDR = "outside_cluster_cidr"
+	reportConflict           = "conflict"
+)
+
+// periodicalReport replaces the periodical sync when cloud routes are not configured,
+// it only reports the route changes the sync would make
+func (r *ReconcileRoute) periodicalReport() {
+	klog.InfoS("Cloud routes are not configured, only reporting route changes", "flag", "--configure-cloud-routes")
+	health.SyncStarted(r.reconcilePeriod)
+	go wait.Until(r.reportForCluster, r.reconcilePeriod, wait.NeverStop)
+}
+
+// reportForCluster logs and records in metrics the routes the sync would create,
+// replace, refuse or delete. Neither routes nor nodes are changed.
+func (r *ReconcileRoute) reportForCluster() {
+	ctx := context.Background()
+	start := time.Now()
+	var err error
+	defer func() { health.SyncCompleted(err) }()
+
+	nodes, err := r.NodeList(ctx)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list nodes")
+		return
+	}
+	routes, err := ksyun.ListRoutes(ctx)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list routes")
+		return
+	}
+
+	report := map[string]int{reportRouted: 0, reportMissing: 0, reportDrift: 0, reportOutsideClusterCIDR: 0, reportConflict: 0}
+	for _, route := range routes {
+		if r.conflictWithNodes(ctx, route, nodes) {
+			report[reportConflict]++
+			klog.InfoS("Would delete conflict route", "route", route.Name, "cidr", route.DestinationCIDR, "gateway", route.InstanceId)
+		}
+	}
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if _, _, skip := r.nodeFilter.Skip(node); skip || node.DeletionTimestamp != nil {
+			continue
+		}
+		cidrs, err := r.routeCIDRsForNode(ctx, node)
+		if err != nil || len(cidrs) == 0 {
+			continue
+		}
+		if outside := r.outsideClusterCIDR(cidrs); len(outside) != 0 {
+			report[reportOutsideClusterCIDR] += len(outside)
+			klog.InfoS("Would refuse route outside cluster cidr", "node", node.Name,
+				"cidr", strings.Join(outside, ","), "clusterCIDR", r.clusterCIDR)
+			continue
+		}
+		// the report must not change nodes, the instance id is not written back
+		instanceId := r.instanceIds.Lookup(ctx, node)
+		for _, cidr := range cidrs {
+			route := routeOf(cidr, routes)
+			switch {
+			case route == nil:
+				report[reportMissing]++
+				klog.InfoS("Would create route for node", "node", node.Name, "instanceID", instanceId, "cidr", cidr)
+			case instanceId != "" && route.InstanceId != instanceId:
+				report[reportDrift]++
+				klog.InfoS("Would replace drifted route", "node", node.Name, "cidr", cidr,
+					"gateway", route.InstanceId, "instanceID", instanceId)
+			default:
+				report[reportRouted]++
+			}
+		}
+	}
+
+	for state, count := range report {
+		metric.RouteReport.WithLabelValues(state).Set(float64(count))
+	}
+	klog.InfoS("Reported routes", "routed", report[reportRouted], "missing", report[reportMissing],
+		"drift", report[reportDrift], "outsideClusterCIDR", report[reportOutsideClusterCIDR],
+		"conflict", report[reportConflict], "duration", time.Since(start))
+}
+
+// routeOf returns the route of cidr in routes, nil if there is none
+func routeOf(cidr string, routes []*model.Route) *model.Route {
+	for _, route := range routes {
+		if route.DestinationCIDR == cidr {
+			return route
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package route
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/annotation"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/fakekop"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
+)
+
+func TestReportForCluster(t *testing.T) {
+	kop := fakekop.NewServer("vpc-test", "10.0.0.0/16")
+	defer kop.Close()
+	kop.AddInstance(instanceB, "10.0.0.3")
+	kop.AddRoute(fakekop.RouteTypeHost, "172.16.1.0/24", instanceA)
+	kop.AddRoute(fakekop.RouteTypeHost, "172.16.3.0/24", instanceA)
+	// inside the cidr of node a, but pointing at another instance
+	kop.AddRoute(fakekop.RouteTypeHost, "172.16.1.128/25", instanceB)
+	// outside the cluster cidr, never a conflict
+	kop.AddRoute(fakekop.RouteTypeHost, "192.168.0.0/24", instanceB)
+	r, c, recorder := newTestReconciler(t, kop,
+		newTestNode("a", "10.0.0.2", "172.16.1.0/24", instanceA, 0),
+		newTestNode("b", "10.0.0.3", "172.16.2.0/24", "", 1),
+		newTestNode("c", "10.0.0.4", "172.16.3.0/24", instanceC, 2),
+		newTestNode("d", "10.0.0.5", "10.1.0.0/24", instanceC, 3),
+	)
+	r.configRoutes = false
+	clusterCIDR, err := parseClusterCIDR("172.16.0.0/16")
+	if err != nil {
+		t.Fatalf("parseClusterCIDR() error = %v", err)
+	}
+	r.clusterCIDR = clusterCIDR
+	routes := routeTable(kop)
+
+	r.reportForCluster()
+
+	// the drifted route of node c is also a conflict the sync would delete
+	for state, want := range map[string]float64{
+		reportRouted:             1,
+		reportMissing:            1,
+		reportDrift:              1,
+		reportOutsideClusterCIDR: 1,
+		reportConflict:           2,
+	} {
+		if got := testutil.ToFloat64(metric.RouteReport.WithLabelValues(state)); got != want {
+			t.Errorf("report of %s routes = %v, want %v", state, got, want)
+		}
+	}
+	for _, action := range []string{"CreateRoute", "DeleteRoute"} {
+		if got := kop.Requests(action); got != 0 {
+			t.Errorf("report made %d %s requests", got, action)
+		}
+	}
+	if got := kop.Requests("DescribeInstances"); got != 1 {
+		t.Errorf("DescribeInstances requests = %d, want 1 for node b", got)
+	}
+	if got := routeTable(kop); !reflect.DeepEqual(got, routes) {
+		t.Errorf("routes = %v after the report, want %v", got, routes)
+	}
+	if _, ok := getTestNode(t, c, "b").Annotations[annotation.KCE2NodeAnnotationInstanceUUIDKey]; ok {
+		t.Errorf("report wrote back the instanceId annotation of node b")
+	}
+	if got := eventReasons(recorder); len(got) != 0 {
+		t.Errorf("report recorded events %v", got)
+	}
+}
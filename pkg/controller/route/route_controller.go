@@ -13,39 +13,86 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
+	"net"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
+	"strings"
 	"time"
 
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/annotation"
+	ctrlCfg "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/model"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/health"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/tracing"
 )
 
 const (
 	updateNodeStatusMaxRetries       = 3
 	defaultRouteReconciliationPeriod = 5 * time.Minute
+
+	// NodeAnnotationRouteCIDRKey is the comma separated pod CIDRs the routes of the node were
+	// last created for. It is moved to the new CIDRs once the routes of the previous ones are deleted.
+	NodeAnnotationRouteCIDRKey = annotation.NodeAnnotationRouteCIDRKey
+
+	// NodeRouteSkipped is true while the node filter skips route creation for the node
+	NodeRouteSkipped corev1.NodeConditionType = "RouteSkipped"
 )
 
 func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+	r, err := newReconciler(mgr)
+	if err != nil {
+		return err
+	}
+	return add(mgr, r)
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) *ReconcileRoute {
+func newReconciler(mgr manager.Manager) (*ReconcileRoute, error) {
+	recorder := mgr.GetEventRecorderFor("route-controller")
+	instanceIds, err := newInstanceIdResolverChain(mgr.GetClient(), recorder,
+		ctrlCfg.ControllerCFG.InstanceIdResolvers, ctrlCfg.ControllerCFG.MetadataURL)
+	if err != nil {
+		return nil, err
+	}
+	nodeFilter, err := helper.NewNodeFilter(ctrlCfg.ControllerCFG.NodeSelector, ctrlCfg.ControllerCFG.NodePolicies)
+	if err != nil {
+		return nil, err
+	}
+	podCIDRs, err := newPodCIDRSource(context.Background(), mgr, ctrlCfg.ControllerCFG.PodCIDRSource, ctrlCfg.ControllerCFG.AggregateRoutes)
+	if err != nil {
+		return nil, err
+	}
+	clusterCIDR, err := parseClusterCIDR(ctrlCfg.ControllerCFG.ClusterCIDR)
+	if err != nil {
+		return nil, err
+	}
 	recon := &ReconcileRoute{
-		client:          mgr.GetClient(),
-		scheme:          mgr.GetScheme(),
-		record:          mgr.GetEventRecorderFor("route-controller"),
-		nodeCache:       cmap.New(),
-		configRoutes:    true,
-		reconcilePeriod: defaultRouteReconciliationPeriod,
-	}
-	return recon
+		client:            mgr.GetClient(),
+		scheme:            mgr.GetScheme(),
+		record:            recorder,
+		nodeCache:         cmap.New(),
+		instanceIds:       instanceIds,
+		nodeFilter:        nodeFilter,
+		podCIDRs:          podCIDRs,
+		secondaryNetworks: ctrlCfg.ControllerCFG.SecondaryNetworkRoutes,
+		networkReader:     mgr.GetCache(),
+		networkRoutes:     cmap.New(),
+		configRoutes:      ctrlCfg.ControllerCFG.ConfigureCloudRoutes,
+		clusterCIDR:       clusterCIDR,
+		outsideCIDRs:      cmap.New(),
+		aggregateRoutes:   ctrlCfg.ControllerCFG.AggregateRoutes,
+		quota:             newRouteQuota(ctrlCfg.ControllerCFG.RouteQuota),
+		brokenDatapaths:   cmap.New(),
+		reconcilePeriod:   defaultRouteReconciliationPeriod,
+	}
+	return recon, nil
 }
 
 type routeController struct {
@@ -57,6 +104,8 @@ type routeController struct {
 func (controller routeController) Start(ctx context.Context) error {
 	if controller.recon.configRoutes {
 		controller.recon.periodicalSync()
+	} else {
+		controller.recon.periodicalReport()
 	}
 	return controller.c.Start(ctx)
 }
@@ -89,6 +138,17 @@ func add(mgr manager.Manager, r *ReconcileRoute) error {
 		return err
 	}
 
+	if r.secondaryNetworks {
+		if err := r.watchNetworks(c); err != nil {
+			return err
+		}
+	}
+	if calicoSource, ok := r.podCIDRs.(*calicoPodCIDRSource); ok {
+		if err := calicoSource.watch(c); err != nil {
+			return err
+		}
+	}
+
 	return mgr.Add(&routeController{c: c, recon: r})
 }
 
@@ -103,50 +163,91 @@ type ReconcileRoute struct {
 	// configuration fields
 	reconcilePeriod time.Duration
 	configRoutes    bool
+	aggregateRoutes bool
+	// clusterCIDR limits the node CIDRs routed and the conflicting routes deleted, nil if unset
+	clusterCIDR *net.IPNet
+	// outsideCIDRs holds the node CIDRs last reported outside the cluster CIDR per node
+	outsideCIDRs cmap.ConcurrentMap
 
 	nodeCache cmap.ConcurrentMap
 
+	// instanceIds resolves the instance id of nodes
+	instanceIds *instanceIdResolverChain
+
+	// nodeFilter decides which nodes get routes
+	nodeFilter *helper.NodeFilter
+
+	// podCIDRs finds the CIDRs routed to a node
+	podCIDRs podCIDRSource
+
+	// secondaryNetworks routes the ranges of the multus networks that opt into vpc routing
+	secondaryNetworks bool
+	// networkReader reads network attachment definitions and node slice pools from the cache
+	networkReader client.Reader
+	// networkRoutes holds the secondary network routes of each node, to delete them with the node
+	networkRoutes cmap.ConcurrentMap
+
+	// quota tracks the route table quota
+	quota *routeQuota
+
+	// brokenDatapaths holds the nodes whose route exists but whose pods peers can not reach
+	brokenDatapaths cmap.ConcurrentMap
+
 	//record event recorder
 	record record.EventRecorder
 }
 
 func (r *ReconcileRoute) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
-	// if do not need route, skip all node events
+	// if do not need route, skip all node events, the periodical report covers them
 	if !r.configRoutes {
 		return reconcile.Result{}, nil
 	}
 
+	ctx, span := tracing.StartRoot(ctx, "Reconcile", tracing.AttrNodeName.String(request.Name))
+	defer span.End()
+
 	reconcileNode := &corev1.Node{}
-	err := r.client.Get(context.TODO(), request.NamespacedName, reconcileNode)
+	err := r.client.Get(ctx, request.NamespacedName, reconcileNode)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			if o, ok := r.nodeCache.Get(request.Name); ok {
-				if route, ok := o.(*model.Route); ok {
-					start := time.Now()
+				if routes, ok := o.([]*model.Route); ok {
 					var errList []error
-					if err = deleteRouteForInstance(ctx, route.DestinationCIDR); err != nil {
-						errList = append(errList, err)
-						klog.Errorf("error delete route entry for delete node %s route %v, error: %v", request.Name, route, err)
-					} else {
-						klog.Infof("successfully delete route entry for node %s route %s", request.Name, route)
+					for _, route := range routes {
+						ctx := tracing.WithAttributes(ctx, tracing.AttrCIDR.String(route.DestinationCIDR))
+						start := time.Now()
+						if err = deleteRouteForInstance(ctx, route.DestinationCIDR); err != nil {
+							errList = append(errList, err)
+							klog.ErrorS(err, "Failed to delete route entry for deleted node", "node", request.Name, "route", route.Name, "cidr", route.DestinationCIDR)
+						} else {
+							klog.InfoS("Deleted route entry for deleted node", "node", request.Name, "route", route.Name, "cidr", route.DestinationCIDR)
+						}
+						metric.RouteLatency.WithLabelValues("delete").Observe(metric.MsSince(start))
 					}
-					metric.RouteLatency.WithLabelValues("delete").Observe(metric.MsSince(start))
 					if aggrErr := utilerrors.NewAggregate(errList); aggrErr == nil {
 						r.nodeCache.Remove(request.Name)
 					} else {
 						// requeue for remove error
+						tracing.RecordError(span, aggrErr)
 						return reconcile.Result{}, aggrErr
 					}
 				}
 			}
+			if err := r.deleteNetworkRoutesOfNode(ctx, request.Name); err != nil {
+				klog.ErrorS(err, "Failed to delete secondary network routes for deleted node", "node", request.Name)
+				tracing.RecordError(span, err)
+				return reconcile.Result{}, err
+			}
 			return reconcile.Result{}, nil
 		}
+		tracing.RecordError(span, err)
 		return reconcile.Result{}, err
 	}
 
 	err = r.syncCloudRoute(ctx, reconcileNode)
 	if err != nil {
-		klog.Errorf("add route for node %s failed, err: %s", reconcileNode.Name, err.Error())
+		tracing.RecordError(span, err)
+		klog.ErrorS(err, "Failed to add route for node", "node", reconcileNode.Name)
 		nodeRef := &corev1.ObjectReference{
 			Kind:      "Node",
 			Name:      reconcileNode.Name,
@@ -160,38 +261,61 @@ func (r *ReconcileRoute) Reconcile(ctx context.Context, request reconcile.Reques
 }
 
 func (r *ReconcileRoute) syncCloudRoute(ctx context.Context, node *corev1.Node) error {
-	if !needSyncRoute(node) {
+	if !r.needSyncRoute(ctx, node) {
 		return nil
 	}
 
-	_, ipv4RouteCidr, err := getIPv4RouteForNode(node)
-	if err != nil || ipv4RouteCidr == "" {
-		klog.Warningf("node %s parse podCIDR %s error, skip creating route", node.Name, node.Spec.PodCIDR)
+	routeCidrs, err := r.routeCIDRsForNode(ctx, node)
+	if err == nil && len(routeCidrs) == 0 && r.podCIDRs.Name() == ctrlCfg.PodCIDRSourceCalicoIPAM {
+		// calico assigns the first block once a pod is scheduled to the node, until then
+		// there is nothing to route and calico-node owns the NetworkUnavailable condition
+		klog.V(4).InfoS("Node has no calico ipam block yet, skip creating route", "node", node.Name)
+		return nil
+	}
+	if err != nil || len(routeCidrs) == 0 {
+		klog.InfoS("Failed to parse node podCIDR, skip creating route", "node", node.Name, "podCIDR", node.Spec.PodCIDR, "err", err)
 		if err1 := r.updateNetworkingCondition(ctx, node, false); err1 != nil {
-			klog.Errorf("route, update network condition error: %v", err1)
+			klog.ErrorS(err1, "Failed to update node network condition", "node", node.Name)
 		}
 		return err
 	}
 
-	var routeErr []error
-	routeErr = append(routeErr, r.addRouteForNode(ctx, ipv4RouteCidr, node, nil))
-	if utilerrors.NewAggregate(routeErr) != nil {
-		err := r.updateNetworkingCondition(ctx, node, false)
-		if err != nil {
-			klog.Errorf("update network condition for node %s, error: %v", node.Name, err.Error())
+	ctx = tracing.WithAttributes(ctx, tracing.AttrCIDR.String(strings.Join(routeCidrs, ",")))
+	if err := r.checkClusterCIDR(node, routeCidrs); err != nil {
+		if err1 := r.updateNetworkingCondition(ctx, node, false); err1 != nil {
+			klog.ErrorS(err1, "Failed to update node network condition", "node", node.Name)
 		}
-		return utilerrors.NewAggregate(routeErr)
-	} else {
-		return r.updateNetworkingCondition(ctx, node, true)
+		return err
+	}
+	if r.quota.Full() && node.Annotations[NodeAnnotationRouteCIDRKey] != strings.Join(routeCidrs, ",") {
+		// the periodical sync creates the routes of the oldest nodes first once quota frees up
+		r.routeQuotaExceeded(node, routeCidrs, nil)
+		r.alertRouteQuota(ctx, fmt.Errorf("route table quota is full, %s", r.quota))
+		return r.updateNetworkingCondition(ctx, node, false)
 	}
+	if err := r.addRouteForNode(ctx, routeCidrs, node, nil); err != nil {
+		if ksyun.IsRouteQuotaExceeded(err) {
+			r.alertRouteQuota(ctx, err)
+		}
+		if err1 := r.updateNetworkingCondition(ctx, node, false); err1 != nil {
+			klog.ErrorS(err1, "Failed to update node network condition", "node", node.Name)
+		}
+		return err
+	}
+	if err := r.syncNetworkRoutes(ctx, node, nil); err != nil {
+		klog.ErrorS(err, "Failed to sync secondary network routes", "node", node.Name)
+	}
+	return r.updateNetworkingCondition(ctx, node, true)
 }
 
-func (r *ReconcileRoute) addRouteForNode(ctx context.Context, ipv4Cidr string, node *corev1.Node, cachedRouteEntry []*model.Route) error {
-	var err error
-	instanceId := getNodeInstanceId(ctx, node)
+// addRouteForNode ensures the routes of cidrs point at the instance of the node. Routes
+// of CIDRs the node no longer has are deleted only after all of them are available.
+func (r *ReconcileRoute) addRouteForNode(ctx context.Context, cidrs []string, node *corev1.Node, cachedRouteEntry []*model.Route) error {
+	instanceId := r.instanceIds.InstanceId(ctx, node)
 	if len(instanceId) == 0 {
 		return fmt.Errorf("cannot find instance uuid.")
 	}
+	ctx = tracing.WithAttributes(ctx, tracing.AttrInstanceId.String(instanceId))
 	nodeRef := &corev1.ObjectReference{
 		Kind:      "Node",
 		Name:      node.Name,
@@ -199,25 +323,67 @@ func (r *ReconcileRoute) addRouteForNode(ctx context.Context, ipv4Cidr string, n
 		Namespace: "",
 	}
 
-	route, findErr := findRoute(ctx, ipv4Cidr, cachedRouteEntry)
+	current := strings.Join(cidrs, ",")
+	previous := r.previousRouteCIDRs(node)
+	stale := staleRouteCIDRs(previous, cidrs)
+	transition := len(previous) != 0 && strings.Join(previous, ",") != current
+	if transition {
+		klog.InfoS("Node pod CIDR changed, creating route for the new CIDR first", "node", node.Name, "previousCIDR", previous, "cidr", cidrs)
+		r.record.Event(nodeRef, corev1.EventTypeNormal, helper.RouteTransition,
+			fmt.Sprintf("PodCIDR changed from %s to %s, creating route for %s", strings.Join(previous, ","), current, current))
+	}
+
+	var routes []*model.Route
+	for _, cidr := range cidrs {
+		route, err := r.ensureRoute(ctx, node, nodeRef, instanceId, cidr, cachedRouteEntry)
+		if route == nil || err != nil {
+			return err
+		}
+		routes = append(routes, route)
+	}
+	r.nodeCache.Set(node.Name, routes)
+
+	if len(stale) != 0 {
+		if err := r.removePreviousRoutes(ctx, node, nodeRef, stale, cidrs, instanceId); err != nil {
+			// the annotation keeps the previous CIDRs, so the deletion is retried next time
+			return nil
+		}
+	}
+	if transition && len(stale) != 0 {
+		klog.InfoS("Route transition completed", "node", node.Name, "previousCIDR", previous, "cidr", cidrs)
+		r.record.Event(nodeRef, corev1.EventTypeNormal, helper.RouteTransition,
+			fmt.Sprintf("Route transition from %s to %s completed", strings.Join(previous, ","), current))
+	}
+	r.recordRouteCIDR(ctx, node, current)
+	return nil
+}
+
+// ensureRoute creates the route of cidr, or replaces it if it points at another instance
+func (r *ReconcileRoute) ensureRoute(ctx context.Context, node *corev1.Node, nodeRef *corev1.ObjectReference,
+	instanceId, cidr string, cachedRouteEntry []*model.Route) (*model.Route, error) {
+	route, findErr := findRoute(ctx, cidr, cachedRouteEntry)
 	if findErr != nil {
-		klog.Errorf("error found exist route for instance: %v, %v", nodeRef.UID, findErr)
+		klog.ErrorS(findErr, "Failed to find existing route", "node", node.Name, "instanceID", instanceId, "cidr", cidr)
 		r.record.Event(
 			nodeRef,
 			corev1.EventTypeWarning,
 			"DescriberRouteFailed",
-			fmt.Sprintf("Describe Route Failed for %s reason: %s", ipv4Cidr, helper.GetLogMessage(findErr)),
+			fmt.Sprintf("Describe Route Failed for %s reason: %s", cidr, helper.GetLogMessage(findErr)),
 		)
-		return nil
+		return nil, nil
 	}
 
+	var err error
 	// route not found, try to create route
-	if route == nil || route.DestinationCIDR != ipv4Cidr {
-		klog.Infof("create routes for node %s: %v - %v", node.Name, nodeRef.UID, ipv4Cidr)
+	if route == nil || route.DestinationCIDR != cidr {
+		klog.InfoS("Creating route for node", "node", node.Name, "instanceID", instanceId, "cidr", cidr)
 		start := time.Now()
-		route, err = createRouteForInstance(ctx, string(nodeRef.UID), ipv4Cidr)
-		if err != nil {
-			klog.Errorf("error create route for node %v : instance id [%v], err: %s", node.Name, nodeRef.UID, err.Error())
+		route, err = createRouteForInstance(ctx, string(nodeRef.UID), cidr)
+		if ksyun.IsRouteQuotaExceeded(err) {
+			r.quota.Exceeded()
+			r.routeQuotaExceeded(node, []string{cidr}, err)
+		} else if err != nil {
+			klog.ErrorS(err, "Failed to create route for node", "node", node.Name, "instanceID", instanceId, "cidr", cidr)
 			r.record.Event(
 				nodeRef,
 				corev1.EventTypeWarning,
@@ -225,35 +391,169 @@ func (r *ReconcileRoute) addRouteForNode(ctx context.Context, ipv4Cidr string, n
 				fmt.Sprintf("Error creating route entry : %s", helper.GetLogMessage(err)),
 			)
 		} else {
-			klog.Infof("Created route for %s - %s successfully", node.Name, ipv4Cidr)
+			r.quota.Created()
+			klog.InfoS("Created route for node", "node", node.Name, "instanceID", instanceId, "cidr", cidr)
 			r.record.Event(
 				nodeRef,
 				corev1.EventTypeNormal,
 				helper.SucceedCreateRoute,
-				fmt.Sprintf("Created route for %s -> %s successfully", node.Name, ipv4Cidr),
+				fmt.Sprintf("Created route for %s -> %s successfully", node.Name, cidr),
 			)
 		}
 		metric.RouteLatency.WithLabelValues("create").Observe(metric.MsSince(start))
+	} else if route.InstanceId != instanceId {
+		route, err = r.repairGatewayDrift(ctx, node, nodeRef, route, instanceId)
 	}
-	if route != nil {
-		r.nodeCache.SetIfAbsent(node.Name, route)
+	return route, err
+}
+
+// previousRouteCIDRs returns the CIDRs the routes of the node were last created for
+func (r *ReconcileRoute) previousRouteCIDRs(node *corev1.Node) []string {
+	if cidrs := node.Annotations[NodeAnnotationRouteCIDRKey]; cidrs != "" {
+		return strings.Split(cidrs, ",")
 	}
-	return err
+	var cidrs []string
+	if o, ok := r.nodeCache.Get(node.Name); ok {
+		if routes, ok := o.([]*model.Route); ok {
+			for _, route := range routes {
+				cidrs = append(cidrs, route.DestinationCIDR)
+			}
+		}
+	}
+	return cidrs
+}
+
+// staleRouteCIDRs returns the previous CIDRs not in cidrs
+func staleRouteCIDRs(previous, cidrs []string) []string {
+	var stale []string
+	for _, p := range previous {
+		found := false
+		for _, c := range cidrs {
+			if p == c {
+				found = true
+				break
+			}
+		}
+		if !found {
+			stale = append(stale, p)
+		}
+	}
+	return stale
+}
+
+// removePreviousRoutes deletes the routes of the previous pod CIDRs of the node once
+// the routes of the new CIDRs are available. A route that now points at another
+// instance belongs to another node and is kept.
+func (r *ReconcileRoute) removePreviousRoutes(ctx context.Context, node *corev1.Node, nodeRef *corev1.ObjectReference,
+	previousCidrs, cidrs []string, instanceId string) error {
+	for _, cidr := range cidrs {
+		current, err := ksyun.FindRoute(ctx, cidr)
+		if err != nil || current == nil || current.InstanceId != instanceId {
+			klog.InfoS("Route for the new CIDR is not available yet, keep the previous route", "node", node.Name, "cidr", cidr, "previousCIDR", previousCidrs)
+			return fmt.Errorf("route %s is not available", cidr)
+		}
+	}
+	r.record.Event(nodeRef, corev1.EventTypeNormal, helper.RouteTransition,
+		fmt.Sprintf("Route for %s is available, deleting route for previous PodCIDR %s",
+			strings.Join(cidrs, ","), strings.Join(previousCidrs, ",")))
+
+	for _, previousCidr := range previousCidrs {
+		ctx := tracing.WithAttributes(ctx, tracing.AttrCIDR.String(previousCidr))
+		previous, err := ksyun.FindRoute(ctx, previousCidr)
+		if err != nil {
+			klog.ErrorS(err, "Failed to find route of the previous CIDR", "node", node.Name, "previousCIDR", previousCidr)
+			return err
+		}
+		if previous != nil && previous.InstanceId != instanceId {
+			klog.InfoS("Route of the previous CIDR points at another instance, keep it", "node", node.Name,
+				"previousCIDR", previousCidr, "gateway", previous.InstanceId)
+			continue
+		}
+		if previous == nil {
+			continue
+		}
+		start := time.Now()
+		err = deleteRouteForInstance(ctx, previousCidr)
+		metric.RouteLatency.WithLabelValues("delete").Observe(metric.MsSince(start))
+		if err != nil {
+			klog.ErrorS(err, "Failed to delete route of the previous CIDR", "node", node.Name, "previousCIDR", previousCidr)
+			r.record.Event(nodeRef, corev1.EventTypeWarning, helper.RouteTransitionFailed,
+				fmt.Sprintf("Error deleting route for previous PodCIDR %s: %s", previousCidr, helper.GetLogMessage(err)))
+			return err
+		}
+	}
+	return nil
+}
+
+// recordRouteCIDR stores the comma separated CIDRs the routes of the node were created for in its annotations
+func (r *ReconcileRoute) recordRouteCIDR(ctx context.Context, node *corev1.Node, cidr string) {
+	if node.Annotations[NodeAnnotationRouteCIDRKey] == cidr {
+		return
+	}
+	diff := func(copy runtime.Object) (client.Object, error) {
+		nins := copy.(*corev1.Node)
+		if nins.Annotations == nil {
+			nins.Annotations = make(map[string]string)
+		}
+		nins.Annotations[NodeAnnotationRouteCIDRKey] = cidr
+		return nins, nil
+	}
+	if err := helper.PatchM(r.client, node.DeepCopy(), diff, helper.PatchSpec); err != nil {
+		klog.ErrorS(err, "Failed to record route CIDR on node", "node", node.Name, "cidr", cidr)
+	}
+}
+
+// repairGatewayDrift replaces a route of the node CIDR pointing at another instance,
+// e.g. when the node was rebuilt with the same name and CIDR
+func (r *ReconcileRoute) repairGatewayDrift(ctx context.Context, node *corev1.Node, nodeRef *corev1.ObjectReference,
+	route *model.Route, instanceId string) (*model.Route, error) {
+	klog.InfoS("Route gateway drifted, replacing route", "node", node.Name, "cidr", route.DestinationCIDR,
+		"gateway", route.InstanceId, "instanceID", instanceId)
+	r.record.Event(
+		nodeRef,
+		corev1.EventTypeWarning,
+		helper.RouteGatewayDrift,
+		fmt.Sprintf("Route %s points at instance %s instead of %s, replacing it", route.DestinationCIDR, route.InstanceId, instanceId),
+	)
+
+	start := time.Now()
+	newRoute, err := replaceRouteForInstance(ctx, instanceId, route.DestinationCIDR)
+	metric.RouteLatency.WithLabelValues("replace").Observe(metric.MsSince(start))
+	if err != nil {
+		metric.RouteGatewayDrift.WithLabelValues("failed").Inc()
+		klog.ErrorS(err, "Failed to replace drifted route", "node", node.Name, "instanceID", instanceId, "cidr", route.DestinationCIDR)
+		r.record.Event(
+			nodeRef,
+			corev1.EventTypeWarning,
+			helper.FailedCreateRoute,
+			fmt.Sprintf("Error replacing drifted route entry : %s", helper.GetLogMessage(err)),
+		)
+		return nil, err
+	}
+	metric.RouteGatewayDrift.WithLabelValues("repaired").Inc()
+	klog.InfoS("Replaced drifted route", "node", node.Name, "instanceID", instanceId, "cidr", route.DestinationCIDR)
+	r.record.Event(
+		nodeRef,
+		corev1.EventTypeNormal,
+		helper.SucceedCreateRoute,
+		fmt.Sprintf("Replaced route for %s -> %s successfully", node.Name, route.DestinationCIDR),
+	)
+	return newRoute, nil
 }
 
 func (r *ReconcileRoute) updateNetworkingCondition(ctx context.Context, node *corev1.Node, routeCreated bool) error {
 	networkCondition, ok := helper.FindCondition(node.Status.Conditions, corev1.NodeNetworkUnavailable)
 	if routeCreated && ok && networkCondition.Status == corev1.ConditionFalse {
-		klog.Infof("set node %v with NodeNetworkUnavailable=false was canceled because it is already set", node.Name)
+		klog.V(4).InfoS("Skip setting NodeNetworkUnavailable=false, already set", "node", node.Name)
 		return nil
 	}
 
 	if !routeCreated && ok && networkCondition.Status == corev1.ConditionTrue {
-		klog.Infof("set node %v with NodeNetworkUnavailable=true was canceled because it is already set", node.Name)
+		klog.V(4).InfoS("Skip setting NodeNetworkUnavailable=true, already set", "node", node.Name)
 		return nil
 	}
 
-	klog.Infof("Patching node status %v with %v previous condition was:%+v", node.Name, routeCreated, networkCondition)
+	klog.InfoS("Patching node network condition", "node", node.Name, "routeCreated", routeCreated, "previousStatus", networkCondition.Status, "previousReason", networkCondition.Reason)
 	var err error
 	for i := 0; i < updateNodeStatusMaxRetries; i++ {
 		// Patch could also fail, even though the chance is very slim. So we still do
@@ -283,36 +583,70 @@ func (r *ReconcileRoute) updateNetworkingCondition(ctx context.Context, node *co
 			return nil
 		}
 		if !errors.IsConflict(err) {
-			klog.Errorf("Error updating node %s: %v", node.Name, err)
+			klog.ErrorS(err, "Failed to update node", "node", node.Name)
 			return err
 		}
-		klog.Infof("Error updating node %s, retrying: %v", node.Name, err)
+		klog.InfoS("Conflict updating node, retrying", "node", node.Name, "err", err)
 	}
-	klog.Errorf("Error updating node %s: %v", node.Name, err)
+	klog.ErrorS(err, "Failed to update node after retries", "node", node.Name)
 	return err
 }
 
+// updateRouteSkippedCondition sets RouteSkipped with the reason the node is skipped. The
+// condition is only added once a node is skipped, and patched only when it changes.
+func (r *ReconcileRoute) updateRouteSkippedCondition(ctx context.Context, node *corev1.Node, skip bool, reason, message string) error {
+	if !skip {
+		reason, message = "RouteAllowed", "Node is selected for route creation"
+	}
+	status := corev1.ConditionFalse
+	if skip {
+		status = corev1.ConditionTrue
+	}
+	skippedCondition, ok := helper.FindCondition(node.Status.Conditions, NodeRouteSkipped)
+	if !ok && !skip {
+		return nil
+	}
+	if ok && skippedCondition.Status == status && skippedCondition.Reason == reason && skippedCondition.Message == message {
+		return nil
+	}
+
+	if skip {
+		klog.InfoS("Skip creating route for node", "node", node.Name, "reason", reason, "message", message)
+	} else {
+		klog.InfoS("Node is no longer skipped, creating route", "node", node.Name, "previousReason", skippedCondition.Reason)
+	}
+	return helper.SetNodeCondition(r.client, node, NodeRouteSkipped, status, reason, message)
+}
+
 func (r *ReconcileRoute) periodicalSync() {
+	health.SyncStarted(r.reconcilePeriod)
 	go wait.Until(r.reconcileForCluster, r.reconcilePeriod, wait.NeverStop)
 }
 
 func (r *ReconcileRoute) reconcileForCluster() {
-	ctx := context.Background()
+	ctx, span := tracing.StartRoot(context.Background(), "ReconcileForCluster")
 	start := time.Now()
+	var err error
 	defer func() {
 		metric.RouteLatency.WithLabelValues("reconcile").Observe(metric.MsSince(start))
+		health.SyncCompleted(err)
+		tracing.RecordError(span, err)
+		span.End()
 	}()
 
-	nodes, err := r.NodeList()
+	nodes, err := r.NodeList(ctx)
 	if err != nil {
-		klog.Errorf("reconcile: error listing nodes: %v", err)
+		klog.ErrorS(err, "Failed to list nodes")
 		return
 	}
 
+	r.instanceIds.Prune(nodes)
+	r.pruneOutsideCIDRs(nodes)
+
 	// Sync for nodes
-	if err := r.syncRoutes(ctx, nodes); err != nil {
-		klog.Errorf("sync route error: %s", err.Error())
+	if err = r.syncRoutes(ctx, nodes); err != nil {
+		klog.ErrorS(err, "Failed to sync routes")
 	}
 
-	klog.Infof("sync route successfully.")
+	klog.InfoS("Synced routes", "duration", time.Since(start))
 }
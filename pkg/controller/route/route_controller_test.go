@@ -0,0 +1,247 @@
+package route
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cmap "github.com/orcaman/concurrent-map"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/alert"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/annotation"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/fakekop"
+)
+
+const (
+	instanceA = "6f1c2a7e-0000-4000-8000-00000000000a"
+	instanceB = "6f1c2a7e-0000-4000-8000-00000000000b"
+	instanceC = "6f1c2a7e-0000-4000-8000-00000000000c"
+)
+
+var testEpoch = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestNode returns a ready node created age minutes after the epoch. The instance
+// id is set as annotation unless it is empty.
+func newTestNode(name, internalIP, podCidr, instanceId string, age int) *corev1.Node {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			UID:               types.UID("uid-" + name),
+			CreationTimestamp: metav1.NewTime(testEpoch.Add(time.Duration(age) * time.Minute)),
+			Annotations:       map[string]string{},
+		},
+		Spec: corev1.NodeSpec{PodCIDR: podCidr, PodCIDRs: []string{podCidr}},
+		Status: corev1.NodeStatus{
+			Addresses:  []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: internalIP}},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	if instanceId != "" {
+		node.Annotations[annotation.KCE2NodeAnnotationInstanceUUIDKey] = instanceId
+	}
+	return node
+}
+
+// newTestReconciler returns a reconciler of nodes against the vpc of kop, with the
+// default instance id resolvers
+func newTestReconciler(t *testing.T, kop *fakekop.Server, nodes ...*corev1.Node) (*ReconcileRoute, client.Client, *record.FakeRecorder) {
+	t.Helper()
+	cfg, alerts := ksyun.Cfg, ksyun.Alerts
+	ksyun.Cfg, ksyun.Alerts = kop.Config(), alert.NewManager(nil, 0, nil)
+	t.Cleanup(func() { ksyun.Cfg, ksyun.Alerts = cfg, alerts })
+
+	builder := fake.NewClientBuilder()
+	for _, node := range nodes {
+		builder = builder.WithObjects(node)
+	}
+	c := builder.Build()
+	recorder := record.NewFakeRecorder(100)
+	instanceIds, err := newInstanceIdResolverChain(c, recorder, []string{
+		config.InstanceIdResolverAnnotation, config.InstanceIdResolverProviderID, config.InstanceIdResolverDescribeInstances,
+	}, "")
+	if err != nil {
+		t.Fatalf("newInstanceIdResolverChain() error = %v", err)
+	}
+	nodeFilter, err := helper.NewNodeFilter("", nil)
+	if err != nil {
+		t.Fatalf("NewNodeFilter() error = %v", err)
+	}
+	r := &ReconcileRoute{
+		client:          c,
+		record:          recorder,
+		nodeCache:       cmap.New(),
+		instanceIds:     instanceIds,
+		nodeFilter:      nodeFilter,
+		podCIDRs:        nodePodCIDRSource{},
+		networkRoutes:   cmap.New(),
+		configRoutes:    true,
+		outsideCIDRs:    cmap.New(),
+		quota:           newRouteQuota(0),
+		brokenDatapaths: cmap.New(),
+		reconcilePeriod: defaultRouteReconciliationPeriod,
+	}
+	return r, c, recorder
+}
+
+func getTestNode(t *testing.T, c client.Client, name string) *corev1.Node {
+	t.Helper()
+	node := &corev1.Node{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: name}, node); err != nil {
+		t.Fatalf("get node %s: %v", name, err)
+	}
+	return node
+}
+
+// eventReasons drains the recorded events and returns their reasons
+func eventReasons(recorder *record.FakeRecorder) []string {
+	var reasons []string
+	for {
+		select {
+		case e := <-recorder.Events:
+			if fields := strings.Fields(e); len(fields) > 1 {
+				reasons = append(reasons, fields[1])
+			}
+		default:
+			return reasons
+		}
+	}
+}
+
+// routeTable returns the gateway of each host route of kop by destination
+func routeTable(kop *fakekop.Server) map[string]string {
+	table := make(map[string]string)
+	for _, route := range kop.Routes() {
+		if route.RouteType != fakekop.RouteTypeHost {
+			continue
+		}
+		gateway := ""
+		if len(route.NextHopset) != 0 {
+			gateway = route.NextHopset[0].GatewayId
+		}
+		table[route.DestinationCIDR] = gateway
+	}
+	return table
+}
+
+func TestSyncCloudRoute(t *testing.T) {
+	tests := []struct {
+		name string
+		// routeCidr is the route-cidr annotation of the node
+		routeCidr string
+		// routes is the gateway of each route in the table before the sync
+		routes          map[string]string
+		quota           int
+		wantErr         bool
+		wantRoutes      map[string]string
+		wantReasons     []string
+		wantRouteCidr   string
+		wantUnavailable corev1.ConditionStatus
+	}{
+		{
+			name:            "missing route is created",
+			wantRoutes:      map[string]string{"172.16.1.0/24": instanceA},
+			wantReasons:     []string{helper.SucceedCreateRoute},
+			wantRouteCidr:   "172.16.1.0/24",
+			wantUnavailable: corev1.ConditionFalse,
+		},
+		{
+			name:            "existing route is kept",
+			routes:          map[string]string{"172.16.1.0/24": instanceA},
+			wantRoutes:      map[string]string{"172.16.1.0/24": instanceA},
+			wantRouteCidr:   "172.16.1.0/24",
+			wantUnavailable: corev1.ConditionFalse,
+		},
+		{
+			name:            "drifted gateway is repaired",
+			routes:          map[string]string{"172.16.1.0/24": instanceC},
+			wantRoutes:      map[string]string{"172.16.1.0/24": instanceA},
+			wantReasons:     []string{helper.RouteGatewayDrift, helper.SucceedCreateRoute},
+			wantRouteCidr:   "172.16.1.0/24",
+			wantUnavailable: corev1.ConditionFalse,
+		},
+		{
+			name:      "route of the previous cidr is deleted after the new one is created",
+			routeCidr: "172.16.9.0/24",
+			routes:    map[string]string{"172.16.9.0/24": instanceA},
+			wantRoutes: map[string]string{
+				"172.16.1.0/24": instanceA,
+			},
+			wantReasons: []string{
+				helper.RouteTransition, helper.SucceedCreateRoute, helper.RouteTransition, helper.RouteTransition,
+			},
+			wantRouteCidr:   "172.16.1.0/24",
+			wantUnavailable: corev1.ConditionFalse,
+		},
+		{
+			name:      "route of the previous cidr taken over by another node is kept",
+			routeCidr: "172.16.9.0/24",
+			routes:    map[string]string{"172.16.9.0/24": instanceB},
+			wantRoutes: map[string]string{
+				"172.16.1.0/24": instanceA,
+				"172.16.9.0/24": instanceB,
+			},
+			wantReasons: []string{
+				helper.RouteTransition, helper.SucceedCreateRoute, helper.RouteTransition, helper.RouteTransition,
+			},
+			wantRouteCidr:   "172.16.1.0/24",
+			wantUnavailable: corev1.ConditionFalse,
+		},
+		{
+			name:      "route of the previous cidr is kept while the new one can not be created",
+			routeCidr: "172.16.9.0/24",
+			routes:    map[string]string{"172.16.9.0/24": instanceA},
+			quota:     1,
+			wantErr:   true,
+			wantRoutes: map[string]string{
+				"172.16.9.0/24": instanceA,
+			},
+			wantReasons:     []string{helper.RouteTransition, helper.RouteQuotaExceeded},
+			wantRouteCidr:   "172.16.9.0/24",
+			wantUnavailable: corev1.ConditionTrue,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kop := fakekop.NewServer("vpc-test", "10.0.0.0/16")
+			defer kop.Close()
+			for cidr, gateway := range tt.routes {
+				kop.AddRoute(fakekop.RouteTypeHost, cidr, gateway)
+			}
+			kop.SetQuota(tt.quota)
+			node := newTestNode("a", "10.0.0.2", "172.16.1.0/24", instanceA, 0)
+			if tt.routeCidr != "" {
+				node.Annotations[NodeAnnotationRouteCIDRKey] = tt.routeCidr
+			}
+			r, c, recorder := newTestReconciler(t, kop, node)
+
+			err := r.syncCloudRoute(context.Background(), getTestNode(t, c, "a"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("syncCloudRoute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := routeTable(kop); !reflect.DeepEqual(got, tt.wantRoutes) {
+				t.Errorf("routes = %v, want %v", got, tt.wantRoutes)
+			}
+			if got := eventReasons(recorder); !reflect.DeepEqual(got, tt.wantReasons) {
+				t.Errorf("events = %v, want %v", got, tt.wantReasons)
+			}
+			node = getTestNode(t, c, "a")
+			if got := node.Annotations[NodeAnnotationRouteCIDRKey]; got != tt.wantRouteCidr {
+				t.Errorf("route-cidr annotation = %q, want %q", got, tt.wantRouteCidr)
+			}
+			if cond := helper.GetNodeCondition(node, corev1.NodeNetworkUnavailable); cond == nil || cond.Status != tt.wantUnavailable {
+				t.Errorf("NetworkUnavailable = %v, want %s", cond, tt.wantUnavailable)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Package datapath checks that the node forwards the pod traffic of vpc host routes:
+// ip forwarding is on, reverse path filtering does not drop asymmetric traffic on the
+// primary interface, and the interface is up with a usable MTU. The result is the
+// RouteDatapathReady node condition.
+package datapath
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// NodeRouteDatapathReady is true while the node passes all datapath checks
+	NodeRouteDatapathReady v1.NodeConditionType = "RouteDatapathReady"
+
+	ReasonDatapathReady     = "DatapathReady"
+	ReasonIPForwardDisabled = "IPForwardDisabled"
+	ReasonRPFilterStrict    = "RPFilterStrict"
+	ReasonInterfaceDown     = "InterfaceDown"
+	ReasonMTUTooSmall       = "MTUTooSmall"
+	ReasonCheckFailed       = "CheckFailed"
+
+	// rpFilterStrict drops packets whose source is not routed back over the interface
+	// they came in, rpFilterLoose only drops sources that are not routable at all
+	rpFilterStrict = "1"
+	rpFilterLoose  = "2"
+)
+
+// sysctl paths below /proc/sys, interface names may contain dots so paths are kept
+// in slash form and only shown in dot form
+const (
+	sysctlIPForward   = "net/ipv4/ip_forward"
+	sysctlRPFilterAll = "net/ipv4/conf/all/rp_filter"
+)
+
+func sysctlRPFilter(iface string) string {
+	return path.Join("net/ipv4/conf", iface, "rp_filter")
+}
+
+func sysctlName(p string) string {
+	return strings.ReplaceAll(p, "/", ".")
+}
+
+// State is what the checks observed on the node
+type State struct {
+	// Interface is the primary interface, the one of the default route
+	Interface string
+	AdminUp   bool
+	OperState string
+	MTU       int
+
+	// Sysctls holds the values of the ip_forward and rp_filter sysctls by path
+	Sysctls map[string]string
+}
+
+// Problem is a failed check
+type Problem struct {
+	Reason  string
+	Message string
+}
+
+// Problems returns the failed checks of s, the interface MTU has to be at least minMTU
+func (s State) Problems(minMTU int) []Problem {
+	var problems []Problem
+	if v := s.Sysctls[sysctlIPForward]; v != "1" {
+		problems = append(problems, Problem{ReasonIPForwardDisabled,
+			fmt.Sprintf("%s is %q, pod traffic is not forwarded", sysctlName(sysctlIPForward), v)})
+	}
+	if strict := s.strictRPFilters(); len(strict) != 0 {
+		names := make([]string, 0, len(strict))
+		for _, p := range strict {
+			names = append(names, sysctlName(p))
+		}
+		verb := "is"
+		if len(names) > 1 {
+			verb = "are"
+		}
+		problems = append(problems, Problem{ReasonRPFilterStrict,
+			fmt.Sprintf("%s %s strict, pod traffic routed asymmetrically through %s is dropped",
+				strings.Join(names, " and "), verb, s.Interface)})
+	}
+	// virtual interfaces may not report an operational state
+	if !s.AdminUp || (s.OperState != "up" && s.OperState != "unknown") {
+		problems = append(problems, Problem{ReasonInterfaceDown,
+			fmt.Sprintf("interface %s is down, admin up %t, operational state %s", s.Interface, s.AdminUp, s.OperState)})
+	}
+	if s.MTU < minMTU {
+		problems = append(problems, Problem{ReasonMTUTooSmall,
+			fmt.Sprintf("mtu %d of interface %s is below %d", s.MTU, s.Interface, minMTU)})
+	}
+	return problems
+}
+
+// Fixes returns the sysctl values that fix the failed sysctl checks by path. Strict
+// rp_filter is relaxed to loose, which still drops unroutable sources.
+func (s State) Fixes() map[string]string {
+	fixes := make(map[string]string)
+	if s.Sysctls[sysctlIPForward] != "1" {
+		fixes[sysctlIPForward] = "1"
+	}
+	for _, p := range s.strictRPFilters() {
+		fixes[p] = rpFilterLoose
+	}
+	return fixes
+}
+
+// strictRPFilters returns the rp_filter sysctls set to strict when the interface
+// filters strictly. The kernel applies the larger of the all and the interface
+// value, so a strict value next to a loose one does not filter strictly.
+func (s State) strictRPFilters() []string {
+	all, iface := sysctlRPFilterAll, sysctlRPFilter(s.Interface)
+	mode := rpFilterMode(s.Sysctls[all])
+	if m := rpFilterMode(s.Sysctls[iface]); m > mode {
+		mode = m
+	}
+	if mode != rpFilterMode(rpFilterStrict) {
+		return nil
+	}
+	var strict []string
+	for _, p := range []string{all, iface} {
+		if s.Sysctls[p] == rpFilterStrict {
+			strict = append(strict, p)
+		}
+	}
+	return strict
+}
+
+// rpFilterMode parses an rp_filter value, unreadable values count as off
+func rpFilterMode(v string) int {
+	mode, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return 0
+	}
+	return mode
+}
+
+// condition returns the RouteDatapathReady status, reason and message for problems.
+// The reason is the one of the first problem, the message lists all of them.
+func condition(problems []Problem) (v1.ConditionStatus, string, string) {
+	if len(problems) == 0 {
+		return v1.ConditionTrue, ReasonDatapathReady, "Node forwards pod traffic of vpc routes"
+	}
+	messages := make([]string, 0, len(problems))
+	for _, p := range problems {
+		messages = append(messages, p.Message)
+	}
+	return v1.ConditionFalse, problems[0].Reason, strings.Join(messages, "; ")
+}
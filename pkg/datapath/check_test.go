@@ -0,0 +1,104 @@
+package datapath
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func newState(ipForward, rpFilterAll, rpFilterIface string) State {
+	return State{
+		Interface: "eth0.100",
+		AdminUp:   true,
+		OperState: "up",
+		MTU:       1500,
+		Sysctls: map[string]string{
+			"net/ipv4/ip_forward":              ipForward,
+			"net/ipv4/conf/all/rp_filter":      rpFilterAll,
+			"net/ipv4/conf/eth0.100/rp_filter": rpFilterIface,
+		},
+	}
+}
+
+func reasons(problems []Problem) []string {
+	var r []string
+	for _, p := range problems {
+		r = append(r, p.Reason)
+	}
+	return r
+}
+
+func TestProblems(t *testing.T) {
+	down := newState("1", "0", "0")
+	down.OperState = "down"
+	adminDown := newState("1", "0", "0")
+	adminDown.AdminUp = false
+	virtual := newState("1", "0", "0")
+	virtual.OperState = "unknown"
+	smallMTU := newState("1", "0", "0")
+	smallMTU.MTU = 1000
+
+	tests := []struct {
+		name    string
+		state   State
+		reasons []string
+	}{
+		{name: "ready", state: newState("1", "0", "2")},
+		{name: "forwarding disabled", state: newState("0", "0", "0"), reasons: []string{ReasonIPForwardDisabled}},
+		{name: "strict rp_filter on all", state: newState("1", "1", "0"), reasons: []string{ReasonRPFilterStrict}},
+		{name: "strict rp_filter on both", state: newState("1", "1", "1"), reasons: []string{ReasonRPFilterStrict}},
+		{name: "strict rp_filter on interface", state: newState("1", "0", "1"), reasons: []string{ReasonRPFilterStrict}},
+		{name: "loose interface overrides strict all", state: newState("1", "1", "2")},
+		{name: "loose all overrides strict interface", state: newState("1", "2", "1")},
+		{name: "interface down", state: down, reasons: []string{ReasonInterfaceDown}},
+		{name: "interface admin down", state: adminDown, reasons: []string{ReasonInterfaceDown}},
+		{name: "unknown operational state", state: virtual},
+		{name: "mtu too small", state: smallMTU, reasons: []string{ReasonMTUTooSmall}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reasons(tt.state.Problems(1280)); !reflect.DeepEqual(got, tt.reasons) {
+				t.Errorf("Problems() = %v, want %v", got, tt.reasons)
+			}
+		})
+	}
+}
+
+func TestFixes(t *testing.T) {
+	got := newState("0", "1", "0").Fixes()
+	want := map[string]string{
+		"net/ipv4/ip_forward":         "1",
+		"net/ipv4/conf/all/rp_filter": "2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fixes() = %v, want %v", got, want)
+	}
+	if got := newState("1", "0", "2").Fixes(); len(got) != 0 {
+		t.Errorf("Fixes() of ready state = %v, want none", got)
+	}
+	if got := newState("1", "2", "1").Fixes(); len(got) != 0 {
+		t.Errorf("Fixes() with loose all = %v, want none", got)
+	}
+	got = newState("1", "0", "1").Fixes()
+	want = map[string]string{"net/ipv4/conf/eth0.100/rp_filter": "2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fixes() with strict interface = %v, want %v", got, want)
+	}
+}
+
+func TestCondition(t *testing.T) {
+	status, reason, _ := condition(nil)
+	if status != v1.ConditionTrue || reason != ReasonDatapathReady {
+		t.Errorf("condition() without problems = %s %s", status, reason)
+	}
+	status, reason, message := condition(newState("0", "1", "0").Problems(1280))
+	if status != v1.ConditionFalse || reason != ReasonIPForwardDisabled {
+		t.Errorf("condition() = %s %s", status, reason)
+	}
+	want := `net.ipv4.ip_forward is "0", pod traffic is not forwarded; ` +
+		`net.ipv4.conf.all.rp_filter is strict, pod traffic routed asymmetrically through eth0.100 is dropped`
+	if message != want {
+		t.Errorf("condition() message = %q, want %q", message, want)
+	}
+}
@@ -0,0 +1,150 @@
+package datapath
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+)
+
+const sysctlRoot = "/proc/sys"
+
+// Options configures the checker
+type Options struct {
+	// Interval between two checks
+	Interval time.Duration
+	// MinMTU is the smallest accepted MTU of the primary interface
+	MinMTU int
+	// FixSysctls enables ip forwarding and relaxes strict rp_filter when the checks fail
+	FixSysctls bool
+}
+
+// Checker checks the datapath of a node and publishes the RouteDatapathReady condition.
+// It is a manager runnable.
+type Checker struct {
+	client   client.Client
+	nodeName string
+	opts     Options
+}
+
+// NewChecker returns a checker of the node nodeName
+func NewChecker(c client.Client, nodeName string, opts Options) *Checker {
+	return &Checker{client: c, nodeName: nodeName, opts: opts}
+}
+
+// Start checks every interval until ctx is done
+func (c *Checker) Start(ctx context.Context) error {
+	logger := klog.FromContext(ctx).WithValues("node", c.nodeName)
+	ctx = klog.NewContext(ctx, logger)
+	logger.Info("Started datapath checks", "interval", c.opts.Interval, "fixSysctls", c.opts.FixSysctls)
+
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := c.check(ctx); err != nil {
+			logger.Error(err, "Failed to publish datapath checks")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) check(ctx context.Context) error {
+	logger := klog.FromContext(ctx)
+	state, err := observe()
+	if err != nil {
+		return c.publish(ctx, []Problem{{ReasonCheckFailed, err.Error()}})
+	}
+	if fixes := state.Fixes(); c.opts.FixSysctls && len(fixes) != 0 {
+		for p, value := range fixes {
+			if err := writeSysctl(p, value); err != nil {
+				logger.Error(err, "Failed to fix sysctl", "sysctl", sysctlName(p), "value", value)
+				continue
+			}
+			logger.Info("Fixed sysctl", "sysctl", sysctlName(p), "previous", state.Sysctls[p], "value", value)
+		}
+		if state, err = observe(); err != nil {
+			return c.publish(ctx, []Problem{{ReasonCheckFailed, err.Error()}})
+		}
+	}
+	return c.publish(ctx, state.Problems(c.opts.MinMTU))
+}
+
+// observe reads the state of the primary interface and the sysctls
+func observe() (State, error) {
+	iface, err := ip.GetDefaultGatewayIface()
+	if err != nil {
+		return State{}, fmt.Errorf("get primary interface: %v", err)
+	}
+	link, err := netlink.LinkByIndex(iface.Index)
+	if err != nil {
+		return State{}, fmt.Errorf("get link of %s: %v", iface.Name, err)
+	}
+	state := State{
+		Interface: iface.Name,
+		AdminUp:   link.Attrs().Flags&net.FlagUp != 0,
+		OperState: link.Attrs().OperState.String(),
+		MTU:       link.Attrs().MTU,
+		Sysctls:   make(map[string]string),
+	}
+	for _, p := range []string{sysctlIPForward, sysctlRPFilterAll, sysctlRPFilter(iface.Name)} {
+		value, err := readSysctl(p)
+		if err != nil {
+			return State{}, err
+		}
+		state.Sysctls[p] = value
+	}
+	return state, nil
+}
+
+func readSysctl(p string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(sysctlRoot, p))
+	if err != nil {
+		return "", fmt.Errorf("read sysctl %s: %v", sysctlName(p), err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func writeSysctl(p, value string) error {
+	if err := os.WriteFile(filepath.Join(sysctlRoot, p), []byte(value), 0644); err != nil {
+		return fmt.Errorf("write sysctl %s: %v", sysctlName(p), err)
+	}
+	return nil
+}
+
+// publish sets the RouteDatapathReady condition of the node when it changed
+func (c *Checker) publish(ctx context.Context, problems []Problem) error {
+	node := &v1.Node{}
+	if err := c.client.Get(ctx, types.NamespacedName{Name: c.nodeName}, node); err != nil {
+		return fmt.Errorf("get node %s: %v", c.nodeName, err)
+	}
+	status, reason, message := condition(problems)
+	current, ok := helper.FindCondition(node.Status.Conditions, NodeRouteDatapathReady)
+	if ok && current.Status == status && current.Reason == reason && current.Message == message {
+		return nil
+	}
+	if status == v1.ConditionTrue {
+		klog.FromContext(ctx).Info("Datapath is ready")
+	} else {
+		klog.FromContext(ctx).Info("Datapath is not ready", "reason", reason, "message", message)
+	}
+	if err := helper.SetNodeCondition(c.client, node, NodeRouteDatapathReady, status, reason, message); err != nil {
+		return fmt.Errorf("update %s condition: %v", NodeRouteDatapathReady, err)
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package hostgw
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/overlay"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
+)
+
+const (
+	// routeProtocol marks the kernel routes owned by the agent, see `ip route show proto 86`
+	routeProtocol = 86
+
+	// NodeAnnotationHostGWPeersKey lists the peers the node reaches over host-gw routes
+	NodeAnnotationHostGWPeersKey = "kce.sdns.ksyun.com/host-gw-peers"
+	// NodeAnnotationOverlayPeersKey lists the peers the node reaches through the overlay tunnel
+	NodeAnnotationOverlayPeersKey = "kce.sdns.ksyun.com/overlay-peers"
+)
+
+// Options selects the fallback datapaths for peers whose vpc route is missing
+type Options struct {
+	// HostGW routes the pod CIDRs of peers in the local subnet via their node ip
+	HostGW bool
+	// Interface of the host-gw routes, the one of the node InternalIP if empty
+	Interface string
+	// Tunnel tunnels the pod CIDRs of the other peers over UDP if set
+	Tunnel       *overlay.Tunnel
+	ResyncPeriod time.Duration
+}
+
+// Add registers the fallback reconciler of the node the agent runs on. Every node
+// event syncs the routes to all peers, the manager cache has to hold all nodes.
+func Add(mgr manager.Manager, nodeName string, opts Options) error {
+	r := &ReconcileHostGW{
+		client:       mgr.GetClient(),
+		nodeName:     nodeName,
+		hostGW:       opts.HostGW,
+		ifaceName:    opts.Interface,
+		tunnel:       opts.Tunnel,
+		resyncPeriod: opts.ResyncPeriod,
+		paths:        make(map[string]Path),
+	}
+	if opts.Tunnel != nil {
+		if err := mgr.Add(opts.Tunnel); err != nil {
+			return err
+		}
+	}
+	return builder.ControllerManagedBy(mgr).
+		Named("host-gw").
+		For(&v1.Node{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetName() == nodeName
+		}))).
+		Watches(&source.Kind{Type: &v1.Node{}}, handler.EnqueueRequestsFromMapFunc(func(client.Object) []reconcile.Request {
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: nodeName}}}
+		})).
+		Complete(r)
+}
+
+// ReconcileHostGW keeps a kernel route to each peer in the local subnet whose vpc
+// route is missing, tunnels the pod CIDRs of the other peers if the overlay is
+// enabled, and withdraws both once the vpc route is confirmed.
+type ReconcileHostGW struct {
+	client       client.Client
+	nodeName     string
+	hostGW       bool
+	ifaceName    string
+	tunnel       *overlay.Tunnel
+	resyncPeriod time.Duration
+
+	lock sync.Mutex
+	// paths is the last reported path of each peer
+	paths map[string]Path
+}
+
+var _ reconcile.Reconciler = &ReconcileHostGW{}
+
+func (r *ReconcileHostGW) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	if request.Name != r.nodeName {
+		// events of peers are mapped to the local node, see Add
+		return reconcile.Result{}, nil
+	}
+	logger := klog.FromContext(ctx).WithValues("node", r.nodeName)
+	ctx = klog.NewContext(ctx, logger)
+
+	if err := r.sync(ctx); err != nil {
+		logger.Error(err, "Failed to sync host-gw routes")
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: r.resyncPeriod}, nil
+}
+
+func (r *ReconcileHostGW) sync(ctx context.Context) error {
+	nodes := &v1.NodeList{}
+	if err := r.client.List(ctx, nodes); err != nil {
+		return fmt.Errorf("list nodes: %v", err)
+	}
+	var local *v1.Node
+	for i := range nodes.Items {
+		if nodes.Items[i].Name == r.nodeName {
+			local = &nodes.Items[i]
+		}
+	}
+	if local == nil {
+		return fmt.Errorf("node %s not found", r.nodeName)
+	}
+
+	iface, err := r.iface(local)
+	if err != nil {
+		return err
+	}
+	subnet, err := ip.GetIfaceIP4Net(iface)
+	if err != nil {
+		return fmt.Errorf("get subnet of interface %s: %v", iface.Name, err)
+	}
+
+	var peers []*Peer
+	for i := range nodes.Items {
+		if nodes.Items[i].Name == r.nodeName {
+			continue
+		}
+		p := PeerOf(&nodes.Items[i], subnet)
+		if p == nil {
+			continue
+		}
+		if p.Path == PathHostGW && !r.hostGW {
+			p.Path = PathNone
+		}
+		if p.Path == PathNone && r.tunnel != nil {
+			p.Path = PathOverlay
+		}
+		peers = append(peers, p)
+	}
+
+	if err := syncKernelRoutes(ctx, iface, peers); err != nil {
+		return err
+	}
+	if r.tunnel != nil {
+		tunneled, nodes := overlayPeers(peers)
+		if err := r.tunnel.Sync(ctx, podCIDRs(local), iface.MTU, tunneled, nodes); err != nil {
+			return err
+		}
+	}
+	r.report(ctx, local, peers)
+	return nil
+}
+
+// overlayPeers returns the peers tunneled to, and all peers the tunnel accepts packets
+// from. A peer that finds the vpc route of this node missing tunnels to it although
+// this node reaches the peer over the vpc, so every peer is accepted.
+func overlayPeers(peers []*Peer) (tunneled, nodes []overlay.Peer) {
+	for _, p := range peers {
+		op := overlay.Peer{Name: p.Name, IP: p.IP, PodCIDRs: p.PodCIDRs}
+		if p.Path == PathOverlay {
+			tunneled = append(tunneled, op)
+		}
+		nodes = append(nodes, op)
+	}
+	return tunneled, nodes
+}
+
+// iface returns the configured interface, or the one holding the InternalIP of the node
+func (r *ReconcileHostGW) iface(node *v1.Node) (*net.Interface, error) {
+	if r.ifaceName != "" {
+		iface, err := net.InterfaceByName(r.ifaceName)
+		if err != nil {
+			return nil, fmt.Errorf("get interface %s: %v", r.ifaceName, err)
+		}
+		return iface, nil
+	}
+	nodeIP := internalIP(node)
+	if nodeIP == nil {
+		return nil, fmt.Errorf("node %s has no IPv4 InternalIP", node.Name)
+	}
+	iface, err := ip.GetInterfaceByIP(nodeIP)
+	if err != nil {
+		return nil, fmt.Errorf("get interface of node ip %s: %v", nodeIP, err)
+	}
+	return iface, nil
+}
+
+// syncKernelRoutes replaces the routes to host-gw peers and deletes the other routes
+// owned by the agent
+func syncKernelRoutes(ctx context.Context, iface *net.Interface, peers []*Peer) error {
+	logger := klog.FromContext(ctx)
+	desired := make(map[string]*netlink.Route)
+	for _, p := range peers {
+		if p.Path != PathHostGW {
+			continue
+		}
+		for _, cidr := range p.PodCIDRs {
+			desired[cidr.String()] = &netlink.Route{
+				LinkIndex: iface.Index,
+				Dst:       cidr,
+				Gw:        p.IP,
+				Protocol:  routeProtocol,
+			}
+		}
+	}
+
+	existing, err := netlink.RouteList(nil, syscall.AF_INET)
+	if err != nil {
+		return fmt.Errorf("list kernel routes: %v", err)
+	}
+	var errs []string
+	for i := range existing {
+		route := existing[i]
+		if route.Protocol != routeProtocol || route.Dst == nil {
+			continue
+		}
+		if want, ok := desired[route.Dst.String()]; ok && want.Gw.Equal(route.Gw) && want.LinkIndex == route.LinkIndex {
+			delete(desired, route.Dst.String())
+			continue
+		}
+		if _, ok := desired[route.Dst.String()]; ok {
+			// replaced below
+			continue
+		}
+		if err := netlink.RouteDel(&route); err != nil {
+			errs = append(errs, fmt.Sprintf("delete route %s via %s: %v", route.Dst, route.Gw, err))
+			continue
+		}
+		logger.Info("Withdrew host-gw route", "cidr", route.Dst.String(), "gateway", route.Gw.String())
+	}
+	for _, route := range desired {
+		if err := netlink.RouteReplace(route); err != nil {
+			errs = append(errs, fmt.Sprintf("add route %s via %s: %v", route.Dst, route.Gw, err))
+			continue
+		}
+		logger.Info("Added host-gw route", "cidr", route.Dst.String(), "gateway", route.Gw.String(), "interface", iface.Name)
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("sync host-gw routes: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// report logs path changes, updates the peer metrics and lists the host-gw and
+// overlay peers in the annotations of the local node
+func (r *ReconcileHostGW) report(ctx context.Context, local *v1.Node, peers []*Peer) {
+	logger := klog.FromContext(ctx)
+	counts := map[Path]int{PathVPC: 0, PathHostGW: 0, PathOverlay: 0, PathNone: 0}
+	paths := make(map[string]Path, len(peers))
+	byPath := make(map[Path][]string)
+
+	r.lock.Lock()
+	for _, p := range peers {
+		counts[p.Path]++
+		paths[p.Name] = p.Path
+		byPath[p.Path] = append(byPath[p.Path], p.Name)
+		if previous, ok := r.paths[p.Name]; !ok || previous != p.Path {
+			logger.Info("Peer path changed", "peer", p.Name, "peerIP", p.IP.String(), "previous", previous, "path", p.Path)
+		}
+	}
+	r.paths = paths
+	r.lock.Unlock()
+
+	for path, n := range counts {
+		metric.HostGWPeers.WithLabelValues(string(path)).Set(float64(n))
+	}
+
+	annotations := map[string]string{
+		NodeAnnotationHostGWPeersKey:  joinSorted(byPath[PathHostGW]),
+		NodeAnnotationOverlayPeersKey: joinSorted(byPath[PathOverlay]),
+	}
+	changed := false
+	for k, v := range annotations {
+		if local.Annotations[k] != v {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	getter := func(obj runtime.Object) (client.Object, error) {
+		n, ok := obj.(*v1.Node)
+		if !ok {
+			return nil, fmt.Errorf("expect node, got %T", obj)
+		}
+		for k, v := range annotations {
+			if v == "" {
+				delete(n.Annotations, k)
+				continue
+			}
+			if n.Annotations == nil {
+				n.Annotations = make(map[string]string)
+			}
+			n.Annotations[k] = v
+		}
+		return n, nil
+	}
+	if err := helper.PatchM(r.client, local.DeepCopy(), getter, helper.PatchSpec); err != nil {
+		logger.Error(err, "Failed to record fallback peers on node")
+	}
+}
+
+func joinSorted(names []string) string {
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,38 @@
+package hostgw
+
+import (
+	"net"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/overlay"
+)
+
+func peerNames(peers []overlay.Peer) []string {
+	var names []string
+	for _, p := range peers {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestOverlayPeersOneSided(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/24")
+	// only the vpc route of the local node is missing: the peer reaches it through
+	// the tunnel, while the local node reaches the peer over the vpc
+	peer := PeerOf(newNode("10.0.1.3", []string{"172.16.1.0/24"}, "172.16.1.0/24", v1.ConditionFalse), subnet)
+	if peer.Path != PathVPC {
+		t.Fatalf("path of the peer = %s, want %s", peer.Path, PathVPC)
+	}
+	missing := PeerOf(newNode("10.0.2.3", []string{"172.16.2.0/24"}, "", v1.ConditionTrue), subnet)
+	missing.Path = PathOverlay
+
+	tunneled, nodes := overlayPeers([]*Peer{peer, missing})
+	if got := peerNames(tunneled); len(got) != 1 || got[0] != missing.Name {
+		t.Errorf("tunneled peers = %v, want [%s]", got, missing.Name)
+	}
+	if got := peerNames(nodes); len(got) != 2 || got[0] != peer.Name || got[1] != missing.Name {
+		t.Errorf("accepted peers = %v, want [%s %s]", got, peer.Name, missing.Name)
+	}
+}
@@ -0,0 +1,98 @@
+// Package hostgw programs kernel routes to the pod CIDRs of peer nodes in the same
+// subnet while their vpc routes are missing, like the flannel host-gw backend.
+package hostgw
+
+import (
+	"net"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/annotation"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+)
+
+// Path is how the pod traffic to a peer node is routed
+type Path string
+
+const (
+	// PathVPC the vpc route of the peer is confirmed
+	PathVPC Path = "vpc"
+	// PathHostGW the pod CIDRs of the peer are routed via its node ip on the local subnet
+	PathHostGW Path = "host-gw"
+	// PathOverlay the pod CIDRs of the peer are tunneled to its node ip over UDP
+	PathOverlay Path = "overlay"
+	// PathNone the peer has no vpc route and no fallback applies
+	PathNone Path = "none"
+)
+
+// Peer is another node and the path its pod CIDRs are reached over
+type Peer struct {
+	Name     string
+	IP       net.IP
+	PodCIDRs []*net.IPNet
+	Path     Path
+}
+
+// CloudRouteConfirmed reports whether the route controller created the vpc routes of
+// node, that is it published the routed CIDRs in the route-cidr annotation and set the
+// NetworkUnavailable condition to false. The annotation is not compared with the pod
+// CIDRs of the spec, the controller routes only the first of them unless routes are
+// aggregated, and the calico IPAM blocks with the calico-ipam pod CIDR source.
+func CloudRouteConfirmed(node *v1.Node) bool {
+	cond := helper.GetNodeCondition(node, v1.NodeNetworkUnavailable)
+	if cond == nil || cond.Status != v1.ConditionFalse {
+		return false
+	}
+	for _, s := range strings.Split(node.Annotations[annotation.NodeAnnotationRouteCIDRKey], ",") {
+		if _, _, err := net.ParseCIDR(s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerOf returns node as a peer of a node in subnet, nil if it has no InternalIP or pod CIDR
+func PeerOf(node *v1.Node, subnet *net.IPNet) *Peer {
+	ip := internalIP(node)
+	podCidrs := podCIDRs(node)
+	if ip == nil || len(podCidrs) == 0 {
+		return nil
+	}
+	p := &Peer{Name: node.Name, IP: ip, PodCIDRs: podCidrs}
+	switch {
+	case CloudRouteConfirmed(node):
+		p.Path = PathVPC
+	case subnet != nil && subnet.Contains(ip):
+		p.Path = PathHostGW
+	default:
+		p.Path = PathNone
+	}
+	return p
+}
+
+func podCIDRs(node *v1.Node) []*net.IPNet {
+	var cidrs []*net.IPNet
+	seen := make(map[string]bool)
+	for _, s := range append(node.Spec.PodCIDRs, node.Spec.PodCIDR) {
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		if _, n, err := net.ParseCIDR(s); err == nil && n.IP.To4() != nil {
+			cidrs = append(cidrs, n)
+		}
+	}
+	return cidrs
+}
+
+func internalIP(node *v1.Node) net.IP {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			if ip := net.ParseIP(addr.Address).To4(); ip != nil {
+				return ip
+			}
+		}
+	}
+	return nil
+}
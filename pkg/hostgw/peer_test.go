@@ -0,0 +1,96 @@
+package hostgw
+
+import (
+	"net"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/annotation"
+)
+
+func newNode(ip string, podCidrs []string, routeCidr string, networkUnavailable v1.ConditionStatus) *v1.Node {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: ip, Annotations: map[string]string{}},
+		Spec:       v1.NodeSpec{PodCIDRs: podCidrs},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: ip}},
+		},
+	}
+	if len(podCidrs) != 0 {
+		node.Spec.PodCIDR = podCidrs[0]
+	}
+	if routeCidr != "" {
+		node.Annotations[annotation.NodeAnnotationRouteCIDRKey] = routeCidr
+	}
+	if networkUnavailable != "" {
+		node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeNetworkUnavailable, Status: networkUnavailable}}
+	}
+	return node
+}
+
+func TestPeerOf(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/24")
+	tests := []struct {
+		name string
+		node *v1.Node
+		path Path
+	}{
+		{
+			name: "vpc route confirmed",
+			node: newNode("10.0.0.3", []string{"172.16.1.0/24"}, "172.16.1.0/24", v1.ConditionFalse),
+			path: PathVPC,
+		},
+		{
+			name: "aggregated vpc route covers the pod cidrs",
+			node: newNode("10.0.0.3", []string{"172.16.0.0/24", "172.16.1.0/24"}, "172.16.0.0/23", v1.ConditionFalse),
+			path: PathVPC,
+		},
+		{
+			name: "missing vpc route in the subnet",
+			node: newNode("10.0.0.3", []string{"172.16.1.0/24"}, "", v1.ConditionTrue),
+			path: PathHostGW,
+		},
+		{
+			name: "network unavailable although annotated",
+			node: newNode("10.0.0.3", []string{"172.16.1.0/24"}, "172.16.1.0/24", v1.ConditionTrue),
+			path: PathHostGW,
+		},
+		{
+			name: "first of multiple pod cidrs routed",
+			node: newNode("10.0.0.3", []string{"172.16.0.0/24", "172.16.8.0/24"}, "172.16.0.0/24", v1.ConditionFalse),
+			path: PathVPC,
+		},
+		{
+			name: "calico ipam blocks routed",
+			node: newNode("10.0.0.3", []string{"172.16.1.0/24"}, "10.244.3.64/26,10.244.7.0/26", v1.ConditionFalse),
+			path: PathVPC,
+		},
+		{
+			name: "annotated without network condition",
+			node: newNode("10.0.0.3", []string{"172.16.1.0/24"}, "172.16.1.0/24", ""),
+			path: PathHostGW,
+		},
+		{
+			name: "missing vpc route outside the subnet",
+			node: newNode("10.0.1.3", []string{"172.16.1.0/24"}, "", ""),
+			path: PathNone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := PeerOf(tt.node, subnet)
+			if p == nil {
+				t.Fatal("PeerOf returned nil")
+			}
+			if p.Path != tt.path {
+				t.Errorf("path = %s, want %s", p.Path, tt.path)
+			}
+		})
+	}
+
+	if p := PeerOf(newNode("10.0.0.3", nil, "", ""), subnet); p != nil {
+		t.Errorf("PeerOf node without pod cidr = %+v, want nil", p)
+	}
+}
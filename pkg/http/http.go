@@ -8,7 +8,7 @@ import (
 	"net/http"
 	"strings"
 
-	log "k8s.io/klog"
+	"k8s.io/klog/v2"
 
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util"
 )
@@ -38,7 +38,7 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 				continue
 			}
 			if err := modifier.Modify(req); err != nil {
-				log.Errorf("modifier modify request error :%v", err)
+				klog.ErrorS(err, "Failed to modify request")
 				return nil, err
 			}
 		}
@@ -51,7 +51,7 @@ func (c *Client) PostJson(url string, v ...interface{}) ([]byte, error) {
 	if len(v) > 0 {
 		data, err := json.Marshal(v[0])
 		if err != nil {
-			log.Errorf("json marshal error :%v", err)
+			klog.ErrorS(err, "Failed to marshal json body")
 			return nil, err
 		}
 		reader = bytes.NewReader(data)
@@ -61,7 +61,7 @@ func (c *Client) PostJson(url string, v ...interface{}) ([]byte, error) {
 
 func (c *Client) PostForm(url string, paramMap map[string]string) ([]byte, error) {
 	param := util.Encode(paramMap)
-	log.Infof("post form param :%v", param)
+	klog.V(4).InfoS("Post form", "url", url, "param", param)
 	var reader io.Reader
 	if len(param) > 0 {
 		reader = strings.NewReader(param)
@@ -72,7 +72,7 @@ func (c *Client) PostForm(url string, paramMap map[string]string) ([]byte, error
 func (c *Client) post(url string, contentType string, body io.Reader) ([]byte, error) {
 	req, err := http.NewRequest(http.MethodPost, url, body)
 	if err != nil {
-		log.Errorf("post json, create request error :%v", err)
+		klog.ErrorS(err, "Failed to create post request", "url", url)
 		return nil, err
 	}
 	req.Header.Set("Content-Type", contentType)
@@ -81,21 +81,21 @@ func (c *Client) post(url string, contentType string, body io.Reader) ([]byte, e
 }
 
 func (c *Client) DoRequest(req *http.Request) ([]byte, error) {
-	log.Infof("http request info :%v", *req)
+	klog.V(4).InfoS("Http request", "method", req.Method, "url", req.URL.String())
 	resp, err := c.Do(req)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
 	if err != nil {
-		log.Errorf("do request error :%v", err)
+		klog.ErrorS(err, "Http request failed", "url", req.URL.String())
 		return nil, err
 	}
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Errorf("read body error :%v", data)
+		klog.ErrorS(err, "Failed to read response body", "url", req.URL.String())
 		return nil, err
 	}
-	log.Infof("http response body :%v", string(data))
+	klog.V(4).InfoS("Http response", "url", req.URL.String(), "statusCode", resp.StatusCode, "body", string(data))
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		return nil, &Error{
 			Code:    resp.StatusCode,
@@ -17,12 +17,15 @@ import (
 
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/random"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/tracing"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/ext"
-	"k8s.io/klog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
 )
 
 const (
@@ -201,14 +204,14 @@ func (kop *KopClient) Go() (body []byte, err error) {
 		kop.backoff.Jitter, kop.backoff.Steps, kop.backoff.Cap, func() error {
 			body, err = kop.send()
 			if err != nil {
-				klog.Warningf("retry with backoff kop send err: %v", err)
+				klog.FromContext(kop.ctx).Info("Kop request failed, retrying with backoff", "action", kop.getAction(), "err", err)
 				return err
 			}
 
 			return nil
 		}, shouldRetry, nil)
 	if err != nil {
-		klog.Warningf("retry with backoff send err: %v", err)
+		klog.FromContext(kop.ctx).Info("Kop request failed after retries", "action", kop.getAction(), "err", err)
 		return nil, err
 	}
 
@@ -216,11 +219,16 @@ func (kop *KopClient) Go() (body []byte, err error) {
 }
 
 func (kop *KopClient) send() ([]byte, error) {
-	var span opentracing.Span = nil
-	klog.V(9).Infof("req url: %s %s body: %v", kop.method, kop.url, kop.body)
 	// var body map[string]interface{}
 	requ, err := http.NewRequest(kop.method, kop.url, nil)
 	xRequestId := kop.genRequestId()
+	action := kop.getAction()
+	logValues := []interface{}{"requestID", xRequestId, "action", action}
+	for _, attr := range tracing.Attributes(kop.ctx) {
+		logValues = append(logValues, string(attr.Key), attr.Value.Emit())
+	}
+	logger := klog.FromContext(kop.ctx).WithValues(logValues...)
+	logger.V(9).Info("Kop request", "method", kop.method, "url", kop.url, "body", kop.body)
 
 	switch kop.method {
 	case POST:
@@ -250,11 +258,11 @@ func (kop *KopClient) send() ([]byte, error) {
 		body := strings.NewReader(kop.body.String())
 		requ, err = http.NewRequest(kop.method, kop.url, body)
 		if err != nil {
-			klog.Error(err)
+			logger.Error(err, "Failed to create kop request")
 			return nil, err
 		}
 		if _, err := kop.s.Sign(requ, getSeek(body), kop.servername, kop.region, time.Now()); err != nil {
-			klog.Error(err)
+			logger.Error(err, "Failed to sign kop request")
 			return nil, err
 		}
 	}
@@ -270,39 +278,34 @@ func (kop *KopClient) send() ([]byte, error) {
 		requ.Header.Set(k, v)
 	}
 
-	if kop.ctx != nil {
-		span, _ = opentracing.StartSpanFromContext(kop.ctx, kop.getServerName())
-		span.SetBaggageItem("X-Request-ID", xRequestId)
-		defer span.Finish()
-
-		ext.SpanKindRPCClient.Set(span)
-		ext.HTTPUrl.Set(span, kop.url)
-		ext.HTTPMethod.Set(span, kop.method)
-		span.Tracer().Inject(
-			span.Context(),
-			opentracing.HTTPHeaders,
-			opentracing.HTTPHeadersCarrier(requ.Header),
-		)
-	} else {
-		klog.V(9).Infof("context is nil, unable to propagation the tracing info")
-	}
-
-	klog.V(9).Infof("req url: %s %s body: %v header %v", kop.method, kop.url, kop.body, requ.Header)
+	ctx, span := tracing.Start(kop.ctx, fmt.Sprintf("%s %s", kop.getServerName(), action),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.AttrAction.String(action),
+			tracing.AttrRequestId.String(xRequestId),
+			semconv.HTTPMethod(kop.method),
+			semconv.HTTPURL(kop.url),
+		),
+	)
+	defer span.End()
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(requ.Header))
+
+	logger.V(9).Info("Kop request headers", "header", requ.Header)
+	start := time.Now()
 	resp, err := kop.client.Do(requ)
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "Kop request failed")
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 
-	if span != nil {
-		span.LogKV("http.status_code", resp.StatusCode)
-		span.LogKV("http.response", string(data))
-	}
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
 
 	if resp.StatusCode != 200 && resp.StatusCode != 201 && resp.StatusCode != 202 && resp.StatusCode != 204 {
 		e := util.ErrorResponse{
@@ -311,14 +314,17 @@ func (kop *KopClient) send() ([]byte, error) {
 		}
 
 		respErr := &util.Error{
-			KopError: e,
+			KopError:  e,
+			RequestId: xRequestId,
 		}
-		klog.Error(respErr.Error())
+		logger.Error(respErr, "Kop request returned error", "statusCode", resp.StatusCode, "duration", time.Since(start))
+		tracing.RecordError(span, respErr)
 
 		return nil, respErr
 	}
 
 	defer resp.Body.Close()
+	logger.V(4).Info("Kop request succeeded", "statusCode", resp.StatusCode, "duration", time.Since(start))
 
 	// json.Unmarshal([]byte(data), &body)
 	// result := fmt.Sprintln(body[kop.resource])
@@ -340,6 +346,15 @@ func (kop *KopClient) getServerName() string {
 	}
 }
 
+// getAction returns the kop api action of the request url
+func (kop *KopClient) getAction() string {
+	u, err := url.Parse(kop.url)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("Action")
+}
+
 type TimeoutError interface {
 	error
 	Timeout() bool // Is the error a timeout?
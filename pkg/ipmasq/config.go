@@ -0,0 +1,83 @@
+// Package ipmasq renders the NonMasqueradeCIDRs of the ip-masq-agent config.
+package ipmasq
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+)
+
+const (
+	// ConfigKey is the key of the agent config in the ip-masq-agent ConfigMap
+	ConfigKey = "config"
+
+	// nonMasqueradeCIDRsKey is the config field written when the config has none,
+	// the agent matches field names case insensitively
+	nonMasqueradeCIDRsKey = "nonMasqueradeCIDRs"
+)
+
+// NonMasqueradeCIDRs summarizes the IPv4 CIDRs of all groups into the smallest sorted
+// set of CIDRs. IPv6 CIDRs are ignored.
+func NonMasqueradeCIDRs(groups ...[]string) ([]string, error) {
+	var nets []ip.IP4Net
+	for _, group := range groups {
+		for _, s := range group {
+			if s == "" || strings.Contains(s, ":") {
+				continue
+			}
+			n, err := ip.ParseIP4Net(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cidr %q: %v", s, err)
+			}
+			nets = append(nets, n)
+		}
+	}
+	cidrs := make([]string, 0, len(nets))
+	for _, n := range ip.Summarize(nets) {
+		cidrs = append(cidrs, n.String())
+	}
+	return cidrs, nil
+}
+
+// Render sets the NonMasqueradeCIDRs of the agent config to cidrs and keeps all other
+// fields. The config is JSON or YAML, the result is JSON. changed is false when the
+// config already has exactly cidrs.
+func Render(config string, cidrs []string) (rendered string, changed bool, err error) {
+	fields := make(map[string]interface{})
+	if strings.TrimSpace(config) != "" {
+		if err := yaml.Unmarshal([]byte(config), &fields); err != nil {
+			return "", false, fmt.Errorf("invalid ip-masq-agent config: %v", err)
+		}
+	}
+	key := nonMasqueradeCIDRsKey
+	for k := range fields {
+		if strings.EqualFold(k, nonMasqueradeCIDRsKey) {
+			key = k
+			break
+		}
+	}
+	if current, ok := fields[key]; ok && reflect.DeepEqual(current, toInterfaces(cidrs)) {
+		return config, false, nil
+	}
+	fields[key] = cidrs
+	// encoding/json sorts map keys, so the value is stable
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return "", false, err
+	}
+	return string(b), true, nil
+}
+
+// toInterfaces converts cidrs to the type a decoded config list has
+func toInterfaces(cidrs []string) []interface{} {
+	s := make([]interface{}, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		s = append(s, cidr)
+	}
+	return s
+}
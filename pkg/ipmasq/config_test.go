@@ -0,0 +1,69 @@
+package ipmasq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNonMasqueradeCIDRs(t *testing.T) {
+	vpc := []string{"10.0.0.0/16", "172.16.0.0/16"}
+	pods := []string{"192.168.0.0/24", "192.168.1.0/24", "192.168.3.0/24", "fd00::/64", ""}
+	extra := []string{"10.0.5.0/24", "100.64.0.0/10"}
+	got, err := NonMasqueradeCIDRs(vpc, pods, extra)
+	if err != nil {
+		t.Fatalf("NonMasqueradeCIDRs() error = %v", err)
+	}
+	want := []string{"10.0.0.0/16", "100.64.0.0/10", "172.16.0.0/16", "192.168.0.0/23", "192.168.3.0/24"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NonMasqueradeCIDRs() = %v, want %v", got, want)
+	}
+	if _, err := NonMasqueradeCIDRs([]string{"bad"}); err == nil {
+		t.Errorf("NonMasqueradeCIDRs() with invalid cidr, want error")
+	}
+}
+
+func TestRender(t *testing.T) {
+	cidrs := []string{"10.0.0.0/16", "192.168.0.0/16"}
+	tests := []struct {
+		name    string
+		config  string
+		want    string
+		changed bool
+		wantErr bool
+	}{
+		{
+			name:    "placeholders of the manifest",
+			config:  `{"NonMasqueradeCIDRs":["___POD_CIDR___","___VPC_CIDR___"],"MasqLinkLocal":true,"ResyncInterval":"1m0s"}`,
+			want:    `{"MasqLinkLocal":true,"NonMasqueradeCIDRs":["10.0.0.0/16","192.168.0.0/16"],"ResyncInterval":"1m0s"}`,
+			changed: true,
+		},
+		{
+			name:   "up to date",
+			config: `{"NonMasqueradeCIDRs":["10.0.0.0/16","192.168.0.0/16"],"MasqLinkLocal":true}`,
+			want:   `{"NonMasqueradeCIDRs":["10.0.0.0/16","192.168.0.0/16"],"MasqLinkLocal":true}`,
+		},
+		{
+			name:    "yaml",
+			config:  "nonMasqueradeCIDRs:\n  - 10.0.0.0/8\nmasqLinkLocal: false\n",
+			want:    `{"masqLinkLocal":false,"nonMasqueradeCIDRs":["10.0.0.0/16","192.168.0.0/16"]}`,
+			changed: true,
+		},
+		{
+			name:    "empty",
+			want:    `{"nonMasqueradeCIDRs":["10.0.0.0/16","192.168.0.0/16"]}`,
+			changed: true,
+		},
+		{name: "invalid", config: `{"NonMasqueradeCIDRs":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := Render(tt.config, cidrs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || changed != tt.changed {
+				t.Errorf("Render() = %s, %v, want %s, %v", got, changed, tt.want, tt.changed)
+			}
+		})
+	}
+}
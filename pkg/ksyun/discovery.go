@@ -0,0 +1,108 @@
+package ksyun
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	log "k8s.io/klog/v2"
+
+	openstack_client "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/config"
+	openstackTypes "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/types"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metadata"
+)
+
+const (
+	// EnvHostIP is the ip of the host the controller runs on, set through the downward api
+	EnvHostIP = "HOST_IP"
+
+	discoveryTimeout       = 30 * time.Second
+	metadataTimeout        = 2 * time.Second
+	metadataRetries        = 2
+	metadataRetryInterval  = time.Second
+	sourceConfig           = "config"
+	sourceMetadata         = "metadata"
+	sourceDescribeInstance = "describeInstances"
+)
+
+// DiscoverVpc fills in the vpc id and region left out of the net config, see discoverVpc.
+// It calls the metadata service and the cloud api, so it is run once logging is set
+// up and before any controller starts, the alert labels are updated with the result.
+func DiscoverVpc(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+	if err := discoverVpc(ctx, Cfg); err != nil {
+		return err
+	}
+	Alerts.SetLabels(alertLabels(Cfg))
+	return nil
+}
+
+// discoverVpc fills in the vpc id and region left out of the net config. The region is
+// read from the metadata service. The vpc id is read from the metadata service, or from
+// the instance the controller runs on, found by its metadata instance id or host ip.
+func discoverVpc(ctx context.Context, c *config.Config) error {
+	if c.VpcID != "" && c.Region != "" {
+		log.InfoS("Using vpc from net config", "vpcID", c.VpcID, "region", c.Region, "source", sourceConfig)
+		return nil
+	}
+	if c.MetadataURL == "" {
+		c.MetadataURL = config.DefaultMetadataURL
+	}
+	md := metadata.NewClient(c.MetadataURL, metadataTimeout, metadataRetries, metadataRetryInterval)
+
+	source := sourceConfig
+	if c.Region == "" {
+		region, err := md.Get(ctx, "placement/region")
+		if err != nil {
+			return fmt.Errorf("region is not set in net config and can not be read from metadata service %s: %v", c.MetadataURL, err)
+		}
+		c.Region, source = region, sourceMetadata
+	}
+	log.InfoS("Found region", "region", c.Region, "source", source)
+
+	source = sourceConfig
+	if c.VpcID == "" {
+		vpcId, err := md.Get(ctx, "vpc-id")
+		if err == nil && vpcId != "" {
+			c.VpcID, source = vpcId, sourceMetadata
+		} else {
+			log.InfoS("Failed to read vpc id from metadata service, describing the instance of the controller", "err", getErrorString(err))
+			if c.VpcID, err = describeOwnVpc(ctx, c, md); err != nil {
+				return fmt.Errorf("vpc_id is not set in net config and can not be discovered: %v", err)
+			}
+			source = sourceDescribeInstance
+		}
+	}
+	log.InfoS("Found vpc", "vpcID", c.VpcID, "source", source)
+	return nil
+}
+
+// describeOwnVpc returns the vpc of the instance the controller runs on
+func describeOwnVpc(ctx context.Context, c *config.Config, md *metadata.Client) (string, error) {
+	args := &openstackTypes.InstanceArgs{InstanceType: defaultRouteType}
+	if instanceId, err := md.Get(ctx, "instance-id"); err == nil && instanceId != "" {
+		args.InstanceId = instanceId
+	} else if hostIP := os.Getenv(EnvHostIP); hostIP != "" {
+		args.InstancePrivateIP = hostIP
+	} else {
+		return "", fmt.Errorf("neither the instance id from metadata service nor env %s is available", EnvHostIP)
+	}
+
+	s, err := openstack_client.Server(ctx, c)
+	if err != nil {
+		return "", err
+	}
+	instance, err := s.DescribeInstances(args)
+	if err != nil {
+		return "", err
+	}
+	vpcId := instance.VpcId()
+	if vpcId == "" {
+		return "", fmt.Errorf("instance %s has no vpc", instance.Id)
+	}
+	log.InfoS("Described the instance of the controller", "instanceID", instance.Id, "privateIP", args.InstancePrivateIP, "vpcID", vpcId)
+	return vpcId, nil
+}
@@ -0,0 +1,88 @@
+package ksyun
+
+import (
+	"context"
+	"testing"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/fakekop"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metadata/fakemetadata"
+)
+
+func TestDiscoverVpc(t *testing.T) {
+	tests := []struct {
+		name     string
+		vpcId    string
+		region   string
+		metadata map[string]string
+		hostIP   string
+		// wantVpc is empty when discovery fails
+		wantVpc      string
+		wantRegion   string
+		wantDescribe bool
+	}{
+		{
+			name: "config", vpcId: "vpc-config", region: "cn-config",
+			metadata: map[string]string{"vpc-id": "vpc-md", "placement/region": "cn-md"},
+			wantVpc:  "vpc-config", wantRegion: "cn-config",
+		},
+		{
+			name:     "metadata",
+			metadata: map[string]string{"vpc-id": "vpc-md", "placement/region": "cn-md"},
+			wantVpc:  "vpc-md", wantRegion: "cn-md",
+		},
+		{
+			name: "region from metadata, vpc from config", vpcId: "vpc-config",
+			metadata: map[string]string{"vpc-id": "vpc-md", "placement/region": "cn-md"},
+			wantVpc:  "vpc-config", wantRegion: "cn-md",
+		},
+		{
+			name:     "instance of metadata instance id",
+			metadata: map[string]string{"placement/region": "cn-md", "instance-id": "i-controller"},
+			wantVpc:  "vpc-kop", wantRegion: "cn-md", wantDescribe: true,
+		},
+		{
+			name:     "instance of host ip",
+			metadata: map[string]string{"placement/region": "cn-md"}, hostIP: "10.0.0.3",
+			wantVpc: "vpc-kop", wantRegion: "cn-md", wantDescribe: true,
+		},
+		{
+			name:     "no instance",
+			metadata: map[string]string{"placement/region": "cn-md"},
+		},
+		{
+			name:     "unknown host ip",
+			metadata: map[string]string{"placement/region": "cn-md"}, hostIP: "10.0.0.9",
+			wantDescribe: true,
+		},
+		{
+			name:     "no region",
+			metadata: map[string]string{"vpc-id": "vpc-md"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := fakemetadata.NewServer(tt.metadata)
+			defer md.Close()
+			kop := fakekop.NewServer("vpc-kop", "10.0.0.0/16")
+			defer kop.Close()
+			kop.AddInstance("i-controller", "10.0.0.3")
+			t.Setenv(EnvHostIP, tt.hostIP)
+
+			c := kop.Config()
+			c.VpcID, c.Region, c.MetadataURL = tt.vpcId, tt.region, md.BaseURL()
+			err := discoverVpc(context.Background(), c)
+			if (err != nil) != (tt.wantVpc == "") {
+				t.Fatalf("discoverVpc() error = %v, want vpc %q", err, tt.wantVpc)
+			}
+			if err == nil && (c.VpcID != tt.wantVpc || c.Region != tt.wantRegion) {
+				t.Errorf("discoverVpc() = %s in %s, want %s in %s", c.VpcID, c.Region, tt.wantVpc, tt.wantRegion)
+			}
+			if tt.vpcId != "" && md.Requests("vpc-id") != 0 {
+				t.Errorf("vpc id of the config was looked up in the metadata service")
+			}
+			if described := kop.Requests("DescribeInstances") > 0; described != tt.wantDescribe {
+				t.Errorf("DescribeInstances called = %v, want %v", described, tt.wantDescribe)
+			}
+		})
+	}
+}
@@ -2,17 +2,24 @@ package ksyun
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
-	"golang.org/x/net/context"
+	"context"
 	log "k8s.io/klog/v2"
 
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/alert"
 	openstack_client "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client"
-	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/alarm"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/config"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/neutron"
 	openstackTypes "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/types"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/utils"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/model"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/health"
 
 	"github.com/kingsoftcloud/aksk-provider/env"
 	"github.com/kingsoftcloud/aksk-provider/file"
@@ -26,14 +33,47 @@ const (
 var (
 	DefaultCipherKey string
 	Cfg              *config.Config
-	err              error
+
+	// Alerts groups failures of cloud api calls and notifies the configured sinks
+	Alerts *alert.Manager
 )
 
-func init() {
-	Cfg, err = GetNeutronConfig()
+// Init loads the net config from env NET_CONF and creates the alert manager. The
+// controller calls it once before DiscoverVpc, tests set Cfg and Alerts themselves.
+func Init() error {
+	c, err := GetNeutronConfig()
+	if err != nil {
+		return fmt.Errorf("get neutron config: %v", err)
+	}
+	alerts, err := newAlertManager(c)
+	if err != nil {
+		return fmt.Errorf("create alert manager: %v", err)
+	}
+	Cfg, Alerts = c, alerts
+	return nil
+}
+
+func newAlertManager(c *config.Config) (*alert.Manager, error) {
+	dispatcher, err := alert.NewDispatcher(c)
 	if err != nil {
-		log.Error(err, "failed to get neutron config")
-		os.Exit(1)
+		return nil, err
+	}
+	var escalateAfter time.Duration
+	if c.Alert != nil && c.Alert.EscalateAfter != "" {
+		escalateAfter, err = time.ParseDuration(c.Alert.EscalateAfter)
+		if err != nil {
+			return nil, fmt.Errorf("parse alert escalate_after %q error: %v", c.Alert.EscalateAfter, err)
+		}
+	}
+	return alert.NewManager(dispatcher, escalateAfter, alertLabels(c)), nil
+}
+
+// alertLabels are added to every alert
+func alertLabels(c *config.Config) map[string]string {
+	return map[string]string{
+		"region":  c.Region,
+		"cluster": c.ClusterUUID,
+		"vpc":     c.VpcID,
 	}
 }
 
@@ -49,69 +89,68 @@ func GetInstanceIdFromIP(ctx context.Context, privateIP string) (string, error)
 		InstancePrivateIP: privateIP,
 	}
 
-	log.V(9).Infof("Check ksc nova instance args: %v \n", getInstances)
+	log.FromContext(ctx).V(9).Info("Describe instance by private ip", "args", getInstances)
 
 	result, err := s.DescribeInstances(getInstances)
 	if err != nil {
-		log.Errorf("Error get instance %s: %s .\n", privateIP, getErrorString(err))
-
-		if Cfg.AlarmEnabled {
-			mesg := openstackTypes.AlarmArgs{
-				Name:     "GetInstanceIdFromIP",
-				Priority: "2",
-				Product:  alarm.DefaultProduct,
-				NoDeal:   "1",
-				Content:  fmt.Sprintf("region: %s, cluster: %s, plugin: vpc-route-controller,  error: %s", Cfg.Region, Cfg.ClusterUUID, err.Error()),
-			}
-
-			alarmClient := openstack_client.Alarm(ctx, Cfg)
-			alarmClient.CreateAlarm(mesg)
-		}
+		log.FromContext(ctx).Error(err, "Failed to get instance", "privateIP", privateIP, "requestID", util.RequestIdOf(err))
+
+		notifyFailure(ctx, "GetInstanceIdFromIP", err)
 
 		return "", err
 	}
+	notifySuccess(ctx, "GetInstanceIdFromIP")
 	return result.Id, nil
 }
 
 func ListRoutes(ctx context.Context) ([]*model.Route, error) {
+	routes, err := listRoutes(ctx, defaultRouteType)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Route, 0, len(routes))
+	for _, r := range routes {
+		if r.DestinationCIDR == "0.0.0.0/0" {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// ListRouteTable lists every entry of the vpc route table, whatever its type,
+// including the default route. Each entry counts against the route table quota.
+func ListRouteTable(ctx context.Context) ([]*model.Route, error) {
+	return listRoutes(ctx, "")
+}
+
+// listRoutes lists the routes of routeType, all routes if it is empty
+func listRoutes(ctx context.Context, routeType string) ([]*model.Route, error) {
 	var result []*model.Route
-	r, err := openstack_client.Route(ctx, Cfg)
+	r, err := routeClient(ctx)
 	if err != nil {
 		return result, err
 	}
 
 	getRoutes := &openstackTypes.RouteArgs{
 		DomainId:     Cfg.VpcID,
-		InstanceType: defaultRouteType,
+		InstanceType: routeType,
 	}
 
-	log.Infof("Check ksc vpc route args: %v \n", getRoutes)
+	log.FromContext(ctx).Info("List vpc routes", "args", getRoutes)
 
 	routes, err := r.ListRoutes(getRoutes)
+	health.RecordCloudCall(health.OpDescribeRoutes, err)
 	if err != nil {
-		log.Errorf("Error CheckRouteEntry: %s .\n", getErrorString(err))
-
-		if Cfg.AlarmEnabled {
-			mesg := openstackTypes.AlarmArgs{
-				Name:     "ListRoutes",
-				Priority: "2",
-				Product:  alarm.DefaultProduct,
-				NoDeal:   "1",
-				Content:  fmt.Sprintf("region: %s, cluster: %s, plugin: vpc-route-controller,  error: %s", Cfg.Region, Cfg.ClusterUUID, err.Error()),
-			}
-
-			alarmClient := openstack_client.Alarm(ctx, Cfg)
-			alarmClient.CreateAlarm(mesg)
-		}
+		log.FromContext(ctx).Error(err, "Failed to list routes", "vpcID", Cfg.VpcID, "requestID", util.RequestIdOf(err))
+
+		notifyFailure(ctx, "ListRoutes", err)
 
 		return result, err
 	}
+	notifySuccess(ctx, "ListRoutes")
 
 	for _, r := range routes {
-		if r.DestinationCIDR == "0.0.0.0/0" {
-			continue
-		}
-
 		gatewayId := ""
 		if len(r.NextHopset) != 0 {
 			gatewayId = r.NextHopset[0].GatewayId
@@ -129,7 +168,7 @@ func ListRoutes(ctx context.Context) ([]*model.Route, error) {
 }
 
 func FindRoute(ctx context.Context, cidr string) (*model.Route, error) {
-	r, err := openstack_client.Route(ctx, Cfg)
+	r, err := routeClient(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -140,27 +179,18 @@ func FindRoute(ctx context.Context, cidr string) (*model.Route, error) {
 		CidrBlock:    cidr,
 	}
 
-	log.Infof("Check ksc vpc route args: %v \n", getRoutes)
+	log.FromContext(ctx).Info("Find vpc route", "args", getRoutes)
 
 	routes, err := r.GetRoutes(getRoutes)
+	health.RecordCloudCall(health.OpDescribeRoutes, err)
 	if err != nil {
-		log.Errorf("Error CheckRouteEntry: %s .\n", getErrorString(err))
-
-		if Cfg.AlarmEnabled {
-			mesg := openstackTypes.AlarmArgs{
-				Name:     "FindRoute",
-				Priority: "2",
-				Product:  alarm.DefaultProduct,
-				NoDeal:   "1",
-				Content:  fmt.Sprintf("region: %s, cluster: %s, plugin: vpc-route-controller,  error: %s", Cfg.Region, Cfg.ClusterUUID, err.Error()),
-			}
-
-			alarmClient := openstack_client.Alarm(ctx, Cfg)
-			alarmClient.CreateAlarm(mesg)
-		}
+		log.FromContext(ctx).Error(err, "Failed to find route", "vpcID", Cfg.VpcID, "cidr", cidr, "requestID", util.RequestIdOf(err))
+
+		notifyFailure(ctx, "FindRoute", err)
 
 		return nil, err
 	}
+	notifySuccess(ctx, "FindRoute")
 
 	if len(routes) == 0 {
 		return nil, nil
@@ -180,7 +210,7 @@ func FindRoute(ctx context.Context, cidr string) (*model.Route, error) {
 }
 
 func DeleteRoute(ctx context.Context, cidr string) error {
-	r, err := openstack_client.Route(ctx, Cfg)
+	r, err := routeClient(ctx)
 	if err != nil {
 		return err
 	}
@@ -190,34 +220,24 @@ func DeleteRoute(ctx context.Context, cidr string) error {
 		return err
 	}
 	if route != nil {
-		log.Infof("vpc id %s delete route id: %s", Cfg.VpcID, route.RouteId)
+		log.FromContext(ctx).Info("Delete vpc route", "vpcID", Cfg.VpcID, "routeID", route.RouteId, "cidr", cidr)
 		if err := r.DeleteRoute(route.RouteId); err != nil {
-			log.Errorf("Error deleteRoute: %s . \n", getErrorString(err))
-
-			if Cfg.AlarmEnabled {
-				mesg := openstackTypes.AlarmArgs{
-					Name:     "DeleteRoute",
-					Priority: "2",
-					Product:  alarm.DefaultProduct,
-					NoDeal:   "1",
-					Content:  fmt.Sprintf("region: %s, cluster: %s, plugin: vpc-route-controller,  error: %s", Cfg.Region, Cfg.ClusterUUID, err.Error()),
-				}
-
-				alarmClient := openstack_client.Alarm(ctx, Cfg)
-				alarmClient.CreateAlarm(mesg)
-			}
-
-			return fmt.Errorf("Error deleteRoute: %s . \n", getErrorString(err))
+			log.FromContext(ctx).Error(err, "Failed to delete route", "vpcID", Cfg.VpcID, "routeID", route.RouteId, "requestID", util.RequestIdOf(err))
+
+			notifyFailure(ctx, "DeleteRoute", err)
+
+			return fmt.Errorf("Error deleteRoute: %w . \n", err)
 		}
+		notifySuccess(ctx, "DeleteRoute")
 	}
 
 	return nil
 }
 
 func CreateRoute(ctx context.Context, instanceId, cidr string) error {
-	log.Infof("begin to create route: vpc %s, instance %s, cidr %s", Cfg.VpcID, instanceId, cidr)
+	log.FromContext(ctx).Info("Begin to create route", "vpcID", Cfg.VpcID, "instanceID", instanceId, "cidr", cidr)
 
-	r, err := openstack_client.Route(ctx, Cfg)
+	r, err := routeClient(ctx)
 	if err != nil {
 		return err
 	}
@@ -231,21 +251,12 @@ func CreateRoute(ctx context.Context, instanceId, cidr string) error {
 
 	id, err := r.CreateRoute(createRoute)
 	if err != nil {
-		if Cfg.AlarmEnabled {
-			mesg := openstackTypes.AlarmArgs{
-				Name:     "CreateRoute",
-				Priority: "2",
-				Product:  alarm.DefaultProduct,
-				NoDeal:   "1",
-				Content:  fmt.Sprintf("region: %s, cluster: %s, plugin: vpc-route-controller,  error: %s", Cfg.Region, Cfg.ClusterUUID, err.Error()),
-			}
-
-			alarmClient := openstack_client.Alarm(ctx, Cfg)
-			alarmClient.CreateAlarm(mesg)
-		}
+		log.FromContext(ctx).Error(err, "Failed to create route", "vpcID", Cfg.VpcID, "instanceID", instanceId, "cidr", cidr, "requestID", util.RequestIdOf(err))
+		notifyFailure(ctx, "CreateRoute", err)
 
-		return fmt.Errorf("Error createRoute: %s . \n", getErrorString(err))
+		return fmt.Errorf("Error createRoute: %w . \n", err)
 	}
+	notifySuccess(ctx, "CreateRoute")
 
 	if err := r.WaitForAllRouteEntriesAvailable(id, 60); err != nil {
 		return fmt.Errorf("Error not found Route: %s . \n", getErrorString(err))
@@ -255,6 +266,98 @@ func CreateRoute(ctx context.Context, instanceId, cidr string) error {
 	return nil
 }
 
+// VpcCIDRs returns the primary and secondary cidr blocks of the vpc
+func VpcCIDRs(ctx context.Context) ([]string, error) {
+	r, err := routeClient(ctx)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to describe vpc", "vpcID", Cfg.VpcID, "requestID", util.RequestIdOf(err))
+		return nil, err
+	}
+	vpc := r.Vpc()
+	cidrs := []string{vpc.CidrBlock}
+	for _, secondary := range vpc.SecondaryCidrs {
+		if secondary.Cidr != "" {
+			cidrs = append(cidrs, secondary.Cidr)
+		}
+	}
+	return cidrs, nil
+}
+
+// CheckCloudAPI verifies the credentials, the vpc and the route table can be read.
+// It is used by the readiness probe when no recent api call has been recorded.
+func CheckCloudAPI(ctx context.Context) error {
+	_, err := Cfg.AkskProvider.GetAKSK()
+	health.RecordCloudCall(health.OpCredentials, err)
+	if err != nil {
+		return fmt.Errorf("get aksk error: %v", err)
+	}
+
+	r, err := routeClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.ListRoutes(&openstackTypes.RouteArgs{
+		DomainId:     Cfg.VpcID,
+		InstanceType: defaultRouteType,
+	})
+	health.RecordCloudCall(health.OpDescribeRoutes, err)
+	return err
+}
+
+// routeClient creates a route client, which describes the vpc, and records the result for health checks
+func routeClient(ctx context.Context) (*neutron.RouteClient, error) {
+	r, err := openstack_client.Route(ctx, Cfg)
+	health.RecordCloudCall(health.OpDescribeVpcs, err)
+	if err == nil {
+		// DescribeVpcs is signed with the current aksk, so a success proves the credentials
+		health.RecordCloudCall(health.OpCredentials, nil)
+	}
+	return r, err
+}
+
+// notifyFailure records a failed cloud api operation for alerting
+func notifyFailure(ctx context.Context, op string, err error) {
+	Alerts.Failure(ctx, op, errorCode(err), err)
+}
+
+// notifySuccess resolves the alerts of a cloud api operation
+func notifySuccess(ctx context.Context, op string) {
+	Alerts.Success(ctx, op)
+}
+
+// errorCode returns the code failures are grouped by, the kop error code when
+// the api answered and the http status or error type otherwise.
+func errorCode(err error) string {
+	var kopErr *util.Error
+	if errors.As(err, &kopErr) {
+		var resp struct {
+			Error struct {
+				Code string `json:"Code"`
+			} `json:"Error"`
+		}
+		if json.Unmarshal([]byte(kopErr.KopError.Message), &resp) == nil && resp.Error.Code != "" {
+			return resp.Error.Code
+		}
+		return fmt.Sprintf("HTTP%d", kopErr.KopError.StatusCode)
+	}
+	var clientErr *utils.Error
+	if errors.As(err, &clientErr) && clientErr.ErrorResponse.Type != "" {
+		return clientErr.ErrorResponse.Type
+	}
+	return "Unknown"
+}
+
+// IsRouteQuotaExceeded reports whether err is the route table of the vpc being full
+func IsRouteQuotaExceeded(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := strings.ToLower(errorCode(err))
+	return strings.Contains(code, "quota") || strings.Contains(code, "limitexceeded") ||
+		strings.Contains(strings.ToLower(err.Error()), "quota")
+}
+
 func getErrorString(e error) string {
 	if e == nil {
 		return ""
@@ -3,7 +3,7 @@ package alarm
 import (
 	"context"
 	"fmt"
-	"k8s.io/klog"
+	"k8s.io/klog/v2"
 	"net/url"
 	"strings"
 	"sync"
@@ -11,7 +11,8 @@ import (
 	kopHttp "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/http"
 	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/config"
 	openTypes "ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/types"
-	//prvd "github.com/kingsoftcloud/aksk-provider"
+	prvd "github.com/kingsoftcloud/aksk-provider"
+	"github.com/kingsoftcloud/aksk-provider/types"
 )
 
 const (
@@ -24,46 +25,42 @@ const (
 )
 
 var (
+	// AKForAlarm and SKForAlarm may be linked in at build time, they are only
+	// used when no credentials are configured for the alarm sink.
 	AKForAlarm string
 	SKForAlarm string
 )
 
 type AlarmClient struct {
-	conf     *config.Config
-	client   *kopHttp.KopClient
-	tenantID string
-	headers  map[string]string
-	lock     sync.Mutex
-	//akskProvider prvd.AKSKProvider
-	ak string
-	sk string
+	conf         *config.Config
+	client       *kopHttp.KopClient
+	headers      map[string]string
+	lock         sync.Mutex
+	akskProvider prvd.AKSKProvider
 }
 
-func NewAlarmClient(ctx context.Context, conf *config.Config) *AlarmClient {
+// NewAlarmClient creates an alarm client signing requests with the given provider,
+// the build time credentials are used if provider is nil.
+func NewAlarmClient(ctx context.Context, conf *config.Config, provider prvd.AKSKProvider) *AlarmClient {
 	if len(conf.NetworkEndpoint) == 0 {
 		conf.NetworkEndpoint = config.DefaultNetworkEndpoint
 	}
 	dataClient := kopHttp.NewKopClient(ctx)
-	/*if len(conf.Token) == 0 {
-	        conf.Token = fmt.Sprintf("%s:%s", conf.UserID, conf.TenantID)
-	}*/
 
 	headers := make(map[string]string)
-	//headers["X-Auth-Project-Id"] = conf.TenantID
-	//headers["X-Auth-Token"] = conf.Token
 	headers["User-Agent"] = "vpc-route-controller"
 	headers["Content-Type"] = "application/json"
 	headers["Accept"] = "application/json"
-	//headers["X-Auth-User-Tag"] = "docker"
+
+	if provider == nil {
+		provider = NewStaticAKSKProvider(AKForAlarm, SKForAlarm)
+	}
 
 	alarmClient := &AlarmClient{
-		conf:    conf,
-		headers: headers,
-		client:  dataClient,
-		//tenantID: conf.TenantID,
-		//akskProvider: conf.AkskProvider,
-		ak: AKForAlarm,
-		sk: SKForAlarm,
+		conf:         conf,
+		headers:      headers,
+		client:       dataClient,
+		akskProvider: provider,
 	}
 
 	return alarmClient
@@ -73,45 +70,67 @@ func (c *AlarmClient) CreateAlarm(message openTypes.AlarmArgs) error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	/*aksk, err := c.akskProvider.GetAKSK()
+	aksk, err := c.akskProvider.GetAKSK()
 	if err != nil {
 		return err
-	}*/
+	}
 
 	action := url.Values{
 		"Action":  []string{"AlarmReceptor"},
 		"Version": []string{defaultVersion},
 	}
-	klog.Infof("create alarm : %s", c.conf.NetworkEndpoint)
-	/*if len(aksk.SecurityToken) != 0 {
+	klog.InfoS("Create alarm", "name", message.Name, "endpoint", c.conf.NetworkEndpoint)
+	if len(aksk.SecurityToken) != 0 {
 		c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
-	}*/
+	}
 
 	c.client.SetEndpoint(c.conf.NetworkEndpoint)
 	c.client.SetHeader(c.headers)
 	c.client.SetBody(message)
 	c.client.SetUrlQuery("", action)
 	c.client.SetMethod(kopHttp.POST)
-	c.client.SetSigner(defaultServerName, c.conf.Region, AKForAlarm, SKForAlarm)
-	_, err := c.client.Go()
+	c.client.SetSigner(defaultServerName, c.conf.Region, aksk.AK, aksk.SK)
+	_, err = c.client.Go()
 	if err != nil {
 		if strings.Contains(err.Error(), "SecurityTokenExpired") {
-			/*aksk, err := c.akskProvider.ReloadAKSK()
+			aksk, err := c.akskProvider.ReloadAKSK()
 			if err != nil {
-				return fmt.Errorf("kop create alarm %v and reload aksk err: %v", body, err)
+				return fmt.Errorf("kop create alarm %v and reload aksk err: %w", message, err)
 			}
 			if len(aksk.SecurityToken) != 0 {
 				c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
-			}*/
-			c.client.SetSigner(defaultServerName, c.conf.Region, AKForAlarm, SKForAlarm)
+			}
+			c.client.SetSigner(defaultServerName, c.conf.Region, aksk.AK, aksk.SK)
 			_, err = c.client.Go()
 			if err != nil {
-				return fmt.Errorf("retry kop create alarm %v after reloading aksk err: %v", message, err)
+				return fmt.Errorf("retry kop create alarm %v after reloading aksk err: %w", message, err)
 			}
 		} else {
-			return fmt.Errorf("kop create alarm %v err: %v", message, err)
+			return fmt.Errorf("kop create alarm %v err: %w", message, err)
 		}
 	}
 
 	return nil
 }
+
+// StaticAKSKProvider returns fixed credentials
+type StaticAKSKProvider struct {
+	aksk *types.AKSK
+}
+
+var _ prvd.AKSKProvider = &StaticAKSKProvider{}
+
+func NewStaticAKSKProvider(ak, sk string) *StaticAKSKProvider {
+	return &StaticAKSKProvider{aksk: &types.AKSK{AK: ak, SK: sk}}
+}
+
+func (p *StaticAKSKProvider) GetAKSK() (*types.AKSK, error) {
+	if p.aksk.AK == "" || p.aksk.SK == "" {
+		return nil, fmt.Errorf("no aksk configured for alarm")
+	}
+	return p.aksk, nil
+}
+
+func (p *StaticAKSKProvider) ReloadAKSK() (*types.AKSK, error) {
+	return p.GetAKSK()
+}
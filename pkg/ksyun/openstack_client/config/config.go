@@ -7,6 +7,7 @@ import (
 
 var (
 	DefaultNetworkEndpoint = "http://internal.api.ksyun.com"
+	DefaultMetadataURL     = "http://11.255.255.100:8775/latest/meta-data/"
 )
 
 type Config struct {
@@ -20,10 +21,12 @@ type Config struct {
 	UserID string `json:"user_id"`
 	// nova token id
 	Token string `json:"token"`
-	// vpc id
+	// vpc id, discovered from the metadata service or the instance of the controller if empty
 	VpcID string `json:"vpc_id"`
-	// nova region
+	// nova region, discovered from the metadata service if empty
 	Region string `json:"region"`
+	// metadata service used to discover the vpc id and region
+	MetadataURL string `json:"metadata_url"`
 	// kube config file
 	Kubeconfig string `json:"kubeconfig"`
 	// auth open api
@@ -48,5 +51,34 @@ type Config struct {
 	// http client backoff
 	Backoff *wait.Backoff `json:"backoff"`
 
-	AlarmEnabled bool `json: "alarm_enabled"`
+	AlarmEnabled bool `json:"alarm_enabled"`
+
+	// alert sinks, a single kingsoft alarm sink is used when unset and alarm_enabled is true
+	Alert *AlertConfig `json:"alert"`
+}
+
+type AlertConfig struct {
+	Sinks []AlertSinkConfig `json:"sinks"`
+	// identical alerts are dropped within the window, e.g. "30m"
+	DedupWindow string `json:"dedup_window"`
+	// a failure lasting longer is escalated to critical, e.g. "30m"
+	EscalateAfter string `json:"escalate_after"`
+	// alerts sent per hour over all sinks, resolved notifications are not limited
+	RateLimitPerHour int `json:"rate_limit_per_hour"`
+	Burst            int `json:"burst"`
+	// kingsoft alarm priority of each severity
+	SeverityPriority map[string]string `json:"severity_priority"`
+}
+
+type AlertSinkConfig struct {
+	// kingsoft, webhook, slack or event
+	Type string `json:"type"`
+	// webhook and slack url
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// alerts below the severity are not sent to the sink
+	MinSeverity string `json:"min_severity"`
+	// kingsoft alarm credentials, the controller aksk is used when unset
+	AK string `json:"ak"`
+	SK string `json:"sk"`
 }
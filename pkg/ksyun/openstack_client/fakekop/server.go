@@ -0,0 +1,291 @@
+// Package fakekop provides a stand-in for the kop api of the vpc and kec services,
+// serving a vpc, its route table and its instances from memory.
+package fakekop
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	prvd "github.com/kingsoftcloud/aksk-provider"
+	aksk "github.com/kingsoftcloud/aksk-provider/types"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/config"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/ksyun/openstack_client/types"
+)
+
+const (
+	// Region is the region of the config returned by Config
+	Region = "cn-test-1"
+	// RouteTypeHost is the type of the routes created by the controller
+	RouteTypeHost = "Host"
+
+	// CodeQuotaExceeded is the error code of a create over the route table quota
+	CodeQuotaExceeded = "RouteLimitExceeded"
+)
+
+// Server is a fake kop api for tests
+type Server struct {
+	*httptest.Server
+
+	lock      sync.Mutex
+	vpc       types.Vpc
+	instances []types.Instance
+	routes    []types.RouteSetType
+	// quota limits the entries of the route table, unlimited if 0
+	quota  int
+	nextId int
+	// failures answers an action with an error for the given number of requests, -1 for ever
+	failures map[string]failure
+	requests map[string]int
+}
+
+type failure struct {
+	status int
+	code   string
+	count  int
+}
+
+// NewServer starts a server holding the vpc vpcId with an empty route table
+func NewServer(vpcId, cidr string) *Server {
+	s := &Server{
+		vpc:      types.Vpc{VpcId: vpcId, CidrBlock: cidr},
+		failures: make(map[string]failure),
+		requests: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Config returns a net config of the vpc pointing at the server
+func (s *Server) Config() *config.Config {
+	return &config.Config{
+		NetworkEndpoint: s.URL,
+		VpcID:           s.vpc.VpcId,
+		Region:          Region,
+		AkskProvider:    staticAKSK{},
+	}
+}
+
+// AddInstance adds an instance whose primary network interface has privateIP in the vpc
+func (s *Server) AddInstance(instanceId, privateIP string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.instances = append(s.instances, types.Instance{
+		Id: instanceId,
+		NetworkInterfaces: []types.NetworkInterface{{
+			NetworkInterfaceType: "primary",
+			VpcId:                s.vpc.VpcId,
+			PrivateIpAddress:     privateIP,
+		}},
+	})
+}
+
+// AddRoute adds a route of routeType to the route table and returns its id
+func (s *Server) AddRoute(routeType, cidr, instanceId string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.addRoute(routeType, cidr, instanceId)
+}
+
+// Routes returns the route table sorted by destination
+func (s *Server) Routes() []types.RouteSetType {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	routes := append([]types.RouteSetType(nil), s.routes...)
+	sort.Slice(routes, func(i, j int) bool { return routes[i].DestinationCIDR < routes[j].DestinationCIDR })
+	return routes
+}
+
+// SetQuota limits the entries of the route table, 0 for no limit
+func (s *Server) SetQuota(quota int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.quota = quota
+}
+
+// Fail answers the next count requests of action with status and the error code,
+// count -1 fails for ever
+func (s *Server) Fail(action string, status int, code string, count int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures[action] = failure{status: status, code: code, count: count}
+}
+
+// Requests returns how many requests were made for action
+func (s *Server) Requests(action string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests[action]
+}
+
+func (s *Server) serve(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	action := q.Get("Action")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests[action]++
+	if f, ok := s.failures[action]; ok && f.count != 0 {
+		if f.count > 0 {
+			f.count--
+			s.failures[action] = f
+		}
+		writeError(w, f.status, f.code, "injected failure")
+		return
+	}
+
+	switch action {
+	case "DescribeVpcs":
+		resp := types.VpcResp{}
+		if q.Get("VpcId.1") == s.vpc.VpcId {
+			resp.Vpcs = []types.Vpc{s.vpc}
+		}
+		writeJSON(w, resp)
+	case "DescribeInstances":
+		resp := types.GetInstancesResponse{}
+		for _, instance := range s.instances {
+			if matchInstance(instance, q) {
+				resp.InstancesSet = append(resp.InstancesSet, instance)
+			}
+		}
+		writeJSON(w, resp)
+	case "DescribeRoutes":
+		resp := types.GetRoutesResponse{}
+		for _, route := range s.routes {
+			if matchRoute(route, q) {
+				resp.RouteSet = append(resp.RouteSet, route)
+			}
+		}
+		writeJSON(w, resp)
+	case "CreateRoute":
+		cidr := q.Get("DestinationCidrBlock")
+		for _, route := range s.routes {
+			if route.DestinationCIDR == cidr {
+				writeError(w, http.StatusBadRequest, "InvalidParameter",
+					fmt.Sprintf("destination cidr block %s is same with a route", cidr))
+				return
+			}
+		}
+		if s.quota > 0 && len(s.routes) >= s.quota {
+			writeError(w, http.StatusBadRequest, CodeQuotaExceeded, "route table is full")
+			return
+		}
+		id := s.addRoute(q.Get("RouteType"), cidr, q.Get("InstanceId"))
+		writeJSON(w, types.CreateRouteResponse{RouteId: id})
+	case "DeleteRoute":
+		id := q.Get("RouteId")
+		for i, route := range s.routes {
+			if route.RouteId == id {
+				s.routes = append(s.routes[:i], s.routes[i+1:]...)
+				writeJSON(w, types.DelRouteResponse{Return: true})
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "RouteNotFound", fmt.Sprintf("route %s not found", id))
+	default:
+		writeError(w, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("action %q is not supported", action))
+	}
+}
+
+func (s *Server) addRoute(routeType, cidr, instanceId string) string {
+	s.nextId++
+	id := fmt.Sprintf("route-%d", s.nextId)
+	route := types.RouteSetType{
+		RouteId:         id,
+		VpcId:           s.vpc.VpcId,
+		RouteType:       routeType,
+		DestinationCIDR: cidr,
+	}
+	if instanceId != "" {
+		route.NextHopset = []types.NextHop{{GatewayId: instanceId}}
+	}
+	s.routes = append(s.routes, route)
+	return id
+}
+
+// filters returns the values of the Filter.N.Name and Filter.N.Value.1 parameters
+func filters(q url.Values) map[string]string {
+	f := make(map[string]string)
+	for key := range q {
+		if !strings.HasPrefix(key, "Filter.") || !strings.HasSuffix(key, ".Name") {
+			continue
+		}
+		n := strings.TrimSuffix(strings.TrimPrefix(key, "Filter."), ".Name")
+		f[q.Get(key)] = q.Get(fmt.Sprintf("Filter.%s.Value.1", n))
+	}
+	return f
+}
+
+func matchInstance(instance types.Instance, q url.Values) bool {
+	if id := q.Get("InstanceId.1"); id != "" && instance.Id != id {
+		return false
+	}
+	f := filters(q)
+	if vpcId, ok := f["vpc-id"]; ok && instance.VpcId() != vpcId {
+		return false
+	}
+	if ip, ok := f["private-ip-address"]; ok {
+		for _, n := range instance.NetworkInterfaces {
+			if n.PrivateIpAddress == ip {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchRoute(route types.RouteSetType, q url.Values) bool {
+	if id := q.Get("RouteId.1"); id != "" {
+		return route.RouteId == id
+	}
+	f := filters(q)
+	for name, value := range map[string]string{
+		"vpc-id":                 route.VpcId,
+		"route-type":             route.RouteType,
+		"destination-cidr-block": route.DestinationCIDR,
+	} {
+		if want, ok := f[name]; ok && want != value {
+			return false
+		}
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers like the kop api, the code is what the controller groups alerts by
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	var resp struct {
+		Error struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}
+	resp.Error.Code, resp.Error.Message = code, message
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// staticAKSK hands out fixed credentials, the server does not check signatures
+type staticAKSK struct{}
+
+var _ prvd.AKSKProvider = staticAKSK{}
+
+func (staticAKSK) GetAKSK() (*aksk.AKSK, error) {
+	return &aksk.AKSK{AK: "ak", SK: "sk"}, nil
+}
+
+func (staticAKSK) ReloadAKSK() (*aksk.AKSK, error) {
+	return &aksk.AKSK{AK: "ak", SK: "sk"}, nil
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"k8s.io/klog"
+	"k8s.io/klog/v2"
 	"net/url"
 	"strings"
 	"sync"
@@ -32,6 +32,7 @@ type RouteClient struct {
 	lock         sync.Mutex
 	akskProvider prvd.AKSKProvider
 	productTag   string
+	vpc          *openTypes.Vpc
 }
 
 func NewRouteClient(ctx context.Context, conf *config.Config) (*RouteClient, error) {
@@ -62,10 +63,16 @@ func NewRouteClient(ctx context.Context, conf *config.Config) (*RouteClient, err
 		return nil, err
 	}
 	routeClient.productTag = result.ProductTag
+	routeClient.vpc = result
 
 	return routeClient, nil
 }
 
+// Vpc returns the vpc described when the client was created
+func (c *RouteClient) Vpc() *openTypes.Vpc {
+	return c.vpc
+}
+
 func (c *RouteClient) DescribeVpcs() (*openTypes.Vpc, error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -80,7 +87,7 @@ func (c *RouteClient) DescribeVpcs() (*openTypes.Vpc, error) {
 		"Version": []string{defaultVersion},
 		"VpcId.1": []string{c.conf.VpcID},
 	}
-	klog.Infof("describe vpc %s : %s", c.conf.VpcID, c.conf.NetworkEndpoint)
+	klog.InfoS("Describe vpc", "vpcID", c.conf.VpcID, "endpoint", c.conf.NetworkEndpoint)
 	if len(aksk.SecurityToken) != 0 {
 		c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
 	}
@@ -94,7 +101,7 @@ func (c *RouteClient) DescribeVpcs() (*openTypes.Vpc, error) {
 		if strings.Contains(err.Error(), "SecurityTokenExpired") {
 			aksk, err := c.akskProvider.ReloadAKSK()
 			if err != nil {
-				return nil, fmt.Errorf("kop describe vpc %s and reload aksk err: %v", c.conf.VpcID, err)
+				return nil, fmt.Errorf("kop describe vpc %s and reload aksk err: %w", c.conf.VpcID, err)
 			}
 			if len(aksk.SecurityToken) != 0 {
 				c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
@@ -102,10 +109,10 @@ func (c *RouteClient) DescribeVpcs() (*openTypes.Vpc, error) {
 			c.client.SetSigner(defaultServerName, c.conf.Region, aksk.AK, aksk.SK)
 			data, err = c.client.Go()
 			if err != nil {
-				return nil, fmt.Errorf("retry kop describe vpc %s after reloading aksk err: %v", c.conf.VpcID, err)
+				return nil, fmt.Errorf("retry kop describe vpc %s after reloading aksk err: %w", c.conf.VpcID, err)
 			}
 		} else {
-			return nil, fmt.Errorf("kop describe vpc %s err: %v", c.conf.VpcID, err)
+			return nil, fmt.Errorf("kop describe vpc %s err: %w", c.conf.VpcID, err)
 		}
 	}
 	response := new(openTypes.VpcResp)
@@ -141,7 +148,7 @@ func (c *RouteClient) CreateRoute(args *openTypes.RouteArgs) (string, error) {
 		"InstanceId":           []string{args.InstanceId},
 		"DestinationCidrBlock": []string{args.CidrBlock},
 	}
-	klog.Infof("create neutron route : %s", c.conf.NetworkEndpoint)
+	klog.InfoS("Create route", "vpcID", args.DomainId, "instanceID", args.InstanceId, "cidr", args.CidrBlock, "endpoint", c.conf.NetworkEndpoint)
 	if len(aksk.SecurityToken) != 0 {
 		c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
 	}
@@ -156,7 +163,7 @@ func (c *RouteClient) CreateRoute(args *openTypes.RouteArgs) (string, error) {
 		if strings.Contains(err.Error(), "SecurityTokenExpired") {
 			aksk, err := c.akskProvider.ReloadAKSK()
 			if err != nil {
-				return "", fmt.Errorf("kop create route %v and reload aksk err: %v", args, err)
+				return "", fmt.Errorf("kop create route %v and reload aksk err: %w", args, err)
 			}
 			if len(aksk.SecurityToken) != 0 {
 				c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
@@ -164,10 +171,10 @@ func (c *RouteClient) CreateRoute(args *openTypes.RouteArgs) (string, error) {
 			c.client.SetSigner(defaultServerName, c.conf.Region, aksk.AK, aksk.SK)
 			data, err = c.client.Go()
 			if err != nil {
-				return "", fmt.Errorf("retry kop create route %v after reloading aksk err: %v", args, err)
+				return "", fmt.Errorf("retry kop create route %v after reloading aksk err: %w", args, err)
 			}
 		} else {
-			return "", fmt.Errorf("kop create route %v err: %v", args, err)
+			return "", fmt.Errorf("kop create route %v err: %w", args, err)
 		}
 	}
 
@@ -197,7 +204,7 @@ func (c *RouteClient) DeleteRoute(id string) error {
 		"Version": []string{defaultVersion},
 		"RouteId": []string{id},
 	}
-	klog.Infof("delete neutron route : %s", c.conf.NetworkEndpoint)
+	klog.InfoS("Delete route", "routeID", id, "endpoint", c.conf.NetworkEndpoint)
 	if len(aksk.SecurityToken) != 0 {
 		c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
 	}
@@ -210,7 +217,7 @@ func (c *RouteClient) DeleteRoute(id string) error {
 		if strings.Contains(err.Error(), "SecurityTokenExpired") {
 			aksk, err := c.akskProvider.ReloadAKSK()
 			if err != nil {
-				return fmt.Errorf("kop delete route %v and reload aksk err: %v", id, err)
+				return fmt.Errorf("kop delete route %v and reload aksk err: %w", id, err)
 			}
 			if len(aksk.SecurityToken) != 0 {
 				c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
@@ -218,10 +225,10 @@ func (c *RouteClient) DeleteRoute(id string) error {
 			c.client.SetSigner(defaultServerName, c.conf.Region, aksk.AK, aksk.SK)
 			_, err = c.client.Go()
 			if err != nil {
-				return fmt.Errorf("retry kop delete route %v after reloading aksk err: %v", id, err)
+				return fmt.Errorf("retry kop delete route %v after reloading aksk err: %w", id, err)
 			}
 		} else {
-			return fmt.Errorf("kop delete route %v err: %v", id, err)
+			return fmt.Errorf("kop delete route %v err: %w", id, err)
 		}
 	}
 	return nil
@@ -241,10 +248,13 @@ func (c *RouteClient) ListRoutes(args *openTypes.RouteArgs) ([]openTypes.RouteSe
 		"Version":          []string{defaultVersion},
 		"Filter.1.Name":    []string{"vpc-id"},
 		"Filter.1.Value.1": []string{args.DomainId},
-		"Filter.2.Name":    []string{"route-type"},
-		"Filter.2.Value.1": []string{args.InstanceType},
 	}
-	klog.Infof("list neutron route : %s", c.conf.NetworkEndpoint)
+	// without a route type all entries of the route table are listed
+	if args.InstanceType != "" {
+		action.Set("Filter.2.Name", "route-type")
+		action.Set("Filter.2.Value.1", args.InstanceType)
+	}
+	klog.InfoS("List routes", "vpcID", args.DomainId, "endpoint", c.conf.NetworkEndpoint)
 	if len(aksk.SecurityToken) != 0 {
 		c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
 	}
@@ -258,7 +268,7 @@ func (c *RouteClient) ListRoutes(args *openTypes.RouteArgs) ([]openTypes.RouteSe
 		if strings.Contains(err.Error(), "SecurityTokenExpired") {
 			aksk, err := c.akskProvider.ReloadAKSK()
 			if err != nil {
-				return nil, fmt.Errorf("kop list routes %v and reload aksk err: %v", args, err)
+				return nil, fmt.Errorf("kop list routes %v and reload aksk err: %w", args, err)
 			}
 			if len(aksk.SecurityToken) != 0 {
 				c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
@@ -266,10 +276,10 @@ func (c *RouteClient) ListRoutes(args *openTypes.RouteArgs) ([]openTypes.RouteSe
 			c.client.SetSigner(defaultServerName, c.conf.Region, aksk.AK, aksk.SK)
 			data, err = c.client.Go()
 			if err != nil {
-				return nil, fmt.Errorf("retry kop list routes %v after reloading aksk err: %v", args, err)
+				return nil, fmt.Errorf("retry kop list routes %v after reloading aksk err: %w", args, err)
 			}
 		} else {
-			return nil, fmt.Errorf("kop list routes %v err: %v", args, err)
+			return nil, fmt.Errorf("kop list routes %v err: %w", args, err)
 		}
 	}
 
@@ -300,7 +310,7 @@ func (c *RouteClient) GetRoutes(args *openTypes.RouteArgs) ([]openTypes.RouteSet
 		"Filter.3.Name":    []string{"destination-cidr-block"},
 		"Filter.3.Value.1": []string{args.CidrBlock},
 	}
-	klog.V(9).Infof("get neutron route : %s", c.conf.NetworkEndpoint)
+	klog.V(9).InfoS("Get routes", "vpcID", args.DomainId, "cidr", args.CidrBlock, "endpoint", c.conf.NetworkEndpoint)
 	if len(aksk.SecurityToken) != 0 {
 		c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
 	}
@@ -314,7 +324,7 @@ func (c *RouteClient) GetRoutes(args *openTypes.RouteArgs) ([]openTypes.RouteSet
 		if strings.Contains(err.Error(), "SecurityTokenExpired") {
 			aksk, err := c.akskProvider.ReloadAKSK()
 			if err != nil {
-				return nil, fmt.Errorf("kop get routes %v and reload aksk err: %v", args, err)
+				return nil, fmt.Errorf("kop get routes %v and reload aksk err: %w", args, err)
 			}
 			if len(aksk.SecurityToken) != 0 {
 				c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
@@ -322,10 +332,10 @@ func (c *RouteClient) GetRoutes(args *openTypes.RouteArgs) ([]openTypes.RouteSet
 			c.client.SetSigner(defaultServerName, c.conf.Region, aksk.AK, aksk.SK)
 			data, err = c.client.Go()
 			if err != nil {
-				return nil, fmt.Errorf("retry kop get routes %v after reloading aksk err: %v", args, err)
+				return nil, fmt.Errorf("retry kop get routes %v after reloading aksk err: %w", args, err)
 			}
 		} else {
-			return nil, fmt.Errorf("kop get routes %v err: %v", args, err)
+			return nil, fmt.Errorf("kop get routes %v err: %w", args, err)
 		}
 	}
 
@@ -351,7 +361,7 @@ func (c *RouteClient) GetRoute(id string) (*openTypes.RouteSetType, error) {
 		"Version":   []string{defaultVersion},
 		"RouteId.1": []string{id},
 	}
-	klog.Infof("DescribeRoute neutron route : %s", c.conf.NetworkEndpoint)
+	klog.InfoS("Describe route", "routeID", id, "endpoint", c.conf.NetworkEndpoint)
 	if len(aksk.SecurityToken) != 0 {
 		c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
 	}
@@ -365,7 +375,7 @@ func (c *RouteClient) GetRoute(id string) (*openTypes.RouteSetType, error) {
 		if strings.Contains(err.Error(), "SecurityTokenExpired") {
 			aksk, err := c.akskProvider.ReloadAKSK()
 			if err != nil {
-				return nil, fmt.Errorf("kop get route %v and reload aksk err: %v", id, err)
+				return nil, fmt.Errorf("kop get route %v and reload aksk err: %w", id, err)
 			}
 			if len(aksk.SecurityToken) != 0 {
 				c.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
@@ -373,10 +383,10 @@ func (c *RouteClient) GetRoute(id string) (*openTypes.RouteSetType, error) {
 			c.client.SetSigner(defaultServerName, c.conf.Region, aksk.AK, aksk.SK)
 			data, err = c.client.Go()
 			if err != nil {
-				return nil, fmt.Errorf("retry kop get route %v after reloading aksk err: %v", id, err)
+				return nil, fmt.Errorf("retry kop get route %v after reloading aksk err: %w", id, err)
 			}
 		} else {
-			return nil, fmt.Errorf("kop get route %v err: %v", id, err)
+			return nil, fmt.Errorf("kop get route %v err: %w", id, err)
 		}
 	}
 	response := new(openTypes.DescribeRouteResponse)
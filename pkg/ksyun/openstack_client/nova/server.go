@@ -62,15 +62,27 @@ func (n *ServerClient) DescribeInstances(args *openTypes.InstanceArgs) (*openTyp
 	}
 
 	action := url.Values{
-		"Action":           []string{"DescribeInstances"},
-		"Version":          []string{defaultVersion},
-		"Filter.1.Name":    []string{"vpc-id"},
-		"Filter.1.Value.1": []string{args.DomainId},
-		"Filter.2.Name":    []string{"private-ip-address"},
-		"Filter.2.Value.1": []string{args.InstancePrivateIP},
+		"Action":  []string{"DescribeInstances"},
+		"Version": []string{defaultVersion},
+	}
+	// the vpc is left out when it is being discovered from the instance
+	filters := 0
+	for _, f := range []struct{ name, value string }{
+		{"vpc-id", args.DomainId},
+		{"private-ip-address", args.InstancePrivateIP},
+	} {
+		if f.value == "" {
+			continue
+		}
+		filters++
+		action.Set(fmt.Sprintf("Filter.%d.Name", filters), f.name)
+		action.Set(fmt.Sprintf("Filter.%d.Value.1", filters), f.value)
+	}
+	if args.InstanceId != "" {
+		action.Set("InstanceId.1", args.InstanceId)
 	}
 
-	log.V(9).Infof("get nova instance: %s", n.conf.NetworkEndpoint)
+	log.V(9).InfoS("Describe instances", "instanceID", args.InstanceId, "privateIP", args.InstancePrivateIP, "endpoint", n.conf.NetworkEndpoint)
 
 	if len(aksk.SecurityToken) != 0 {
 		n.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
@@ -85,7 +97,7 @@ func (n *ServerClient) DescribeInstances(args *openTypes.InstanceArgs) (*openTyp
 		if strings.Contains(err.Error(), "SecurityTokenExpired") {
 			aksk, err := n.akskProvider.ReloadAKSK()
 			if err != nil {
-				return nil, fmt.Errorf("kop get instances %v and reload aksk err: %v", args, err)
+				return nil, fmt.Errorf("kop get instances %v and reload aksk err: %w", args, err)
 			}
 			if len(aksk.SecurityToken) != 0 {
 				n.headers["X-Ksc-Security-Token"] = aksk.SecurityToken
@@ -93,10 +105,10 @@ func (n *ServerClient) DescribeInstances(args *openTypes.InstanceArgs) (*openTyp
 			n.client.SetSigner(defaultServerName, n.conf.Region, aksk.AK, aksk.SK)
 			data, err = n.client.Go()
 			if err != nil {
-				return nil, fmt.Errorf("retry kop get instances %v after reloading aksk err: %v", args, err)
+				return nil, fmt.Errorf("retry kop get instances %v after reloading aksk err: %w", args, err)
 			}
 		} else {
-			return nil, fmt.Errorf("kop get instances %v err: %v", args, err)
+			return nil, fmt.Errorf("kop get instances %v err: %w", args, err)
 		}
 	}
 
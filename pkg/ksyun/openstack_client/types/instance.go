@@ -34,6 +34,8 @@ type Instance struct {
 	*/
 	Id   string `json:"InstanceId"`
 	Name string `json:"InstanceName"`
+	// NetworkInterfaces carry the vpc of the instance
+	NetworkInterfaces []NetworkInterface `json:"NetworkInterfaceSet"`
 	/*Status             string    `json:"OS-EXT-STS:vm_state"`
 	  Host               string    `json:"OS-EXT-SRV-ATTR:host"`
 	  HypervisorHostname string    `json:"OS-EXT-SRV-ATTR:hypervisor_hostname"`
@@ -42,6 +44,27 @@ type Instance struct {
 	  Vifs               []NovaVif `json:"vifs"`*/
 }
 
+type NetworkInterface struct {
+	NetworkInterfaceId   string `json:"NetworkInterfaceId"`
+	NetworkInterfaceType string `json:"NetworkInterfaceType"`
+	VpcId                string `json:"VpcId"`
+	SubnetId             string `json:"SubnetId"`
+	PrivateIpAddress     string `json:"PrivateIpAddress"`
+}
+
+// VpcId returns the vpc of the primary network interface
+func (i *Instance) VpcId() string {
+	for _, n := range i.NetworkInterfaces {
+		if n.NetworkInterfaceType == "primary" {
+			return n.VpcId
+		}
+	}
+	if len(i.NetworkInterfaces) != 0 {
+		return i.NetworkInterfaces[0].VpcId
+	}
+	return ""
+}
+
 type InstanceArgs struct {
 	DomainId          string `json:"domain_id"`
 	InstanceId        string `json:"instance_id"`
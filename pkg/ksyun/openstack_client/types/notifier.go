@@ -1,9 +0,0 @@
-package types
-
-type NotifyMessage struct {
-	Name     string
-	Priority string
-	Content  string
-	NoDeal   string
-	Product  string
-}
@@ -13,6 +13,13 @@ type Vpc struct {
 	IsDefault             bool   `json:"IsDefault"`
 	ProvidedIpv6CidrBlock bool   `json:"ProvidedIpv6CidrBlock"`
 	ProductTag            string `json:"ProductTag"`
+	// SecondaryCidrs are the cidr blocks added to the vpc after its creation
+	SecondaryCidrs []SecondaryCidr `json:"SecondaryCidrSet"`
+}
+
+type SecondaryCidr struct {
+	SecondaryCidrId string `json:"SecondaryCidrId"`
+	Cidr            string `json:"Cidr"`
 }
 
 type VpcResp struct {
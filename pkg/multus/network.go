@@ -0,0 +1,276 @@
+// Package multus reads the secondary pod networks of Multus NetworkAttachmentDefinitions
+// that opt into vpc routing, and the per node ranges of their IPAM.
+package multus
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/model"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+)
+
+var (
+	// NetworkAttachmentDefinitionGVK is a secondary network of Multus
+	NetworkAttachmentDefinitionGVK = schema.GroupVersionKind{Group: "k8s.cni.cncf.io", Version: "v1", Kind: "NetworkAttachmentDefinition"}
+	// NodeSlicePoolGVK assigns the slices of a whereabouts range to nodes
+	NodeSlicePoolGVK = schema.GroupVersionKind{Group: "whereabouts.cni.cncf.io", Version: "v1alpha1", Kind: "NodeSlicePool"}
+)
+
+const (
+	// AnnotationVPCRoute opts a NetworkAttachmentDefinition into vpc routing when "true"
+	AnnotationVPCRoute = "kce.sdns.ksyun.com/vpc-route"
+	// AnnotationVPCRouteNode names the node a NetworkAttachmentDefinition with host-local
+	// IPAM belongs to, host-local allocates from the same ranges on every node using it
+	AnnotationVPCRouteNode = "kce.sdns.ksyun.com/vpc-route-node"
+	// NodeAnnotationNetworkRoutesKey holds the route status of each secondary network of the node
+	NodeAnnotationNetworkRoutesKey = "kce.sdns.ksyun.com/network-routes"
+
+	IPAMHostLocal   = "host-local"
+	IPAMWhereabouts = "whereabouts"
+)
+
+// Network is a secondary network routed in the vpc
+type Network struct {
+	Namespace string
+	Name      string
+	// Node is the only node of a host-local network
+	Node string
+	IPAM IPAM
+}
+
+// Key identifies the network in the node status annotation
+func (n *Network) Key() string {
+	return n.Namespace + "/" + n.Name
+}
+
+// IPAM is the part of the IPAM config of a network that decides its per node ranges
+type IPAM struct {
+	Type string
+	// Ranges are the IPv4 ranges of the network
+	Ranges []ip.IP4Net
+	// NodeSliceSize splits a whereabouts range into per node slices, e.g. "/26"
+	NodeSliceSize string
+	// NetworkName names the NodeSlicePool of a whereabouts network, the NAD name if empty
+	NetworkName string
+}
+
+// ipamConfig is the CNI IPAM config of host-local and whereabouts
+type ipamConfig struct {
+	Type   string `json:"type"`
+	Subnet string `json:"subnet"`
+	Ranges [][]struct {
+		Subnet string `json:"subnet"`
+	} `json:"ranges"`
+	Range    string `json:"range"`
+	IPRanges []struct {
+		Range string `json:"range"`
+	} `json:"ipRanges"`
+	NodeSliceSize string `json:"node_slice_size"`
+	NetworkName   string `json:"network_name"`
+}
+
+// cniConfig is a CNI config or config list
+type cniConfig struct {
+	IPAM    *ipamConfig `json:"ipam"`
+	Plugins []struct {
+		IPAM *ipamConfig `json:"ipam"`
+	} `json:"plugins"`
+}
+
+// ParseNetwork returns the network of a NetworkAttachmentDefinition, nil if it does not
+// opt into vpc routing
+func ParseNetwork(nad *unstructured.Unstructured) (*Network, error) {
+	if nad.GetAnnotations()[AnnotationVPCRoute] != "true" {
+		return nil, nil
+	}
+	config, _, _ := unstructured.NestedString(nad.Object, "spec", "config")
+	ipam, err := ParseIPAM(config)
+	if err != nil {
+		return nil, fmt.Errorf("network %s/%s: %v", nad.GetNamespace(), nad.GetName(), err)
+	}
+	if ipam.Type == IPAMWhereabouts && ipam.NetworkName == "" {
+		ipam.NetworkName = nad.GetName()
+	}
+	return &Network{
+		Namespace: nad.GetNamespace(),
+		Name:      nad.GetName(),
+		Node:      nad.GetAnnotations()[AnnotationVPCRouteNode],
+		IPAM:      ipam,
+	}, nil
+}
+
+// ParseIPAM parses the IPAM of a CNI config or config list, the first plugin with IPAM wins
+func ParseIPAM(config string) (IPAM, error) {
+	if config == "" {
+		return IPAM{}, fmt.Errorf("empty cni config, configs on the nodes are not supported")
+	}
+	var c cniConfig
+	if err := json.Unmarshal([]byte(config), &c); err != nil {
+		return IPAM{}, fmt.Errorf("invalid cni config: %v", err)
+	}
+	raw := c.IPAM
+	for i := 0; raw == nil && i < len(c.Plugins); i++ {
+		raw = c.Plugins[i].IPAM
+	}
+	if raw == nil {
+		return IPAM{}, fmt.Errorf("cni config has no ipam")
+	}
+
+	ipam := IPAM{Type: raw.Type, NodeSliceSize: raw.NodeSliceSize, NetworkName: raw.NetworkName}
+	var subnets []string
+	switch raw.Type {
+	case IPAMHostLocal:
+		subnets = append(subnets, raw.Subnet)
+		for _, set := range raw.Ranges {
+			for _, r := range set {
+				subnets = append(subnets, r.Subnet)
+			}
+		}
+	case IPAMWhereabouts:
+		subnets = append(subnets, raw.Range)
+		for _, r := range raw.IPRanges {
+			subnets = append(subnets, r.Range)
+		}
+	default:
+		return IPAM{}, fmt.Errorf("unsupported ipam %q, must be %s or %s", raw.Type, IPAMHostLocal, IPAMWhereabouts)
+	}
+	for _, s := range subnets {
+		if s == "" || strings.Contains(s, ":") {
+			// IPv6 ranges are not routed
+			continue
+		}
+		// whereabouts ranges may carry a start address, e.g. 10.1.0.10-10.1.0.200/24
+		if i := strings.Index(s, "-"); i >= 0 {
+			if j := strings.Index(s, "/"); j > i {
+				s = s[:i] + s[j:]
+			}
+		}
+		n, err := ip.ParseIP4Net(s)
+		if err != nil {
+			return IPAM{}, fmt.Errorf("invalid range %q: %v", s, err)
+		}
+		ipam.Ranges = append(ipam.Ranges, n)
+	}
+	if len(ipam.Ranges) == 0 {
+		return IPAM{}, fmt.Errorf("ipam has no IPv4 range")
+	}
+	return ipam, nil
+}
+
+// NodeRanges returns the ranges of the network allocated to node. A host-local network
+// belongs to the node named in its annotation. A whereabouts network needs node slices,
+// pools are the NodeSlicePools in the namespace of the network.
+func NodeRanges(network *Network, node string, pools []unstructured.Unstructured) ([]ip.IP4Net, error) {
+	switch network.IPAM.Type {
+	case IPAMHostLocal:
+		if network.Node == "" {
+			return nil, fmt.Errorf("host-local ranges are shared by all nodes, set %s to the node of the network", AnnotationVPCRouteNode)
+		}
+		if network.Node != node {
+			return nil, nil
+		}
+		return network.IPAM.Ranges, nil
+	case IPAMWhereabouts:
+		if network.IPAM.NodeSliceSize == "" {
+			return nil, fmt.Errorf("whereabouts range is shared by all nodes, set node_slice_size")
+		}
+		var ranges []ip.IP4Net
+		for i := range pools {
+			if pools[i].GetName() != network.IPAM.NetworkName {
+				continue
+			}
+			allocations, _, _ := unstructured.NestedSlice(pools[i].Object, "status", "allocations")
+			for _, a := range allocations {
+				allocation, ok := a.(map[string]interface{})
+				if !ok || allocation["nodeName"] != node {
+					continue
+				}
+				s, _ := allocation["sliceRange"].(string)
+				n, err := ip.ParseIP4Net(s)
+				if err != nil {
+					return nil, fmt.Errorf("invalid slice %q of node %s: %v", s, node, err)
+				}
+				ranges = append(ranges, n)
+			}
+		}
+		return ranges, nil
+	}
+	return nil, fmt.Errorf("unsupported ipam %q", network.IPAM.Type)
+}
+
+// OrphanedRoutes returns the routes inside a range of networks that point at none of
+// instances, the instances of the current nodes. These are left by nodes deleted while
+// the controller was not running or had not synced them yet.
+func OrphanedRoutes(networks []*Network, routes []*model.Route, instances map[string]bool) []*model.Route {
+	var orphaned []*model.Route
+	for _, route := range routes {
+		if route.InstanceId == "" || instances[route.InstanceId] {
+			continue
+		}
+		n, err := ip.ParseIP4Net(route.DestinationCIDR)
+		if err != nil {
+			continue
+		}
+		if inRanges(networks, n) {
+			orphaned = append(orphaned, route)
+		}
+	}
+	return orphaned
+}
+
+func inRanges(networks []*Network, n ip.IP4Net) bool {
+	for _, network := range networks {
+		for _, r := range network.IPAM.Ranges {
+			if r.ContainsNet(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Route states of a network in the node status annotation
+const (
+	StateRouted  = "Routed"
+	StateNoRange = "NoRange"
+	StateFailed  = "Failed"
+)
+
+// Status is the route status of one secondary network of a node
+type Status struct {
+	// CIDRs are the routed ranges of the node, also the ones to delete once the network is gone
+	CIDRs   []string `json:"cidrs,omitempty"`
+	State   string   `json:"state"`
+	Message string   `json:"message,omitempty"`
+}
+
+// Statuses returns the route status of each network of node by network key
+func Statuses(node *v1.Node) map[string]Status {
+	statuses := make(map[string]Status)
+	if s := node.Annotations[NodeAnnotationNetworkRoutesKey]; s != "" {
+		// an invalid annotation is overwritten with the current status
+		_ = json.Unmarshal([]byte(s), &statuses)
+	}
+	return statuses
+}
+
+// FormatStatuses returns the annotation value of statuses, empty if there are none
+func FormatStatuses(statuses map[string]Status) string {
+	if len(statuses) == 0 {
+		return ""
+	}
+	for key, status := range statuses {
+		sort.Strings(status.CIDRs)
+		statuses[key] = status
+	}
+	// encoding/json sorts map keys, so the value is stable
+	b, _ := json.Marshal(statuses)
+	return string(b)
+}
@@ -0,0 +1,210 @@
+package multus
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/model"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+)
+
+func newNAD(name string, annotations map[string]string, config string) *unstructured.Unstructured {
+	nad := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"config": config},
+	}}
+	nad.SetGroupVersionKind(NetworkAttachmentDefinitionGVK)
+	nad.SetNamespace("default")
+	nad.SetName(name)
+	nad.SetAnnotations(annotations)
+	return nad
+}
+
+func rangeStrings(network *Network) []string {
+	var s []string
+	for _, n := range network.IPAM.Ranges {
+		s = append(s, n.String())
+	}
+	return s
+}
+
+func TestParseNetwork(t *testing.T) {
+	optIn := map[string]string{AnnotationVPCRoute: "true"}
+	tests := []struct {
+		name    string
+		nad     *unstructured.Unstructured
+		nilNet  bool
+		ranges  []string
+		ipam    string
+		pool    string
+		wantErr bool
+	}{
+		{
+			name:   "not opted in",
+			nad:    newNAD("net1", nil, `{"type":"macvlan","ipam":{"type":"host-local","subnet":"10.1.0.0/24"}}`),
+			nilNet: true,
+		},
+		{
+			name:   "host-local subnet and ranges",
+			nad:    newNAD("net1", optIn, `{"type":"macvlan","ipam":{"type":"host-local","subnet":"10.1.0.0/24","ranges":[[{"subnet":"10.2.0.0/24"}],[{"subnet":"fd00::/64"}]]}}`),
+			ranges: []string{"10.1.0.0/24", "10.2.0.0/24"},
+			ipam:   IPAMHostLocal,
+		},
+		{
+			name:   "whereabouts in a config list",
+			nad:    newNAD("net2", optIn, `{"cniVersion":"0.3.1","plugins":[{"type":"macvlan","ipam":{"type":"whereabouts","range":"10.3.0.10-10.3.0.200/16","node_slice_size":"/24"}}]}`),
+			ranges: []string{"10.3.0.0/16"},
+			ipam:   IPAMWhereabouts,
+			pool:   "net2",
+		},
+		{
+			name:   "whereabouts network name",
+			nad:    newNAD("net2", optIn, `{"type":"macvlan","ipam":{"type":"whereabouts","ipRanges":[{"range":"10.3.0.0/16"}],"network_name":"shared"}}`),
+			ranges: []string{"10.3.0.0/16"},
+			ipam:   IPAMWhereabouts,
+			pool:   "shared",
+		},
+		{name: "unsupported ipam", nad: newNAD("net3", optIn, `{"type":"macvlan","ipam":{"type":"dhcp"}}`), wantErr: true},
+		{name: "no ipam", nad: newNAD("net3", optIn, `{"type":"macvlan"}`), wantErr: true},
+		{name: "config on the nodes", nad: newNAD("net3", optIn, ""), wantErr: true},
+		{name: "only ipv6", nad: newNAD("net3", optIn, `{"type":"macvlan","ipam":{"type":"host-local","subnet":"fd00::/64"}}`), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network, err := ParseNetwork(tt.nad)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNetwork() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if (network == nil) != tt.nilNet {
+				t.Fatalf("ParseNetwork() = %v, want nil %v", network, tt.nilNet)
+			}
+			if network == nil {
+				return
+			}
+			if got := rangeStrings(network); !reflect.DeepEqual(got, tt.ranges) {
+				t.Errorf("ranges = %v, want %v", got, tt.ranges)
+			}
+			if network.IPAM.Type != tt.ipam || network.IPAM.NetworkName != tt.pool {
+				t.Errorf("ipam = %s pool %q, want %s pool %q", network.IPAM.Type, network.IPAM.NetworkName, tt.ipam, tt.pool)
+			}
+		})
+	}
+}
+
+func TestNodeRanges(t *testing.T) {
+	hostLocal, _ := ParseNetwork(newNAD("net1", map[string]string{AnnotationVPCRoute: "true", AnnotationVPCRouteNode: "node-a"},
+		`{"type":"macvlan","ipam":{"type":"host-local","subnet":"10.1.0.0/24"}}`))
+	shared, _ := ParseNetwork(newNAD("net1", map[string]string{AnnotationVPCRoute: "true"},
+		`{"type":"macvlan","ipam":{"type":"host-local","subnet":"10.1.0.0/24"}}`))
+	sliced, _ := ParseNetwork(newNAD("net2", map[string]string{AnnotationVPCRoute: "true"},
+		`{"type":"macvlan","ipam":{"type":"whereabouts","range":"10.3.0.0/16","node_slice_size":"/24"}}`))
+	unsliced, _ := ParseNetwork(newNAD("net2", map[string]string{AnnotationVPCRoute: "true"},
+		`{"type":"macvlan","ipam":{"type":"whereabouts","range":"10.3.0.0/16"}}`))
+
+	pool := unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{"allocations": []interface{}{
+			map[string]interface{}{"nodeName": "node-a", "sliceRange": "10.3.1.0/24"},
+			map[string]interface{}{"nodeName": "node-b", "sliceRange": "10.3.2.0/24"},
+		}},
+	}}
+	pool.SetName("net2")
+	other := *pool.DeepCopy()
+	other.SetName("other")
+	pools := []unstructured.Unstructured{pool, other}
+
+	tests := []struct {
+		name    string
+		network *Network
+		node    string
+		ranges  []string
+		wantErr bool
+	}{
+		{name: "host-local on its node", network: hostLocal, node: "node-a", ranges: []string{"10.1.0.0/24"}},
+		{name: "host-local on another node", network: hostLocal, node: "node-b"},
+		{name: "host-local without node", network: shared, node: "node-a", wantErr: true},
+		{name: "whereabouts slice", network: sliced, node: "node-b", ranges: []string{"10.3.2.0/24"}},
+		{name: "whereabouts without slice", network: sliced, node: "node-c"},
+		{name: "whereabouts without node slices", network: unsliced, node: "node-a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, err := NodeRanges(tt.network, tt.node, pools)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NodeRanges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, n := range ranges {
+				got = append(got, n.String())
+			}
+			if !reflect.DeepEqual(got, tt.ranges) {
+				t.Errorf("NodeRanges() = %v, want %v", got, tt.ranges)
+			}
+		})
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	statuses := map[string]Status{
+		"default/net2": {CIDRs: []string{"10.3.2.0/24", "10.3.1.0/24"}, State: StateRouted},
+		"default/net1": {State: StateFailed, Message: "no slice"},
+	}
+	value := FormatStatuses(statuses)
+	want := `{"default/net1":{"state":"Failed","message":"no slice"},"default/net2":{"cidrs":["10.3.1.0/24","10.3.2.0/24"],"state":"Routed"}}`
+	if value != want {
+		t.Errorf("FormatStatuses() = %s, want %s", value, want)
+	}
+
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{NodeAnnotationNetworkRoutesKey: value}}}
+	if got := Statuses(node); !reflect.DeepEqual(got, statuses) {
+		t.Errorf("Statuses() = %v, want %v", got, statuses)
+	}
+	if FormatStatuses(nil) != "" {
+		t.Errorf("FormatStatuses(nil) is not empty")
+	}
+	node.Annotations[NodeAnnotationNetworkRoutesKey] = "invalid"
+	if got := Statuses(node); len(got) != 0 {
+		t.Errorf("Statuses() of invalid annotation = %v, want empty", got)
+	}
+}
+
+func TestOrphanedRoutes(t *testing.T) {
+	ranges := func(cidrs ...string) IPAM {
+		var ipam IPAM
+		for _, cidr := range cidrs {
+			n, err := ip.ParseIP4Net(cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ipam.Ranges = append(ipam.Ranges, n)
+		}
+		return ipam
+	}
+	networks := []*Network{
+		{Namespace: "default", Name: "net1", IPAM: ranges("10.3.0.0/16")},
+		{Namespace: "default", Name: "net2", IPAM: ranges("10.4.0.0/24")},
+	}
+	routes := []*model.Route{
+		{DestinationCIDR: "10.3.1.0/26", InstanceId: "i-current"},
+		// the node of i-deleted was deleted while the controller was down
+		{DestinationCIDR: "10.3.2.0/26", InstanceId: "i-deleted"},
+		{DestinationCIDR: "10.4.0.0/24", InstanceId: "i-deleted"},
+		// not inside a range of the networks
+		{DestinationCIDR: "172.16.0.0/24", InstanceId: "i-deleted"},
+		{DestinationCIDR: "10.4.0.0/23", InstanceId: "i-deleted"},
+		{DestinationCIDR: "10.3.3.0/26"},
+	}
+	var got []string
+	for _, route := range OrphanedRoutes(networks, routes, map[string]bool{"i-current": true}) {
+		got = append(got, route.DestinationCIDR)
+	}
+	want := []string{"10.3.2.0/26", "10.4.0.0/24"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OrphanedRoutes() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+// Package nodeipam carves the pod CIDRs of nodes out of the cluster CIDR, avoiding
+// the CIDRs already used by nodes and the ones reserved by the vpc.
+package nodeipam
+
+import (
+	"errors"
+	"fmt"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+)
+
+// ErrCIDRRangeExhausted is returned when no node CIDR of the cluster CIDR is free
+var ErrCIDRRangeExhausted = errors.New("no free node cidr in the cluster cidr")
+
+// Allocator hands out node CIDRs of the cluster CIDR which overlap none of the
+// occupied CIDRs. It is not safe for concurrent use.
+type Allocator struct {
+	cluster  ip.IP4Net
+	maskSize uint
+	occupied []ip.IP4Net
+}
+
+// NewAllocator creates an allocator of node CIDRs with prefix length maskSize
+func NewAllocator(clusterCIDR string, maskSize int) (*Allocator, error) {
+	cluster, err := ip.ParseIP4Net(clusterCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster cidr %q: %v", clusterCIDR, err)
+	}
+	if maskSize < int(cluster.PrefixLen) || maskSize > 32 {
+		return nil, fmt.Errorf("node cidr mask size %d must be between %d and 32", maskSize, cluster.PrefixLen)
+	}
+	return &Allocator{cluster: cluster, maskSize: uint(maskSize)}, nil
+}
+
+// ClusterCIDR returns the network node CIDRs are allocated from
+func (a *Allocator) ClusterCIDR() ip.IP4Net {
+	return a.cluster
+}
+
+// Occupy marks cidr as unavailable, it is a node CIDR in use or a range reserved
+// by the vpc. CIDRs outside the cluster CIDR are ignored.
+func (a *Allocator) Occupy(cidr ip.IP4Net) {
+	cidr = cidr.Network()
+	if !a.cluster.Overlaps(cidr) {
+		return
+	}
+	a.occupied = append(a.occupied, cidr)
+}
+
+// Next returns the first free node CIDR and occupies it
+func (a *Allocator) Next() (ip.IP4Net, error) {
+	candidate := ip.IP4Net{IP: a.cluster.IP, PrefixLen: a.maskSize}
+	for a.cluster.ContainsNet(candidate) {
+		blocking, occupied := a.largestOverlap(candidate)
+		if !occupied {
+			a.occupied = append(a.occupied, candidate)
+			return candidate, nil
+		}
+		next := candidate.Next()
+		if blocking.PrefixLen < a.maskSize {
+			// a larger occupied CIDR covers the following candidates as well, its
+			// end is aligned to the node mask size
+			next = ip.IP4Net{IP: blocking.Next().IP, PrefixLen: a.maskSize}
+		}
+		if next.IP <= candidate.IP {
+			// wrapped around the end of the address space
+			break
+		}
+		candidate = next
+	}
+	return ip.IP4Net{}, ErrCIDRRangeExhausted
+}
+
+// largestOverlap returns the largest occupied CIDR overlapping candidate
+func (a *Allocator) largestOverlap(candidate ip.IP4Net) (ip.IP4Net, bool) {
+	var largest ip.IP4Net
+	found := false
+	for _, o := range a.occupied {
+		if o.Overlaps(candidate) && (!found || o.PrefixLen < largest.PrefixLen) {
+			largest, found = o, true
+		}
+	}
+	return largest, found
+}
@@ -0,0 +1,85 @@
+package nodeipam
+
+import (
+	"testing"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+)
+
+func TestNewAllocator(t *testing.T) {
+	if _, err := NewAllocator("10.0.0.0/16", 24); err != nil {
+		t.Errorf("NewAllocator() error = %v", err)
+	}
+	for _, tt := range []struct {
+		cidr string
+		mask int
+	}{{"10.0.0.0/16", 8}, {"10.0.0.0/16", 33}, {"fd00::/64", 80}, {"bad", 24}} {
+		if _, err := NewAllocator(tt.cidr, tt.mask); err == nil {
+			t.Errorf("NewAllocator(%s, %d), want error", tt.cidr, tt.mask)
+		}
+	}
+}
+
+func TestAllocatorNext(t *testing.T) {
+	a, err := NewAllocator("10.0.0.0/22", 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a node cidr in use, a vpc subnet and a route of another cluster
+	a.Occupy(mustParse("10.0.0.0/24"))
+	a.Occupy(mustParse("10.0.1.128/25"))
+	a.Occupy(mustParse("192.168.0.0/16"))
+
+	var got []string
+	for {
+		n, err := a.Next()
+		if err == ErrCIDRRangeExhausted {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		got = append(got, n.String())
+	}
+	want := []string{"10.0.2.0/24", "10.0.3.0/24"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+}
+
+func TestAllocatorSkipsLargeRanges(t *testing.T) {
+	a, err := NewAllocator("10.0.0.0/8", 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the vpc cidr covers most of the cluster cidr
+	a.Occupy(mustParse("10.0.0.0/9"))
+	n, err := a.Next()
+	if err != nil || n.String() != "10.128.0.0/24" {
+		t.Errorf("Next() = %v, %v, want 10.128.0.0/24", n, err)
+	}
+
+	// the last candidate of the address space
+	last, _ := NewAllocator("255.255.254.0/23", 24)
+	last.Occupy(mustParse("255.255.254.0/24"))
+	if n, err := last.Next(); err != nil || n.String() != "255.255.255.0/24" {
+		t.Errorf("Next() = %v, %v, want 255.255.255.0/24", n, err)
+	}
+	if _, err := last.Next(); err != ErrCIDRRangeExhausted {
+		t.Errorf("Next() at the end of the address space error = %v, want %v", err, ErrCIDRRangeExhausted)
+	}
+
+	full, _ := NewAllocator("10.0.0.0/16", 24)
+	full.Occupy(mustParse("0.0.0.0/0"))
+	if _, err := full.Next(); err != ErrCIDRRangeExhausted {
+		t.Errorf("Next() of a full allocator error = %v, want %v", err, ErrCIDRRangeExhausted)
+	}
+}
+
+func mustParse(s string) ip.IP4Net {
+	n, err := ip.ParseIP4Net(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
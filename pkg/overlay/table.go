@@ -0,0 +1,112 @@
+// Package overlay tunnels pod traffic to peer nodes over UDP through a TUN device.
+// It is a degraded mode fallback for peers whose vpc route is missing and that
+// are not reachable with a host-gw route.
+package overlay
+
+import (
+	"net"
+	"sync"
+)
+
+// Peer is a node whose pod CIDRs are reached through the tunnel
+type Peer struct {
+	Name     string
+	IP       net.IP
+	PodCIDRs []*net.IPNet
+}
+
+// Reasons packets are dropped
+const (
+	dropNotIPv4     = "not_ipv4"
+	dropNoPeer      = "no_peer"
+	dropUnknownPeer = "unknown_peer"
+	dropSpoofed     = "spoofed"
+)
+
+// table maps pod CIDRs to peers, and validates the packets received from them
+type table struct {
+	lock  sync.RWMutex
+	local []*net.IPNet
+	// peers are the nodes this node tunnels to
+	peers []Peer
+	// nodes are all known nodes, a node tunnels to this one whenever its own view
+	// of the vpc route differs, so packets are accepted from any of them
+	nodes []Peer
+}
+
+func (t *table) set(local []*net.IPNet, peers, nodes []Peer) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.local = local
+	t.peers = peers
+	t.nodes = nodes
+}
+
+func (t *table) list() (peers, nodes []Peer) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.peers, t.nodes
+}
+
+// route returns the peer the packet read from the TUN device is sent to
+func (t *table) route(pkt []byte) (*Peer, string) {
+	if !isIPv4(pkt) {
+		return nil, dropNotIPv4
+	}
+	dst := net.IP(pkt[16:20])
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	var best *Peer
+	bestOnes := -1
+	for i := range t.peers {
+		for _, cidr := range t.peers[i].PodCIDRs {
+			ones, _ := cidr.Mask.Size()
+			if ones > bestOnes && cidr.Contains(dst) {
+				best, bestOnes = &t.peers[i], ones
+			}
+		}
+	}
+	if best == nil {
+		return nil, dropNoPeer
+	}
+	return best, ""
+}
+
+// accept returns the node a packet received from addr came from. The packet has to
+// come from a known node, from one of its pod CIDRs, and go to a local pod CIDR. The
+// node need not be a peer: only its vpc route may be missing from its point of view.
+func (t *table) accept(addr net.IP, pkt []byte) (*Peer, string) {
+	if !isIPv4(pkt) {
+		return nil, dropNotIPv4
+	}
+	src, dst := net.IP(pkt[12:16]), net.IP(pkt[16:20])
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	var peer *Peer
+	for i := range t.nodes {
+		if t.nodes[i].IP.Equal(addr) {
+			peer = &t.nodes[i]
+			break
+		}
+	}
+	if peer == nil {
+		return nil, dropUnknownPeer
+	}
+	if !contains(peer.PodCIDRs, src) || !contains(t.local, dst) {
+		return peer, dropSpoofed
+	}
+	return peer, ""
+}
+
+func isIPv4(pkt []byte) bool {
+	return len(pkt) >= 20 && pkt[0]>>4 == 4
+}
+
+func contains(cidrs []*net.IPNet, ip net.IP) bool {
+	for _, cidr := range cidrs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package overlay
+
+import (
+	"net"
+	"testing"
+)
+
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatalf("ParseCIDR(%q): %v", s, err)
+	}
+	return n
+}
+
+// packet returns a minimal IPv4 header from src to dst
+func packet(src, dst string) []byte {
+	pkt := make([]byte, 20)
+	pkt[0] = 0x45
+	copy(pkt[12:16], net.ParseIP(src).To4())
+	copy(pkt[16:20], net.ParseIP(dst).To4())
+	return pkt
+}
+
+func newTestTable(t *testing.T) *table {
+	peers := []Peer{
+		{Name: "a", IP: net.ParseIP("10.0.1.2"), PodCIDRs: []*net.IPNet{mustCIDR(t, "172.16.1.0/24")}},
+		{Name: "b", IP: net.ParseIP("10.0.2.2"), PodCIDRs: []*net.IPNet{mustCIDR(t, "172.16.2.0/23"), mustCIDR(t, "172.16.3.0/25")}},
+	}
+	// c is reached over its vpc route, but c may find the route of this node missing
+	nodes := append(append([]Peer{}, peers...),
+		Peer{Name: "c", IP: net.ParseIP("10.0.4.2"), PodCIDRs: []*net.IPNet{mustCIDR(t, "172.16.4.0/24")}})
+	tb := &table{}
+	tb.set([]*net.IPNet{mustCIDR(t, "172.16.0.0/24")}, peers, nodes)
+	return tb
+}
+
+func TestTableRoute(t *testing.T) {
+	tb := newTestTable(t)
+	tests := []struct {
+		pkt    []byte
+		peer   string
+		reason string
+	}{
+		{pkt: packet("172.16.0.5", "172.16.1.9"), peer: "a"},
+		{pkt: packet("172.16.0.5", "172.16.2.9"), peer: "b"},
+		{pkt: packet("172.16.0.5", "172.16.3.9"), peer: "b"},
+		{pkt: packet("172.16.0.5", "172.16.9.9"), reason: dropNoPeer},
+		// c is not tunneled to, its pods are reached over the vpc
+		{pkt: packet("172.16.0.5", "172.16.4.9"), reason: dropNoPeer},
+		{pkt: []byte{0x60, 0, 0}, reason: dropNotIPv4},
+	}
+	for _, tt := range tests {
+		peer, reason := tb.route(tt.pkt)
+		if reason != tt.reason {
+			t.Errorf("route reason = %q, want %q", reason, tt.reason)
+		}
+		if tt.peer != "" && (peer == nil || peer.Name != tt.peer) {
+			t.Errorf("route peer = %+v, want %s", peer, tt.peer)
+		}
+	}
+}
+
+func TestTableAccept(t *testing.T) {
+	tb := newTestTable(t)
+	tests := []struct {
+		name   string
+		addr   string
+		pkt    []byte
+		reason string
+	}{
+		{name: "valid", addr: "10.0.1.2", pkt: packet("172.16.1.9", "172.16.0.5")},
+		{name: "unknown peer", addr: "10.0.9.9", pkt: packet("172.16.1.9", "172.16.0.5"), reason: dropUnknownPeer},
+		{name: "node not tunneled to", addr: "10.0.4.2", pkt: packet("172.16.4.9", "172.16.0.5")},
+		{name: "source of a node not tunneled to", addr: "10.0.4.2", pkt: packet("172.16.1.9", "172.16.0.5"), reason: dropSpoofed},
+		{name: "source of another peer", addr: "10.0.1.2", pkt: packet("172.16.2.9", "172.16.0.5"), reason: dropSpoofed},
+		{name: "not to a local pod", addr: "10.0.1.2", pkt: packet("172.16.1.9", "8.8.8.8"), reason: dropSpoofed},
+		{name: "truncated", addr: "10.0.1.2", pkt: []byte{0x45}, reason: dropNotIPv4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, reason := tb.accept(net.ParseIP(tt.addr), tt.pkt); reason != tt.reason {
+				t.Errorf("accept reason = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package overlay
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/klog/v2"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/ip"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
+)
+
+const (
+	// routeProtocol marks the kernel routes into the tunnel, see `ip route show proto 87`
+	routeProtocol = 87
+	// encapOverhead is the outer IPv4 and UDP header
+	encapOverhead = 28
+	maxPacketSize = 65535
+)
+
+// Tunnel sends the packets routed into a TUN device to the peer owning their
+// destination over UDP, and writes the packets received from peers back into it.
+type Tunnel struct {
+	name string
+	port int
+
+	table table
+
+	lock sync.Mutex
+	tun  *os.File
+	link netlink.Link
+	conn *net.UDPConn
+	// addr is the address of the TUN device, the first ip of the local pod CIDR
+	addr *net.IPNet
+}
+
+// NewTunnel creates a tunnel on the TUN device name, peers are reached on udp port
+func NewTunnel(name string, port int) *Tunnel {
+	return &Tunnel{name: name, port: port}
+}
+
+// Start opens the TUN device and the UDP socket and forwards packets until ctx is done
+func (t *Tunnel) Start(ctx context.Context) error {
+	logger := klog.FromContext(ctx).WithValues("device", t.name, "port", t.port)
+	tun, ifname, err := ip.OpenTun(t.name)
+	if err != nil {
+		return fmt.Errorf("open tun device %s: %v", t.name, err)
+	}
+	link, err := netlink.LinkByName(ifname)
+	if err != nil {
+		tun.Close()
+		return fmt.Errorf("get tun device %s: %v", ifname, err)
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		tun.Close()
+		return fmt.Errorf("set tun device %s up: %v", ifname, err)
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: t.port})
+	if err != nil {
+		tun.Close()
+		return fmt.Errorf("listen on udp port %d: %v", t.port, err)
+	}
+
+	t.lock.Lock()
+	t.tun, t.link, t.conn = tun, link, conn
+	t.lock.Unlock()
+	logger.Info("Started overlay tunnel")
+
+	done := make(chan struct{}, 2)
+	go func() { t.send(logger); done <- struct{}{} }()
+	go func() { t.receive(logger); done <- struct{}{} }()
+
+	select {
+	case <-ctx.Done():
+	case <-done:
+		err = fmt.Errorf("overlay tunnel %s stopped", ifname)
+	}
+	conn.Close()
+	tun.Close()
+	return err
+}
+
+// send forwards the packets read from the TUN device to their peer
+func (t *Tunnel) send(logger klog.Logger) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, err := t.tun.Read(buf)
+		if err != nil {
+			logger.Error(err, "Failed to read from tun device")
+			return
+		}
+		peer, reason := t.table.route(buf[:n])
+		if peer == nil {
+			metric.OverlayDroppedPackets.WithLabelValues(reason).Inc()
+			continue
+		}
+		if _, err := t.conn.WriteToUDP(buf[:n], &net.UDPAddr{IP: peer.IP, Port: t.port}); err != nil {
+			logger.V(4).Info("Failed to send packet to peer", "peer", peer.Name, "err", err)
+			metric.OverlayDroppedPackets.WithLabelValues("send_error").Inc()
+			continue
+		}
+		metric.OverlayPeerPackets.WithLabelValues(peer.Name, "tx").Inc()
+		metric.OverlayPeerBytes.WithLabelValues(peer.Name, "tx").Add(float64(n))
+	}
+}
+
+// receive writes the packets received from peers into the TUN device
+func (t *Tunnel) receive(logger klog.Logger) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := t.conn.ReadFromUDP(buf)
+		if err != nil {
+			logger.Error(err, "Failed to read from udp socket")
+			return
+		}
+		peer, reason := t.table.accept(addr.IP, buf[:n])
+		if reason != "" {
+			metric.OverlayDroppedPackets.WithLabelValues(reason).Inc()
+			continue
+		}
+		if _, err := t.tun.Write(buf[:n]); err != nil {
+			logger.V(4).Info("Failed to write packet to tun device", "peer", peer.Name, "err", err)
+			metric.OverlayDroppedPackets.WithLabelValues("write_error").Inc()
+			continue
+		}
+		metric.OverlayPeerPackets.WithLabelValues(peer.Name, "rx").Inc()
+		metric.OverlayPeerBytes.WithLabelValues(peer.Name, "rx").Add(float64(n))
+	}
+}
+
+// Sync routes the pod CIDRs of peers into the tunnel, and removes the routes and
+// metrics of the peers no longer tunneled. local are the pod CIDRs of the node and
+// mtu the mtu of its interface. Packets are accepted from all nodes, peers included.
+func (t *Tunnel) Sync(ctx context.Context, local []*net.IPNet, mtu int, peers, nodes []Peer) error {
+	t.lock.Lock()
+	link := t.link
+	t.lock.Unlock()
+	if link == nil {
+		return fmt.Errorf("overlay tunnel %s is not started", t.name)
+	}
+	logger := klog.FromContext(ctx)
+
+	if err := t.setAddr(link, local, mtu); err != nil {
+		return err
+	}
+
+	previous, previousNodes := t.table.list()
+	t.table.set(local, peers, nodes)
+
+	var errs []string
+	if err := syncKernelRoutes(ctx, link, peers); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	current := make(map[string]bool, len(peers))
+	for _, p := range peers {
+		current[p.Name] = true
+	}
+	for _, p := range previous {
+		if !current[p.Name] {
+			logger.Info("Removed overlay peer", "peer", p.Name, "peerIP", p.IP.String())
+		}
+	}
+	// packets are received from every node, so metrics are kept while the node exists
+	known := make(map[string]bool, len(nodes)+len(peers))
+	for _, p := range append(nodes, peers...) {
+		known[p.Name] = true
+	}
+	for _, p := range append(previousNodes, previous...) {
+		if known[p.Name] {
+			continue
+		}
+		for _, direction := range []string{"tx", "rx"} {
+			metric.OverlayPeerPackets.DeleteLabelValues(p.Name, direction)
+			metric.OverlayPeerBytes.DeleteLabelValues(p.Name, direction)
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("sync overlay tunnel: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// setAddr gives the TUN device the first ip of the local pod CIDR, the source of
+// host originated packets to peer pods, and the mtu left after encapsulation
+func (t *Tunnel) setAddr(link netlink.Link, local []*net.IPNet, mtu int) error {
+	if mtu > encapOverhead && link.Attrs().MTU != mtu-encapOverhead {
+		if err := netlink.LinkSetMTU(link, mtu-encapOverhead); err != nil {
+			return fmt.Errorf("set mtu of %s: %v", t.name, err)
+		}
+	}
+	if len(local) == 0 {
+		return nil
+	}
+	addr := &net.IPNet{IP: local[0].IP.Mask(local[0].Mask), Mask: net.CIDRMask(32, 32)}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.addr != nil && t.addr.String() == addr.String() {
+		return nil
+	}
+	if err := netlink.AddrReplace(link, &netlink.Addr{IPNet: addr}); err != nil {
+		return fmt.Errorf("set address %s of %s: %v", addr, t.name, err)
+	}
+	t.addr = addr
+	return nil
+}
+
+// syncKernelRoutes routes the pod CIDRs of peers into the TUN device and deletes the
+// other routes owned by the tunnel
+func syncKernelRoutes(ctx context.Context, link netlink.Link, peers []Peer) error {
+	logger := klog.FromContext(ctx)
+	index := link.Attrs().Index
+	desired := make(map[string]*netlink.Route)
+	for _, p := range peers {
+		for _, cidr := range p.PodCIDRs {
+			desired[cidr.String()] = &netlink.Route{
+				LinkIndex: index,
+				Dst:       cidr,
+				Scope:     netlink.SCOPE_LINK,
+				Protocol:  routeProtocol,
+			}
+		}
+	}
+
+	existing, err := netlink.RouteList(nil, syscall.AF_INET)
+	if err != nil {
+		return fmt.Errorf("list kernel routes: %v", err)
+	}
+	var errs []string
+	for i := range existing {
+		route := existing[i]
+		if route.Protocol != routeProtocol || route.Dst == nil {
+			continue
+		}
+		if _, ok := desired[route.Dst.String()]; ok && route.LinkIndex == index {
+			delete(desired, route.Dst.String())
+			continue
+		}
+		if _, ok := desired[route.Dst.String()]; ok {
+			// replaced below
+			continue
+		}
+		if err := netlink.RouteDel(&route); err != nil {
+			errs = append(errs, fmt.Sprintf("delete route %s: %v", route.Dst, err))
+			continue
+		}
+		logger.Info("Withdrew overlay route", "cidr", route.Dst.String())
+	}
+	for _, route := range desired {
+		if err := netlink.RouteReplace(route); err != nil {
+			errs = append(errs, fmt.Sprintf("add route %s: %v", route.Dst, err))
+			continue
+		}
+		logger.Info("Added overlay route", "cidr", route.Dst.String(), "device", link.Attrs().Name)
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("sync overlay routes: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
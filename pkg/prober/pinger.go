@@ -0,0 +1,82 @@
+package prober
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// protocolICMP is the IANA protocol number of ICMP for IPv4
+const protocolICMP = 1
+
+// Pinger sends an echo request to addr and waits up to timeout for the reply
+type Pinger interface {
+	Ping(ctx context.Context, addr net.IP, timeout time.Duration) (time.Duration, error)
+}
+
+// icmpPinger pings over a raw ICMP socket, the agent needs CAP_NET_RAW. Each ping
+// opens its own socket and matches the reply by peer, id and sequence, as every raw
+// socket receives all echo replies.
+type icmpPinger struct {
+	id  int
+	seq uint32
+}
+
+// NewICMPPinger returns a pinger over a raw ICMP socket
+func NewICMPPinger() Pinger {
+	return &icmpPinger{id: os.Getpid() & 0xffff}
+}
+
+func (p *icmpPinger) Ping(ctx context.Context, addr net.IP, timeout time.Duration) (time.Duration, error) {
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return 0, fmt.Errorf("listen icmp: %v", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	seq := int(atomic.AddUint32(&p.seq, 1) & 0xffff)
+	request := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: p.id, Seq: seq, Data: []byte("kce-pod-network-probe")},
+	}
+	b, err := request.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	if _, err := conn.WriteTo(b, &net.IPAddr{IP: addr}); err != nil {
+		return 0, fmt.Errorf("send echo request to %s: %v", addr, err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, fmt.Errorf("no echo reply from %s: %v", addr, err)
+		}
+		if peerAddr, ok := peer.(*net.IPAddr); !ok || !peerAddr.IP.Equal(addr) {
+			continue
+		}
+		reply, err := icmp.ParseMessage(protocolICMP, buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.ID == p.id && echo.Seq == seq {
+			return time.Since(start), nil
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package prober
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/util/metric"
+)
+
+const (
+	// probeAttempts is how many echo requests a target gets before it is unreachable
+	probeAttempts = 3
+	// probeWorkers is how many targets are probed at once
+	probeWorkers = 16
+)
+
+// Options configures the prober
+type Options struct {
+	// Interval between two probe rounds
+	Interval time.Duration
+	// Timeout of one echo request
+	Timeout time.Duration
+	// Sample is how many peers are probed per round, all if 0
+	Sample int
+	// Offset of the probe address in the pod CIDR of a peer without probe address, 0 skips them
+	Offset int
+}
+
+// Prober probes the pod network of the peers of a node and publishes the results on it.
+// It is a manager runnable, the manager cache has to hold all nodes.
+type Prober struct {
+	client   client.Client
+	nodeName string
+	opts     Options
+	pinger   Pinger
+	// addrs lists the addresses of the local devices
+	addrs func() ([]net.Addr, error)
+
+	lock   sync.Mutex
+	cursor int
+	// results is the last result of each peer, kept across rounds when peers are sampled
+	results map[string]Result
+}
+
+// New returns a prober of the node nodeName
+func New(c client.Client, nodeName string, pinger Pinger, opts Options) *Prober {
+	return &Prober{
+		client:   c,
+		nodeName: nodeName,
+		opts:     opts,
+		pinger:   pinger,
+		addrs:    net.InterfaceAddrs,
+		results:  make(map[string]Result),
+	}
+}
+
+// Start probes every interval until ctx is done
+func (p *Prober) Start(ctx context.Context) error {
+	logger := klog.FromContext(ctx).WithValues("node", p.nodeName)
+	ctx = klog.NewContext(ctx, logger)
+	logger.Info("Started pod network prober", "interval", p.opts.Interval, "sample", p.opts.Sample)
+
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.probe(ctx); err != nil {
+			logger.Error(err, "Failed to probe pod network")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe runs one round and publishes the results
+func (p *Prober) probe(ctx context.Context) error {
+	nodes := &v1.NodeList{}
+	if err := p.client.List(ctx, nodes); err != nil {
+		return fmt.Errorf("list nodes: %v", err)
+	}
+	targets := Targets(nodes.Items, p.nodeName, p.opts.Offset)
+
+	p.lock.Lock()
+	probed, cursor := sample(targets, p.opts.Sample, p.cursor)
+	p.cursor = cursor
+	p.lock.Unlock()
+
+	fresh := p.ping(ctx, probed)
+
+	p.lock.Lock()
+	results := make(map[string]Result, len(targets))
+	for _, target := range targets {
+		if result, ok := fresh[target.Name]; ok {
+			results[target.Name] = result
+		} else if result, ok := p.results[target.Name]; ok && result.Target.Addr.Equal(target.Addr) {
+			results[target.Name] = result
+		}
+	}
+	for name := range p.results {
+		if _, ok := results[name]; !ok {
+			metric.PodNetworkReachable.DeleteLabelValues(p.nodeName, name)
+		}
+	}
+	for name, result := range fresh {
+		if previous, ok := p.results[name]; ok && previous.Reachable != result.Reachable {
+			klog.FromContext(ctx).Info("Peer pod network reachability changed", "peer", name,
+				"address", result.Target.Addr.String(), "reachable", result.Reachable, "err", result.Err)
+		}
+	}
+	p.results = results
+	p.lock.Unlock()
+
+	for name, result := range results {
+		value := 0.0
+		if result.Reachable {
+			value = 1
+		}
+		metric.PodNetworkReachable.WithLabelValues(p.nodeName, name).Set(value)
+	}
+	return p.publish(ctx, results)
+}
+
+// ping probes targets with up to probeWorkers at once
+func (p *Prober) ping(ctx context.Context, targets []Target) map[string]Result {
+	results := make(map[string]Result, len(targets))
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan Target)
+	for i := 0; i < probeWorkers && i < len(targets); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range queue {
+				result := Result{Target: target}
+				for attempt := 0; attempt < probeAttempts && !result.Reachable; attempt++ {
+					result.RTT, result.Err = p.pinger.Ping(ctx, target.Addr, p.opts.Timeout)
+					result.Reachable = result.Err == nil
+				}
+				lock.Lock()
+				results[target.Name] = result
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, target := range targets {
+		queue <- target
+	}
+	close(queue)
+	wg.Wait()
+	return results
+}
+
+// publish sets the PodNetworkReachable condition, the unreachable peers annotation and
+// the local probe address annotation of the local node, each only when it changed
+func (p *Prober) publish(ctx context.Context, results map[string]Result) error {
+	node := &v1.Node{}
+	if err := p.client.Get(ctx, types.NamespacedName{Name: p.nodeName}, node); err != nil {
+		return fmt.Errorf("get node %s: %v", p.nodeName, err)
+	}
+
+	annotations := map[string]string{
+		NodeAnnotationUnreachablePeersKey:  strings.Join(Unreachable(results), ","),
+		NodeAnnotationLocalProbeAddressKey: "",
+	}
+	if addrs, err := p.addrs(); err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to list local addresses")
+		annotations[NodeAnnotationLocalProbeAddressKey] = node.Annotations[NodeAnnotationLocalProbeAddressKey]
+	} else if addr := LocalAddress(node, addrs); addr != nil {
+		annotations[NodeAnnotationLocalProbeAddressKey] = addr.String()
+	}
+	changed := false
+	for key, value := range annotations {
+		if node.Annotations[key] != value {
+			changed = true
+		}
+	}
+	if changed {
+		getter := func(obj runtime.Object) (client.Object, error) {
+			n, ok := obj.(*v1.Node)
+			if !ok {
+				return nil, fmt.Errorf("expect node, got %T", obj)
+			}
+			if n.Annotations == nil {
+				n.Annotations = make(map[string]string)
+			}
+			for key, value := range annotations {
+				if value == "" {
+					delete(n.Annotations, key)
+				} else {
+					n.Annotations[key] = value
+				}
+			}
+			return n, nil
+		}
+		if err := helper.PatchM(p.client, node.DeepCopy(), getter, helper.PatchSpec); err != nil {
+			return fmt.Errorf("record probe annotations: %v", err)
+		}
+	}
+
+	status, reason, message := condition(results)
+	current, ok := helper.FindCondition(node.Status.Conditions, NodePodNetworkReachable)
+	if ok && current.Status == status && current.Reason == reason && current.Message == message {
+		return nil
+	}
+	if !ok || current.Status != status {
+		klog.FromContext(ctx).Info("Pod network reachability changed", "status", status, "reason", reason, "message", message)
+	}
+	if err := helper.SetNodeCondition(p.client, node, NodePodNetworkReachable, status, reason, message); err != nil {
+		return fmt.Errorf("update %s condition: %v", NodePodNetworkReachable, err)
+	}
+	return nil
+}
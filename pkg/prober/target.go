@@ -0,0 +1,240 @@
+// Package prober checks the pod network datapath from the node the agent runs on. It
+// pings a probe address in the pod network of every other node, or a rotating sample
+// of them, and reports the result in the PodNetworkReachable node condition.
+package prober
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/controller/helper"
+)
+
+const (
+	// NodePodNetworkReachable is true while the probe addresses of all probed peers answer
+	NodePodNetworkReachable v1.NodeConditionType = "PodNetworkReachable"
+
+	// NodeAnnotationProbeAddressKey overrides the probe address of the node
+	NodeAnnotationProbeAddressKey = "kce.sdns.ksyun.com/probe-address"
+	// NodeAnnotationLocalProbeAddressKey is published by the agent of the node, an
+	// address of a local device inside the pod CIDRs, like cni0 or a tunnel device
+	NodeAnnotationLocalProbeAddressKey = "kce.sdns.ksyun.com/local-probe-address"
+	// NodeAnnotationUnreachablePeersKey lists the peers whose probe address did not answer the node
+	NodeAnnotationUnreachablePeersKey = "kce.sdns.ksyun.com/unreachable-peers"
+
+	reasonPeersReachable   = "PeersReachable"
+	reasonPeersUnreachable = "PeersUnreachable"
+	reasonNoPeers          = "NoPeers"
+
+	// maxListedPeers limits the peers named in the condition message
+	maxListedPeers = 5
+)
+
+// Target is a peer node and the address probed in its pod CIDR
+type Target struct {
+	Name string
+	Addr net.IP
+}
+
+// Result is the last probe of a target
+type Result struct {
+	Target    Target
+	Reachable bool
+	RTT       time.Duration
+	Err       error
+}
+
+// probeAddressKeys are the annotations holding an address that answers ping on the
+// node, by precedence. The calico tunnel addresses are taken from its IPAM blocks.
+var probeAddressKeys = []string{
+	NodeAnnotationProbeAddressKey,
+	NodeAnnotationLocalProbeAddressKey,
+	"projectcalico.org/IPv4IPIPTunnelAddr",
+	"projectcalico.org/IPv4VXLANTunnelAddr",
+}
+
+// TargetOf returns the probe target of node: the address of the first probe address
+// annotation it has, else the address at offset in its first IPv4 pod CIDR. Nothing
+// is known to answer in the pod CIDR, so a node without annotation has no target
+// while offset is 0.
+func TargetOf(node *v1.Node, offset int) (*Target, error) {
+	for _, key := range probeAddressKeys {
+		s, ok := node.Annotations[key]
+		if !ok {
+			continue
+		}
+		addr := net.ParseIP(s).To4()
+		if addr == nil {
+			return nil, fmt.Errorf("invalid %s %q", key, s)
+		}
+		return &Target{Name: node.Name, Addr: addr}, nil
+	}
+	if offset == 0 {
+		return nil, fmt.Errorf("node %s has no probe address", node.Name)
+	}
+	for _, s := range append(node.Spec.PodCIDRs, node.Spec.PodCIDR) {
+		_, cidr, err := net.ParseCIDR(s)
+		if err != nil || cidr.IP.To4() == nil {
+			continue
+		}
+		ones, bits := cidr.Mask.Size()
+		if offset < 0 || uint64(offset) >= uint64(1)<<(bits-ones) {
+			return nil, fmt.Errorf("probe offset %d out of pod CIDR %s", offset, cidr)
+		}
+		addr := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(addr, binary.BigEndian.Uint32(cidr.IP.To4())+uint32(offset))
+		return &Target{Name: node.Name, Addr: addr}, nil
+	}
+	return nil, fmt.Errorf("node %s has no IPv4 pod CIDR", node.Name)
+}
+
+// LocalAddress returns the first IPv4 address of addrs inside a pod CIDR of node,
+// other than the network address, or nil
+func LocalAddress(node *v1.Node, addrs []net.Addr) net.IP {
+	var cidrs []*net.IPNet
+	for _, s := range append(node.Spec.PodCIDRs, node.Spec.PodCIDR) {
+		if _, cidr, err := net.ParseCIDR(s); err == nil && cidr.IP.To4() != nil {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.To4() == nil {
+			continue
+		}
+		addr := ipnet.IP.To4()
+		for _, cidr := range cidrs {
+			if cidr.Contains(addr) && !cidr.IP.Equal(addr) {
+				return addr
+			}
+		}
+	}
+	return nil
+}
+
+// Targets returns the probe targets of the peers of the local node sorted by name.
+// Peers that are not ready or whose route is not created yet are left out, their pods
+// are expected to be unreachable.
+func Targets(nodes []v1.Node, local string, offset int) []Target {
+	var targets []Target
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Name == local || !probeable(node) {
+			continue
+		}
+		target, err := TargetOf(node, offset)
+		if err != nil {
+			continue
+		}
+		targets = append(targets, *target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+	return targets
+}
+
+func probeable(node *v1.Node) bool {
+	if cond := helper.GetNodeCondition(node, v1.NodeReady); cond == nil || cond.Status != v1.ConditionTrue {
+		return false
+	}
+	if cond := helper.GetNodeCondition(node, v1.NodeNetworkUnavailable); cond != nil && cond.Status == v1.ConditionTrue {
+		return false
+	}
+	return true
+}
+
+// sample returns n targets starting at cursor, wrapping around, and the next cursor.
+// Successive rounds rotate through all targets.
+func sample(targets []Target, n, cursor int) ([]Target, int) {
+	if n <= 0 || n >= len(targets) {
+		return targets, 0
+	}
+	cursor %= len(targets)
+	sampled := make([]Target, 0, n)
+	for i := 0; i < n; i++ {
+		sampled = append(sampled, targets[(cursor+i)%len(targets)])
+	}
+	return sampled, (cursor + n) % len(targets)
+}
+
+// Unreachable returns the sorted names of the unreachable targets in results
+func Unreachable(results map[string]Result) []string {
+	var names []string
+	for name, result := range results {
+		if !result.Reachable {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// condition returns the PodNetworkReachable status, reason and message for results
+func condition(results map[string]Result) (v1.ConditionStatus, string, string) {
+	if len(results) == 0 {
+		return v1.ConditionUnknown, reasonNoPeers, "No peer node to probe"
+	}
+	unreachable := Unreachable(results)
+	if len(unreachable) == 0 {
+		return v1.ConditionTrue, reasonPeersReachable,
+			fmt.Sprintf("Pods of all %d probed peers are reachable", len(results))
+	}
+	listed := unreachable
+	if len(listed) > maxListedPeers {
+		listed = listed[:maxListedPeers]
+	}
+	message := fmt.Sprintf("Pods of %d of %d probed peers are unreachable: %s",
+		len(unreachable), len(results), strings.Join(listed, ", "))
+	if len(unreachable) > len(listed) {
+		message += fmt.Sprintf(" and %d more", len(unreachable)-len(listed))
+	}
+	return v1.ConditionFalse, reasonPeersUnreachable, message
+}
+
+// Votes counts how many reporting peers can not reach the pods of a node
+type Votes struct {
+	// Reporters is the number of other nodes that publish a PodNetworkReachable condition
+	Reporters int
+	// Unreachable is the number of reporters that list the node as unreachable
+	Unreachable int
+}
+
+// Broken reports whether most reporters can not reach the pods of the node. When only a
+// few reporters fail, their own datapath is more likely broken than the one of the node.
+func (v Votes) Broken() bool {
+	return v.Unreachable > 0 && v.Unreachable*2 > v.Reporters
+}
+
+// Tally collects the probe results the nodes published into the votes per node
+func Tally(nodes []v1.Node) map[string]Votes {
+	var reporters []*v1.Node
+	for i := range nodes {
+		if cond := helper.GetNodeCondition(&nodes[i], NodePodNetworkReachable); cond != nil && cond.Status != v1.ConditionUnknown {
+			reporters = append(reporters, &nodes[i])
+		}
+	}
+	votes := make(map[string]Votes, len(nodes))
+	for i := range nodes {
+		name := nodes[i].Name
+		v := Votes{}
+		for _, reporter := range reporters {
+			if reporter.Name == name {
+				continue
+			}
+			v.Reporters++
+			for _, peer := range strings.Split(reporter.Annotations[NodeAnnotationUnreachablePeersKey], ",") {
+				if peer == name {
+					v.Unreachable++
+					break
+				}
+			}
+		}
+		votes[name] = v
+	}
+	return votes
+}
@@ -0,0 +1,205 @@
+package prober
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newNode(name, podCidr string, ready, networkUnavailable v1.ConditionStatus) v1.Node {
+	node := v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{}},
+		Spec:       v1.NodeSpec{PodCIDR: podCidr},
+	}
+	if podCidr != "" {
+		node.Spec.PodCIDRs = []string{podCidr}
+	}
+	if ready != "" {
+		node.Status.Conditions = append(node.Status.Conditions, v1.NodeCondition{Type: v1.NodeReady, Status: ready})
+	}
+	if networkUnavailable != "" {
+		node.Status.Conditions = append(node.Status.Conditions, v1.NodeCondition{Type: v1.NodeNetworkUnavailable, Status: networkUnavailable})
+	}
+	return node
+}
+
+func TestTargetOf(t *testing.T) {
+	annotated := newNode("a", "172.16.1.0/24", v1.ConditionTrue, "")
+	annotated.Annotations[NodeAnnotationProbeAddressKey] = "172.16.1.10"
+	annotated.Annotations[NodeAnnotationLocalProbeAddressKey] = "172.16.1.1"
+	local := newNode("a", "172.16.1.0/24", v1.ConditionTrue, "")
+	local.Annotations[NodeAnnotationLocalProbeAddressKey] = "172.16.1.1"
+	local.Annotations["projectcalico.org/IPv4IPIPTunnelAddr"] = "10.244.3.64"
+	tunnel := newNode("a", "172.16.1.0/24", v1.ConditionTrue, "")
+	tunnel.Annotations["projectcalico.org/IPv4VXLANTunnelAddr"] = "10.244.3.65"
+	invalid := newNode("a", "172.16.1.0/24", v1.ConditionTrue, "")
+	invalid.Annotations[NodeAnnotationProbeAddressKey] = "bad"
+
+	tests := []struct {
+		name    string
+		node    v1.Node
+		offset  int
+		addr    string
+		wantErr bool
+	}{
+		{name: "first address", node: newNode("a", "172.16.1.0/24", "", ""), offset: 1, addr: "172.16.1.1"},
+		{name: "offset crosses octet", node: newNode("a", "172.16.0.0/23", "", ""), offset: 300, addr: "172.16.1.44"},
+		{name: "annotation overrides", node: annotated, offset: 1, addr: "172.16.1.10"},
+		{name: "local address", node: local, addr: "172.16.1.1"},
+		{name: "calico tunnel address", node: tunnel, addr: "10.244.3.65"},
+		{name: "no probe address", node: newNode("a", "172.16.1.0/24", "", ""), wantErr: true},
+		{name: "invalid annotation", node: invalid, offset: 1, wantErr: true},
+		{name: "offset out of cidr", node: newNode("a", "172.16.1.0/24", "", ""), offset: 256, wantErr: true},
+		{name: "no pod cidr", node: newNode("a", "", "", ""), offset: 1, wantErr: true},
+		{name: "ipv6 pod cidr", node: newNode("a", "fd00::/64", "", ""), offset: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := TargetOf(&tt.node, tt.offset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TargetOf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && target.Addr.String() != tt.addr {
+				t.Errorf("TargetOf() = %s, want %s", target.Addr, tt.addr)
+			}
+		})
+	}
+}
+
+func TestLocalAddress(t *testing.T) {
+	addrs := func(cidrs ...string) []net.Addr {
+		var addrs []net.Addr
+		for _, s := range cidrs {
+			ip, ipnet, _ := net.ParseCIDR(s)
+			ipnet.IP = ip
+			addrs = append(addrs, ipnet)
+		}
+		return addrs
+	}
+	tests := []struct {
+		name  string
+		node  v1.Node
+		addrs []net.Addr
+		want  string
+	}{
+		{name: "bridge gateway", node: newNode("a", "172.16.1.0/24", "", ""),
+			addrs: addrs("10.0.1.3/24", "fd00::1/64", "172.16.1.1/24"), want: "172.16.1.1"},
+		{name: "tunnel device", node: newNode("a", "172.16.1.0/24", "", ""),
+			addrs: addrs("10.0.1.3/24", "172.16.1.1/32"), want: "172.16.1.1"},
+		{name: "network address", node: newNode("a", "172.16.1.0/24", "", ""),
+			addrs: addrs("172.16.1.0/32")},
+		{name: "no address in pod cidr", node: newNode("a", "172.16.1.0/24", "", ""),
+			addrs: addrs("10.0.1.3/24", "172.16.2.1/24")},
+		{name: "no pod cidr", node: newNode("a", "", "", ""), addrs: addrs("172.16.1.1/24")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LocalAddress(&tt.node, tt.addrs)
+			if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+				t.Errorf("LocalAddress() = %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargets(t *testing.T) {
+	nodes := []v1.Node{
+		newNode("local", "172.16.0.0/24", v1.ConditionTrue, v1.ConditionFalse),
+		newNode("c", "172.16.3.0/24", v1.ConditionTrue, v1.ConditionFalse),
+		newNode("b", "172.16.2.0/24", v1.ConditionTrue, ""),
+		newNode("not-ready", "172.16.4.0/24", v1.ConditionFalse, v1.ConditionFalse),
+		newNode("no-route", "172.16.5.0/24", v1.ConditionTrue, v1.ConditionTrue),
+		newNode("no-cidr", "", v1.ConditionTrue, v1.ConditionFalse),
+	}
+	var names []string
+	for _, target := range Targets(nodes, "local", 1) {
+		names = append(names, target.Name+"="+target.Addr.String())
+	}
+	want := []string{"b=172.16.2.1", "c=172.16.3.1"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Targets() = %v, want %v", names, want)
+	}
+}
+
+func TestSample(t *testing.T) {
+	targets := []Target{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	names := func(targets []Target) string {
+		var s []string
+		for _, target := range targets {
+			s = append(s, target.Name)
+		}
+		return strings.Join(s, ",")
+	}
+
+	cursor := 0
+	var rounds []string
+	for i := 0; i < 3; i++ {
+		var sampled []Target
+		sampled, cursor = sample(targets, 2, cursor)
+		rounds = append(rounds, names(sampled))
+	}
+	if want := []string{"a,b", "c,a", "b,c"}; !reflect.DeepEqual(rounds, want) {
+		t.Errorf("sample() rounds = %v, want %v", rounds, want)
+	}
+	if all, _ := sample(targets, 0, 1); names(all) != "a,b,c" {
+		t.Errorf("sample() without limit = %s, want all targets", names(all))
+	}
+}
+
+func TestCondition(t *testing.T) {
+	if status, reason, _ := condition(nil); status != v1.ConditionUnknown || reason != reasonNoPeers {
+		t.Errorf("condition() without peers = %s %s", status, reason)
+	}
+
+	results := map[string]Result{"a": {Reachable: true}, "b": {Reachable: true}}
+	if status, reason, _ := condition(results); status != v1.ConditionTrue || reason != reasonPeersReachable {
+		t.Errorf("condition() all reachable = %s %s", status, reason)
+	}
+
+	for _, name := range []string{"c", "d", "e", "f", "g", "h"} {
+		results[name] = Result{}
+	}
+	status, reason, message := condition(results)
+	if status != v1.ConditionFalse || reason != reasonPeersUnreachable {
+		t.Errorf("condition() unreachable = %s %s", status, reason)
+	}
+	if want := "Pods of 6 of 8 probed peers are unreachable: c, d, e, f, g and 1 more"; message != want {
+		t.Errorf("condition() message = %q, want %q", message, want)
+	}
+}
+
+func TestTally(t *testing.T) {
+	reporter := func(name string, status v1.ConditionStatus, unreachable string) v1.Node {
+		node := newNode(name, "", v1.ConditionTrue, "")
+		node.Status.Conditions = append(node.Status.Conditions, v1.NodeCondition{Type: NodePodNetworkReachable, Status: status})
+		if unreachable != "" {
+			node.Annotations[NodeAnnotationUnreachablePeersKey] = unreachable
+		}
+		return node
+	}
+	nodes := []v1.Node{
+		reporter("a", v1.ConditionFalse, "c"),
+		reporter("b", v1.ConditionFalse, "c,d"),
+		reporter("d", v1.ConditionTrue, ""),
+		reporter("e", v1.ConditionUnknown, "c"),
+		newNode("c", "", v1.ConditionTrue, ""),
+	}
+	votes := Tally(nodes)
+	want := map[string]Votes{
+		"a": {Reporters: 2},
+		"b": {Reporters: 2},
+		"c": {Reporters: 3, Unreachable: 2},
+		"d": {Reporters: 2, Unreachable: 1},
+		"e": {Reporters: 3},
+	}
+	if !reflect.DeepEqual(votes, want) {
+		t.Errorf("Tally() = %v, want %v", votes, want)
+	}
+	if !votes["c"].Broken() || votes["d"].Broken() || votes["a"].Broken() {
+		t.Errorf("Broken() = c:%v d:%v a:%v, want c only", votes["c"].Broken(), votes["d"].Broken(), votes["a"].Broken())
+	}
+}
@@ -16,7 +16,7 @@ func ConvertToMap(ifc interface{}) []byte {
 	body, err := json.Marshal(ifc)
 
 	if err != nil {
-		klog.Errorf("Failed to convert JSON: %v", err)
+		klog.ErrorS(err, "Failed to convert JSON")
 	}
 	return body
 }
@@ -207,7 +207,7 @@ func setQueryValues(i interface{}, values *url.Values, prefix string) {
 					if err == nil {
 						value = string(bytes)
 					} else {
-						klog.Errorf("Failed to convert JSON: %v", err)
+						klog.ErrorS(err, "Failed to convert JSON")
 					}
 				}
 			default:
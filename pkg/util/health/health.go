@@ -0,0 +1,258 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// OpDescribeVpcs is recorded every time a vpc client is built
+	OpDescribeVpcs = "DescribeVpcs"
+	// OpDescribeRoutes is recorded for every route table query
+	OpDescribeRoutes = "DescribeRoutes"
+	// OpCredentials is recorded when the aksk provider is asked for credentials
+	OpCredentials = "Credentials"
+
+	// DebugPath is the path of the status endpoint served next to the metrics
+	DebugPath = "/debug/route-controller/status"
+
+	defaultCloudFreshness    = 10 * time.Minute
+	defaultProbeInterval     = 1 * time.Minute
+	defaultLivenessPeriods   = 3
+	defaultCloudProbeTimeout = 30 * time.Second
+)
+
+// readinessOps are the cloud calls that must have succeeded recently for the
+// controller to be considered ready.
+var readinessOps = []string{OpCredentials, OpDescribeVpcs, OpDescribeRoutes}
+
+// CallStatus is the last known result of one cloud api operation
+type CallStatus struct {
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	LastFailure time.Time `json:"lastFailure,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+func (s *CallStatus) healthy() bool {
+	return !s.LastSuccess.IsZero() && !s.LastSuccess.Before(s.LastFailure)
+}
+
+// SyncStatus describes the periodic reconcileForCluster loop
+type SyncStatus struct {
+	Period        time.Duration `json:"period"`
+	Started       time.Time     `json:"started,omitempty"`
+	LastCompleted time.Time     `json:"lastCompleted,omitempty"`
+	LastError     string        `json:"lastError,omitempty"`
+}
+
+// Status is the snapshot served on the debug endpoint
+type Status struct {
+	Ready     bool                   `json:"ready"`
+	ReadyErr  string                 `json:"readyError,omitempty"`
+	Live      bool                   `json:"live"`
+	LiveErr   string                 `json:"liveError,omitempty"`
+	CloudAPI  map[string]*CallStatus `json:"cloudApi"`
+	Sync      SyncStatus             `json:"sync"`
+	LastProbe time.Time              `json:"lastProbe,omitempty"`
+}
+
+// Tracker keeps the state needed by the readiness and liveness checks
+type Tracker struct {
+	lock sync.Mutex
+
+	calls map[string]*CallStatus
+	sync  SyncStatus
+
+	// probe actively checks the cloud api when the recorded results are stale,
+	// e.g. on a replica that is not the leader and never reconciles.
+	probe     func(ctx context.Context) error
+	lastProbe time.Time
+	probeErr  error
+
+	cloudFreshness  time.Duration
+	probeInterval   time.Duration
+	livenessPeriods int
+	now             func() time.Time
+}
+
+// DefaultTracker is the tracker the ksyun and route packages report to
+var DefaultTracker = NewTracker()
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		calls:           make(map[string]*CallStatus),
+		cloudFreshness:  defaultCloudFreshness,
+		probeInterval:   defaultProbeInterval,
+		livenessPeriods: defaultLivenessPeriods,
+		now:             time.Now,
+	}
+}
+
+// RecordCloudCall records the result of a cloud api operation on the default tracker
+func RecordCloudCall(op string, err error) {
+	DefaultTracker.RecordCloudCall(op, err)
+}
+
+// SetCloudProbe sets the function used to refresh stale cloud api results on the default tracker
+func SetCloudProbe(probe func(ctx context.Context) error) {
+	DefaultTracker.SetCloudProbe(probe)
+}
+
+// SyncStarted marks the periodic sync loop as running on the default tracker
+func SyncStarted(period time.Duration) {
+	DefaultTracker.SyncStarted(period)
+}
+
+// SyncCompleted records the end of one periodic sync on the default tracker
+func SyncCompleted(err error) {
+	DefaultTracker.SyncCompleted(err)
+}
+
+func (t *Tracker) RecordCloudCall(op string, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s, ok := t.calls[op]
+	if !ok {
+		s = &CallStatus{}
+		t.calls[op] = s
+	}
+	if err != nil {
+		s.LastFailure = t.now()
+		s.LastError = err.Error()
+		return
+	}
+	s.LastSuccess = t.now()
+	s.LastError = ""
+}
+
+func (t *Tracker) SetCloudProbe(probe func(ctx context.Context) error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.probe = probe
+}
+
+func (t *Tracker) SyncStarted(period time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.sync.Period = period
+	t.sync.Started = t.now()
+}
+
+func (t *Tracker) SyncCompleted(err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.sync.LastCompleted = t.now()
+	if err != nil {
+		t.sync.LastError = err.Error()
+	} else {
+		t.sync.LastError = ""
+	}
+}
+
+// Readyz fails unless credentials, DescribeVpcs and DescribeRoutes all
+// succeeded recently. Stale results are refreshed through the cloud probe.
+func (t *Tracker) Readyz(_ *http.Request) error {
+	if err := t.checkCloud(); err == nil {
+		return nil
+	}
+
+	t.lock.Lock()
+	probe := t.probe
+	due := t.now().Sub(t.lastProbe) >= t.probeInterval
+	probeErr := t.probeErr
+	if probe != nil && due {
+		t.lastProbe = t.now()
+	}
+	t.lock.Unlock()
+
+	if probe != nil && due {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultCloudProbeTimeout)
+		probeErr = probe(ctx)
+		cancel()
+		t.lock.Lock()
+		t.probeErr = probeErr
+		t.lock.Unlock()
+	}
+	if probeErr != nil {
+		return fmt.Errorf("cloud api probe failed: %v", probeErr)
+	}
+	return t.checkCloud()
+}
+
+func (t *Tracker) checkCloud() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, op := range readinessOps {
+		s, ok := t.calls[op]
+		if !ok || s.LastSuccess.IsZero() {
+			return fmt.Errorf("%s has never succeeded", op)
+		}
+		if !s.healthy() {
+			return fmt.Errorf("%s failed at %s: %s", op, s.LastFailure.Format(time.RFC3339), s.LastError)
+		}
+		if t.now().Sub(s.LastSuccess) > t.cloudFreshness {
+			return fmt.Errorf("%s has not succeeded since %s", op, s.LastSuccess.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// Healthz fails when the periodic sync has been started but has not completed
+// for several reconcile periods. Replicas that do not hold the lease never
+// start the loop and are always live.
+func (t *Tracker) Healthz(_ *http.Request) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.sync.Started.IsZero() || t.sync.Period <= 0 {
+		return nil
+	}
+	last := t.sync.LastCompleted
+	if last.Before(t.sync.Started) {
+		last = t.sync.Started
+	}
+	deadline := time.Duration(t.livenessPeriods) * t.sync.Period
+	if since := t.now().Sub(last); since > deadline {
+		return fmt.Errorf("route sync has not completed for %s, more than %d periods of %s",
+			since.Round(time.Second), t.livenessPeriods, t.sync.Period)
+	}
+	return nil
+}
+
+// Snapshot returns a copy of the current status
+func (t *Tracker) Snapshot() Status {
+	status := Status{Ready: true, Live: true}
+	if err := t.checkCloud(); err != nil {
+		status.Ready = false
+		status.ReadyErr = err.Error()
+	}
+	if err := t.Healthz(nil); err != nil {
+		status.Live = false
+		status.LiveErr = err.Error()
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	status.CloudAPI = make(map[string]*CallStatus, len(t.calls))
+	for op, s := range t.calls {
+		c := *s
+		status.CloudAPI[op] = &c
+	}
+	status.Sync = t.sync
+	status.LastProbe = t.lastProbe
+	return status
+}
+
+// ServeHTTP serves the status snapshot as json
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	b, err := json.MarshalIndent(t.Snapshot(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,195 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for the tracker
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Step(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestTracker() (*Tracker, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	t := NewTracker()
+	t.now = clock.Now
+	return t, clock
+}
+
+func recordAll(t *Tracker, err error) {
+	for _, op := range readinessOps {
+		t.RecordCloudCall(op, err)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	fail := errors.New("kop error")
+	tests := []struct {
+		name    string
+		record  func(*Tracker, *fakeClock)
+		wantErr bool
+	}{
+		{name: "never called", record: func(*Tracker, *fakeClock) {}, wantErr: true},
+		{name: "all succeeded", record: func(t *Tracker, _ *fakeClock) { recordAll(t, nil) }},
+		{
+			name: "one never succeeded",
+			record: func(t *Tracker, _ *fakeClock) {
+				t.RecordCloudCall(OpCredentials, nil)
+				t.RecordCloudCall(OpDescribeVpcs, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed after success",
+			record: func(t *Tracker, c *fakeClock) {
+				recordAll(t, nil)
+				c.Step(time.Second)
+				t.RecordCloudCall(OpDescribeRoutes, fail)
+			},
+			wantErr: true,
+		},
+		{
+			name: "recovered after failure",
+			record: func(t *Tracker, c *fakeClock) {
+				recordAll(t, fail)
+				c.Step(time.Second)
+				recordAll(t, nil)
+			},
+		},
+		{
+			name: "stale success",
+			record: func(t *Tracker, c *fakeClock) {
+				recordAll(t, nil)
+				c.Step(defaultCloudFreshness + time.Second)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, clock := newTestTracker()
+			tt.record(tracker, clock)
+			if err := tracker.Readyz(nil); (err != nil) != tt.wantErr {
+				t.Errorf("Readyz() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadyzProbe(t *testing.T) {
+	tracker, clock := newTestTracker()
+	recordAll(tracker, nil)
+	clock.Step(defaultCloudFreshness + time.Second)
+
+	probes := 0
+	var probeErr error
+	tracker.SetCloudProbe(func(context.Context) error {
+		probes++
+		if probeErr == nil {
+			// a successful probe records fresh results, like ksyun.CheckCloudAPI
+			recordAll(tracker, nil)
+		}
+		return probeErr
+	})
+
+	if err := tracker.Readyz(nil); err != nil || probes != 1 {
+		t.Fatalf("Readyz() with stale results = %v after %d probes, want ready after 1 probe", err, probes)
+	}
+	if err := tracker.Readyz(nil); err != nil || probes != 1 {
+		t.Errorf("Readyz() with fresh results = %v after %d probes, want ready without probing", err, probes)
+	}
+
+	clock.Step(defaultCloudFreshness + time.Second)
+	probeErr = errors.New("describe vpc failed")
+	if err := tracker.Readyz(nil); err == nil || probes != 2 {
+		t.Errorf("Readyz() with failing probe = %v after %d probes, want error after 2 probes", err, probes)
+	}
+	// the probe is rate limited, its last error is reported until the interval passed
+	if err := tracker.Readyz(nil); err == nil || probes != 2 {
+		t.Errorf("Readyz() within probe interval = %v after %d probes, want error without probing", err, probes)
+	}
+	clock.Step(defaultProbeInterval)
+	probeErr = nil
+	if err := tracker.Readyz(nil); err != nil || probes != 3 {
+		t.Errorf("Readyz() after probe interval = %v after %d probes, want ready after 3 probes", err, probes)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	period := time.Minute
+	tests := []struct {
+		name    string
+		run     func(*Tracker, *fakeClock)
+		wantErr bool
+	}{
+		{
+			name: "sync never started",
+			run:  func(_ *Tracker, c *fakeClock) { c.Step(time.Hour) },
+		},
+		{
+			name: "started within periods",
+			run: func(t *Tracker, c *fakeClock) {
+				t.SyncStarted(period)
+				c.Step(defaultLivenessPeriods * period)
+			},
+		},
+		{
+			name: "never completed",
+			run: func(t *Tracker, c *fakeClock) {
+				t.SyncStarted(period)
+				c.Step(defaultLivenessPeriods*period + time.Second)
+			},
+			wantErr: true,
+		},
+		{
+			name: "completed recently",
+			run: func(t *Tracker, c *fakeClock) {
+				t.SyncStarted(period)
+				c.Step(10 * period)
+				t.SyncCompleted(errors.New("list routes failed"))
+				c.Step(period)
+			},
+		},
+		{
+			name: "stuck after completing",
+			run: func(t *Tracker, c *fakeClock) {
+				t.SyncStarted(period)
+				c.Step(period)
+				t.SyncCompleted(nil)
+				c.Step(defaultLivenessPeriods*period + time.Second)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, clock := newTestTracker()
+			tt.run(tracker, clock)
+			if err := tracker.Healthz(nil); (err != nil) != tt.wantErr {
+				t.Errorf("Healthz() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	tracker, clock := newTestTracker()
+	recordAll(tracker, nil)
+	tracker.SyncStarted(time.Minute)
+	clock.Step(time.Hour)
+
+	status := tracker.Snapshot()
+	if status.Ready || status.Live {
+		t.Errorf("Snapshot() ready %v live %v, want neither", status.Ready, status.Live)
+	}
+	if len(status.CloudAPI) != len(readinessOps) {
+		t.Errorf("Snapshot() has %d cloud api results, want %d", len(status.CloudAPI), len(readinessOps))
+	}
+}
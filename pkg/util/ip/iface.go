@@ -24,7 +24,7 @@ import (
 
 func getIfaceAddrs(iface *net.Interface) ([]netlink.Addr, error) {
 	link := &netlink.Device{
-		netlink.LinkAttrs{
+		LinkAttrs: netlink.LinkAttrs{
 			Index: iface.Index,
 		},
 	}
@@ -63,6 +63,22 @@ func GetIfaceIP4Addr(iface *net.Interface) (net.IP, error) {
 	return nil, errors.New("No IPv4 address found for given interface")
 }
 
+// GetIfaceIP4Net returns the subnet of the first global unicast IPv4 address of iface
+func GetIfaceIP4Net(iface *net.Interface) (*net.IPNet, error) {
+	addrs, err := getIfaceAddrs(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil && addr.IP.IsGlobalUnicast() {
+			return &net.IPNet{IP: addr.IP.Mask(addr.Mask), Mask: addr.Mask}, nil
+		}
+	}
+
+	return nil, errors.New("No IPv4 address found for given interface")
+}
+
 func GetIfaceIP4AddrMatch(iface *net.Interface, matchAddr net.IP) error {
 	addrs, err := getIfaceAddrs(iface)
 	if err != nil {
@@ -0,0 +1,68 @@
+package ip
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// ParseIP4Net parses an IPv4 CIDR, the host bits are cleared
+func ParseIP4Net(s string) (IP4Net, error) {
+	ip, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return IP4Net{}, err
+	}
+	if ip.To4() == nil {
+		return IP4Net{}, fmt.Errorf("%s is not an IPv4 CIDR", s)
+	}
+	return FromIPNet(n).Network(), nil
+}
+
+// ContainsNet reports whether other lies entirely within n
+func (n IP4Net) ContainsNet(other IP4Net) bool {
+	return n.PrefixLen <= other.PrefixLen && n.Contains(other.IP)
+}
+
+// Supernet returns the network one bit shorter than n, n itself for 0.0.0.0/0
+func (n IP4Net) Supernet() IP4Net {
+	if n.PrefixLen == 0 {
+		return n.Network()
+	}
+	return IP4Net{IP: n.IP, PrefixLen: n.PrefixLen - 1}.Network()
+}
+
+// siblingOf reports whether n and other are the two halves of the same supernet
+func (n IP4Net) siblingOf(other IP4Net) bool {
+	return n.PrefixLen == other.PrefixLen && n.PrefixLen > 0 &&
+		!n.Equal(other) && n.Supernet().Equal(other.Supernet())
+}
+
+// Summarize returns the smallest set of networks covering exactly the addresses
+// of nets. Duplicates and networks within others are dropped, and sibling
+// networks are merged into their supernet as long as possible. The result is
+// sorted by address.
+func Summarize(nets []IP4Net) []IP4Net {
+	sorted := make([]IP4Net, 0, len(nets))
+	for _, n := range nets {
+		sorted = append(sorted, n.Network())
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].IP != sorted[j].IP {
+			return sorted[i].IP < sorted[j].IP
+		}
+		return sorted[i].PrefixLen < sorted[j].PrefixLen
+	})
+
+	var result []IP4Net
+	for _, n := range sorted {
+		if len(result) > 0 && result[len(result)-1].ContainsNet(n) {
+			continue
+		}
+		result = append(result, n)
+		for len(result) > 1 && result[len(result)-2].siblingOf(result[len(result)-1]) {
+			merged := result[len(result)-1].Supernet()
+			result = append(result[:len(result)-2], merged)
+		}
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package ip
+
+import (
+	"reflect"
+	"testing"
+)
+
+func parseNets(t *testing.T, cidrs ...string) []IP4Net {
+	t.Helper()
+	var nets []IP4Net
+	for _, s := range cidrs {
+		n, err := ParseIP4Net(s)
+		if err != nil {
+			t.Fatalf("ParseIP4Net(%q): %v", s, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func TestParseIP4Net(t *testing.T) {
+	n, err := ParseIP4Net("10.0.1.7/24")
+	if err != nil {
+		t.Fatalf("ParseIP4Net: %v", err)
+	}
+	if n.String() != "10.0.1.0/24" {
+		t.Errorf("ParseIP4Net = %s, want 10.0.1.0/24", n)
+	}
+	for _, s := range []string{"10.0.0.0", "fd00::/64", "10.0.0.0/33"} {
+		if _, err := ParseIP4Net(s); err == nil {
+			t.Errorf("ParseIP4Net(%q) succeeded", s)
+		}
+	}
+}
+
+func TestContainsNet(t *testing.T) {
+	n := mkIP4Net("10.0.0.0", 23)
+	if !n.ContainsNet(mkIP4Net("10.0.1.0", 24)) {
+		t.Error("10.0.0.0/23 does not contain 10.0.1.0/24")
+	}
+	if !n.ContainsNet(n) {
+		t.Error("10.0.0.0/23 does not contain itself")
+	}
+	if n.ContainsNet(mkIP4Net("10.0.0.0", 22)) {
+		t.Error("10.0.0.0/23 contains 10.0.0.0/22")
+	}
+	if n.ContainsNet(mkIP4Net("10.0.2.0", 24)) {
+		t.Error("10.0.0.0/23 contains 10.0.2.0/24")
+	}
+}
+
+func TestSupernet(t *testing.T) {
+	for in, want := range map[string]string{
+		"10.0.1.0/24": "10.0.0.0/23",
+		"10.0.2.0/24": "10.0.2.0/23",
+		"10.0.0.0/1":  "0.0.0.0/0",
+		"0.0.0.0/0":   "0.0.0.0/0",
+	} {
+		if got := parseNets(t, in)[0].Supernet().String(); got != want {
+			t.Errorf("Supernet(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{name: "empty"},
+		{name: "single", in: []string{"10.0.1.0/24"}, want: []string{"10.0.1.0/24"}},
+		{name: "siblings", in: []string{"10.0.1.0/24", "10.0.0.0/24"}, want: []string{"10.0.0.0/23"}},
+		{name: "not aligned", in: []string{"10.0.1.0/24", "10.0.2.0/24"}, want: []string{"10.0.1.0/24", "10.0.2.0/24"}},
+		{
+			name: "cascading merge",
+			in:   []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24", "10.0.4.0/24"},
+			want: []string{"10.0.0.0/22", "10.0.4.0/24"},
+		},
+		{
+			name: "different prefix lengths",
+			in:   []string{"10.0.2.0/23", "10.0.0.0/24", "10.0.1.0/24"},
+			want: []string{"10.0.0.0/22"},
+		},
+		{
+			name: "duplicates and contained",
+			in:   []string{"10.0.0.0/23", "10.0.1.0/24", "10.0.0.0/23", "10.0.1.128/25"},
+			want: []string{"10.0.0.0/23"},
+		},
+		{name: "gap", in: []string{"10.0.0.0/24", "10.0.3.0/24"}, want: []string{"10.0.0.0/24", "10.0.3.0/24"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, n := range Summarize(parseNets(t, tt.in...)) {
+				got = append(got, n.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Summarize(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+
+	logsjson "k8s.io/component-base/logs/json"
+	logsapi "k8s.io/component-base/logs/api/v1"
+	"k8s.io/klog/v2"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// FormatText writes klog formatted text lines
+	FormatText = "text"
+	// FormatJSON writes one json object per line
+	FormatJSON = "json"
+)
+
+// Setup routes klog and controller-runtime logs through a logger of the given
+// format. The returned function flushes buffered log entries.
+func Setup(format string, verbosity int) (func(), error) {
+	switch format {
+	case FormatText, "":
+		ctrllog.SetLogger(klog.NewKlogr())
+		return klog.Flush, nil
+	case FormatJSON:
+		logger, flush := logsjson.NewJSONLogger(logsapi.VerbosityLevel(verbosity),
+			logsjson.AddNopSync(os.Stdout), logsjson.AddNopSync(os.Stderr), nil)
+		klog.SetLogger(logger)
+		ctrllog.SetLogger(logger)
+		return func() {
+			klog.Flush()
+			flush()
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported log format %q, supported formats are %q and %q", format, FormatText, FormatJSON)
+	}
+}
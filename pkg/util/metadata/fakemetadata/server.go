@@ -0,0 +1,118 @@
+// Package fakemetadata provides a stand-in for the instance metadata service,
+// serving values under /latest/meta-data/ like the real one.
+package fakemetadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const prefix = "/latest/meta-data/"
+
+// Server is a fake metadata service for tests
+type Server struct {
+	*httptest.Server
+
+	lock   sync.Mutex
+	values map[string]string
+	// failures answers a path with a status for the given number of requests, -1 for ever
+	failures map[string]failure
+	delay    time.Duration
+	requests map[string]int
+}
+
+type failure struct {
+	status int
+	count  int
+}
+
+// NewServer starts a server answering the given values, keyed by path such as
+// "instance-id" or "placement/zone". Unknown paths answer 404.
+func NewServer(values map[string]string) *Server {
+	s := &Server{
+		values:   make(map[string]string, len(values)),
+		failures: make(map[string]failure),
+		requests: make(map[string]int),
+	}
+	for k, v := range values {
+		s.values[k] = v
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// BaseURL is the metadata url to configure the client with
+func (s *Server) BaseURL() string {
+	return s.URL + prefix
+}
+
+// Set sets the value of path
+func (s *Server) Set(path, value string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values[path] = value
+}
+
+// Fail answers the next count requests of path with status, count -1 fails for ever
+func (s *Server) Fail(path string, status, count int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures[path] = failure{status: status, count: count}
+}
+
+// SetDelay delays every answer, to simulate a hung metadata service
+func (s *Server) SetDelay(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.delay = d
+}
+
+// Requests returns how many requests were made for path
+func (s *Server) Requests(path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests[path]
+}
+
+func (s *Server) serve(w http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.URL.Path, prefix) {
+		http.NotFound(w, req)
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, prefix)
+
+	s.lock.Lock()
+	s.requests[path]++
+	delay := s.delay
+	value, ok := s.values[path]
+	f, failing := s.failures[path]
+	if failing && f.count != 0 {
+		if f.count > 0 {
+			f.count--
+			s.failures[path] = f
+		}
+	} else {
+		failing = false
+	}
+	s.lock.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	if failing {
+		http.Error(w, http.StatusText(f.status), f.status)
+		return
+	}
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	_, _ = w.Write([]byte(value))
+}
@@ -0,0 +1,95 @@
+// Package metadata reads the instance metadata service of the node.
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Error is returned when the metadata service answers with an error status
+type Error struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Failed to obtain from metadata interface, access path: %s, status: %d, return: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// Client reads the instance metadata service
+type Client struct {
+	baseURL       string
+	client        *http.Client
+	retries       int
+	retryInterval time.Duration
+}
+
+// NewClient creates a client with a per request timeout. Connection errors
+// and 5xx answers are retried, other answers such as 404 are returned at once.
+func NewClient(baseURL string, timeout time.Duration, retries int, retryInterval time.Duration) *Client {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	if retries < 0 {
+		retries = 0
+	}
+	return &Client{
+		baseURL:       baseURL,
+		client:        &http.Client{Timeout: timeout},
+		retries:       retries,
+		retryInterval: retryInterval,
+	}
+}
+
+// Get returns the metadata value at path, e.g. instance-id
+func (c *Client) Get(ctx context.Context, path string) (string, error) {
+	var err error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			klog.FromContext(ctx).V(4).Info("Retry metadata request", "path", path, "attempt", attempt, "err", err.Error())
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(c.retryInterval):
+			}
+		}
+		var value string
+		value, err = c.get(ctx, path)
+		if err == nil {
+			return value, nil
+		}
+		if e, ok := err.(*Error); ok && e.StatusCode < http.StatusInternalServerError {
+			return "", err
+		}
+	}
+	return "", err
+}
+
+func (c *Client) get(ctx context.Context, path string) (string, error) {
+	url := c.baseURL + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	// If failed, often 404
+	if resp.StatusCode != http.StatusOK {
+		return "", &Error{URL: url, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return strings.TrimSpace(string(body)), nil
+}
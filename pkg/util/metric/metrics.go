@@ -17,6 +17,99 @@ var (
 		},
 		[]string{"verb"},
 	)
+
+	// RouteGatewayDrift counts routes whose gateway was not the instance of the node, by repair result
+	RouteGatewayDrift = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "route_gateway_drift_total",
+			Help: "Number of routes found pointing at another instance than the one of the node, by repair result.",
+		},
+		[]string{"result"},
+	)
+
+	// RouteTableEntries reports the routes in the vpc route table, the routes wanted for
+	// the nodes and the routes that would be needed with one route per pod CIDR
+	RouteTableEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "route_table_entries",
+			Help: "Number of route table entries by kind: used in the route table, desired for the nodes, and pod_cidrs without aggregation.",
+		},
+		[]string{"kind"},
+	)
+
+	// RouteReport reports the route changes the controller would make while it does not
+	// configure cloud routes
+	RouteReport = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "route_report_entries",
+			Help: "Number of node routes by state while cloud routes are not configured: routed, missing, drift, outside_cluster_cidr, and conflict for routes that would be deleted.",
+		},
+		[]string{"state"},
+	)
+
+	// NodeAnnotationReconcile counts the reconciles of the node annotation agent by result
+	NodeAnnotationReconcile = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "node_annotation_reconcile_total",
+			Help: "Number of node annotation reconciles by result.",
+		},
+		[]string{"result"},
+	)
+
+	// HostGWPeers counts the peers of the node agent by the path their pod CIDRs are reached over
+	HostGWPeers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "host_gw_peers",
+			Help: "Number of peer nodes by path: vpc route, host-gw kernel route, or none.",
+		},
+		[]string{"path"},
+	)
+
+	// OverlayPeerPackets counts the packets tunneled to and from each overlay peer
+	OverlayPeerPackets = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "overlay_peer_packets_total",
+			Help: "Number of packets tunneled by the overlay fallback, by peer node and direction.",
+		},
+		[]string{"peer", "direction"},
+	)
+
+	// OverlayPeerBytes counts the bytes tunneled to and from each overlay peer
+	OverlayPeerBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "overlay_peer_bytes_total",
+			Help: "Number of bytes tunneled by the overlay fallback, by peer node and direction.",
+		},
+		[]string{"peer", "direction"},
+	)
+
+	// OverlayDroppedPackets counts the packets the overlay fallback dropped by reason
+	OverlayDroppedPackets = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "overlay_dropped_packets_total",
+			Help: "Number of packets dropped by the overlay fallback, by reason.",
+		},
+		[]string{"reason"},
+	)
+
+	// PodNetworkReachable is the reachability matrix of the pod network, 1 if the pods of
+	// the target node were reachable from the source node in the last probe
+	PodNetworkReachable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pod_network_reachable",
+			Help: "Whether the probe address in the pod CIDR of the target node answered the source node, 1 or 0.",
+		},
+		[]string{"source", "target"},
+	)
+
+	// NodeAnnotationRepair counts the annotations and labels set or restored on the node
+	NodeAnnotationRepair = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "node_annotation_repairs_total",
+			Help: "Number of node annotations and labels set or restored by the annotation agent.",
+		},
+		[]string{"key"},
+	)
 )
 
 // MsSince returns milliseconds since start.
@@ -26,5 +119,11 @@ func MsSince(start time.Time) float64 {
 
 // RegisterPrometheus register metrics to prometheus server
 func RegisterPrometheus() {
-	metrics.Registry.MustRegister(RouteLatency)
+	metrics.Registry.MustRegister(RouteLatency, RouteGatewayDrift, RouteTableEntries, RouteReport)
+}
+
+// RegisterAnnotationPrometheus register the node agent metrics to prometheus server
+func RegisterAnnotationPrometheus() {
+	metrics.Registry.MustRegister(NodeAnnotationReconcile, NodeAnnotationRepair, HostGWPeers,
+		OverlayPeerPackets, OverlayPeerBytes, OverlayDroppedPackets, PodNetworkReachable)
 }
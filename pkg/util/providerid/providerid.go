@@ -0,0 +1,92 @@
+// Package providerid parses the spec.providerID of nodes on Kingsoft Cloud.
+//
+// The known formats are
+//
+//	<instanceId>
+//	ksyun://<instanceId>
+//	ksyun://<region>/<instanceId>
+//	ksyun://<region>/<zone>/<instanceId>
+//
+// where ksyun may also be kce or kingsoftcloud, and the instance id is a uuid.
+package providerid
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Schemes are the provider names accepted in a providerID
+var Schemes = []string{"ksyun", "kce", "kingsoftcloud"}
+
+var instanceIdPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ProviderID is a parsed providerID
+type ProviderID struct {
+	Scheme     string
+	Region     string
+	Zone       string
+	InstanceId string
+}
+
+func (p *ProviderID) String() string {
+	if p.Scheme == "" {
+		return p.InstanceId
+	}
+	parts := []string{}
+	for _, s := range []string{p.Region, p.Zone, p.InstanceId} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return p.Scheme + "://" + strings.Join(parts, "/")
+}
+
+// IsValidInstanceId reports whether id has the shape of a Kingsoft Cloud instance id
+func IsValidInstanceId(id string) bool {
+	return instanceIdPattern.MatchString(id)
+}
+
+// Parse parses providerID in one of the known formats
+func Parse(providerID string) (*ProviderID, error) {
+	if providerID == "" {
+		return nil, fmt.Errorf("providerID is empty")
+	}
+
+	p := &ProviderID{}
+	rest := providerID
+	if i := strings.Index(providerID, "://"); i >= 0 {
+		p.Scheme = strings.ToLower(providerID[:i])
+		if !knownScheme(p.Scheme) {
+			return nil, fmt.Errorf("providerID %q has unknown scheme %q, expected one of %v", providerID, p.Scheme, Schemes)
+		}
+		rest = providerID[i+3:]
+	}
+
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	switch {
+	case p.Scheme == "" && len(parts) != 1:
+		return nil, fmt.Errorf("providerID %q has no scheme but contains a path", providerID)
+	case len(parts) > 3:
+		return nil, fmt.Errorf("providerID %q has too many path segments", providerID)
+	case len(parts) == 3:
+		p.Region, p.Zone = parts[0], parts[1]
+	case len(parts) == 2:
+		p.Region = parts[0]
+	}
+	p.InstanceId = parts[len(parts)-1]
+
+	if !IsValidInstanceId(p.InstanceId) {
+		return nil, fmt.Errorf("providerID %q does not end with a valid instance id, got %q", providerID, p.InstanceId)
+	}
+	return p, nil
+}
+
+func knownScheme(scheme string) bool {
+	for _, s := range Schemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package providerid
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testInstanceId = "0b6e4a6d-4f3c-4f8e-9a43-5b3f1c2d7e90"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		providerID string
+		want       *ProviderID
+		wantErr    bool
+	}{
+		{providerID: testInstanceId, want: &ProviderID{InstanceId: testInstanceId}},
+		{providerID: "ksyun://" + testInstanceId, want: &ProviderID{Scheme: "ksyun", InstanceId: testInstanceId}},
+		{providerID: "ksyun:///" + testInstanceId, want: &ProviderID{Scheme: "ksyun", InstanceId: testInstanceId}},
+		{
+			providerID: "ksyun://cn-beijing-6/" + testInstanceId,
+			want:       &ProviderID{Scheme: "ksyun", Region: "cn-beijing-6", InstanceId: testInstanceId},
+		},
+		{
+			providerID: "KCE://cn-beijing-6/cn-beijing-6a/" + testInstanceId,
+			want:       &ProviderID{Scheme: "kce", Region: "cn-beijing-6", Zone: "cn-beijing-6a", InstanceId: testInstanceId},
+		},
+		{providerID: "", wantErr: true},
+		{providerID: "aws:///us-east-1a/i-0123456789abcdef0", wantErr: true},
+		{providerID: "ksyun://cn-beijing-6/not-an-instance", wantErr: true},
+		{providerID: "ksyun://a/b/c/" + testInstanceId, wantErr: true},
+		{providerID: "cn-beijing-6/" + testInstanceId, wantErr: true},
+		{providerID: "ksyun://", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.providerID, func(t *testing.T) {
+			got, err := Parse(tt.providerID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.providerID, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.providerID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, s := range []string{
+		testInstanceId,
+		"ksyun://" + testInstanceId,
+		"ksyun://cn-beijing-6/cn-beijing-6a/" + testInstanceId,
+	} {
+		p, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", s, err)
+		}
+		if p.String() != s {
+			t.Errorf("String() = %q, want %q", p.String(), s)
+		}
+	}
+}
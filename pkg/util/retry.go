@@ -4,7 +4,7 @@ import (
 	"context"
 	"github.com/avast/retry-go/v4"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/klog"
+	"k8s.io/klog/v2"
 	"time"
 )
 
@@ -40,7 +40,7 @@ func RetryWithBackOff(ctx context.Context,
 		return fn()
 	}, opts...)
 	if err != nil {
-		klog.Errorf("retry do err: %v", err)
+		klog.ErrorS(err, "Retry failed")
 		return err
 	}
 
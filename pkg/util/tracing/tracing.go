@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/pkg/config"
+	"ezone.ksyun.com/ezone/kce/vpc-route-controller/version"
+)
+
+const tracerName = "ezone.ksyun.com/ezone/kce/vpc-route-controller"
+
+// Span attributes shared by the controllers and the kop client
+const (
+	AttrNodeName   = attribute.Key("k8s.node.name")
+	AttrCIDR       = attribute.Key("route.destination_cidr")
+	AttrInstanceId = attribute.Key("ksyun.instance_id")
+	AttrRequestId  = attribute.Key("ksyun.request_id")
+	AttrAction     = attribute.Key("ksyun.action")
+)
+
+type attributesKey struct{}
+
+// Setup installs the global tracer provider exporting to the configured OTLP
+// collector. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	if cfg.Endpoint == "" {
+		klog.InfoS("Tracing endpoint is not set, tracing disabled")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter for %s error: %v", cfg.Endpoint, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(version.Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create tracing resource error: %v", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SamplingRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	klog.InfoS("Tracing enabled", "endpoint", cfg.Endpoint, "samplingRatio", cfg.SamplingRatio)
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer of the controller
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// StartRoot starts a new trace, ignoring any span already in ctx. The attributes
+// are set on the span and inherited by every span started through Start.
+func StartRoot(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx = WithAttributes(ctx, attrs...)
+	return Tracer().Start(ctx, name, trace.WithNewRoot(), trace.WithAttributes(attrs...))
+}
+
+// Start starts a child span carrying the attributes stored in ctx
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append(opts, trace.WithAttributes(Attributes(ctx)...))
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// WithAttributes returns a context carrying attrs in addition to the attributes already in ctx.
+// Later values of the same key replace earlier ones.
+func WithAttributes(ctx context.Context, attrs ...attribute.KeyValue) context.Context {
+	if len(attrs) == 0 {
+		return ctx
+	}
+	existing := Attributes(ctx)
+	merged := make([]attribute.KeyValue, 0, len(existing)+len(attrs))
+	for _, a := range existing {
+		replaced := false
+		for _, n := range attrs {
+			if a.Key == n.Key {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, a)
+		}
+	}
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, attributesKey{}, merged)
+}
+
+// Attributes returns the attributes stored in ctx by WithAttributes
+func Attributes(ctx context.Context) []attribute.KeyValue {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(attributesKey{}).([]attribute.KeyValue)
+	return attrs
+}
+
+// RecordError marks the span failed if err is not nil
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
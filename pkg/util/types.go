@@ -1,6 +1,7 @@
 package util
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -12,8 +13,19 @@ type ErrorResponse struct {
 // An Error represents a custom error for Appengine API failure response
 type Error struct {
 	KopError ErrorResponse `json:"apperror"`
+	// RequestId is the X-Request-ID sent with the failed request
+	RequestId string `json:"requestId"`
 }
 
 func (e *Error) Error() string {
-	return fmt.Sprintf("Kop Error: Status Code: %d Message: %s", e.KopError.StatusCode, e.KopError.Message)
+	return fmt.Sprintf("Kop Error: RequestId: %s Status Code: %d Message: %s", e.RequestId, e.KopError.StatusCode, e.KopError.Message)
+}
+
+// RequestIdOf returns the X-Request-ID of the kop request that caused err, if any
+func RequestIdOf(err error) string {
+	var kopErr *Error
+	if errors.As(err, &kopErr) {
+		return kopErr.RequestId
+	}
+	return ""
 }
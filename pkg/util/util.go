@@ -50,11 +50,11 @@ func ClusterVersionAtLeast(client *apiext.Clientset, min string) (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("unexpected error parsing running Kubernetes version, %s", err.Error())
 	}
-	klog.Infof("kubernetes version: %s", serverVersion.String())
+	klog.InfoS("Kubernetes version", "version", serverVersion.String())
 
 	least, err := version.ParseGeneric(min)
 	if err != nil {
-		klog.Errorf("parse version %s error: %s", min, err.Error())
+		klog.ErrorS(err, "Failed to parse version", "version", min)
 	}
 
 	return runningVersion.AtLeast(least), nil